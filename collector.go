@@ -0,0 +1,116 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promproto "github.com/prometheus/client_model/go"
+)
+
+var _ prometheus.Collector = (*collector)(nil)
+
+// A collector adapts a core to the official Prometheus client's Collector
+// interface. Since building descriptors is relatively expensive, they're
+// created lazily and cached.
+type collector struct {
+	core *core
+
+	descsMu sync.Mutex
+	descs   map[metric]*prometheus.Desc
+}
+
+func newCollector(c *core) *collector {
+	return &collector{
+		core:  c,
+		descs: make(map[metric]*prometheus.Desc, _defaultCollectionSize),
+	}
+}
+
+// Describe implements prometheus.Collector. It sends one descriptor for each
+// metric that exists when it's called, so registries detect conflicts with
+// those metrics on registration. Metrics created later aren't described.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.core.all() {
+		ch <- c.desc(m)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.core.refresh()
+	for _, m := range c.core.all() {
+		p := m.proto()
+		if p == nil || len(p.Metric) == 0 {
+			continue
+		}
+		desc := c.desc(m)
+		for _, pm := range p.Metric {
+			ch <- &collectedMetric{desc: desc, metric: pm}
+		}
+	}
+}
+
+func (c *collector) desc(m metric) *prometheus.Desc {
+	c.descsMu.Lock()
+	defer c.descsMu.Unlock()
+	if d, ok := c.descs[m]; ok {
+		return d
+	}
+	d := newDesc(m.describe())
+	c.descs[m] = d
+	return d
+}
+
+// newDesc converts our internal metadata into a Prometheus descriptor. The
+// metadata has already been scrubbed and validated, so constructing the
+// descriptor shouldn't fail; if it does, the Prometheus registry reports the
+// error on registration.
+func newDesc(meta metadata) *prometheus.Desc {
+	constTags := make(prometheus.Labels, len(meta.constTagPairs))
+	for _, pair := range meta.constTagPairs {
+		constTags[pair.GetName()] = pair.GetValue()
+	}
+	varTags := make([]string, len(meta.varTagNames))
+	for i := range meta.varTagNames {
+		varTags[i] = meta.varTagName(i)
+	}
+	return prometheus.NewDesc(*meta.Name, *meta.Help, varTags, constTags)
+}
+
+// A collectedMetric pairs one of our protobufs with its descriptor.
+type collectedMetric struct {
+	desc   *prometheus.Desc
+	metric *promproto.Metric
+}
+
+func (m *collectedMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *collectedMetric) Write(out *promproto.Metric) error {
+	out.Label = m.metric.Label
+	out.Counter = m.metric.Counter
+	out.Gauge = m.metric.Gauge
+	out.Histogram = m.metric.Histogram
+	return nil
+}
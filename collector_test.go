@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "go.uber.org/net/metrics"
+)
+
+func TestCollectorEndToEnd(t *testing.T) {
+	root := initializeMetrics(t, false)
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(root.Collector()), "Failed to register root.")
+
+	// The pedantic registry re-checks every collected metric against its
+	// descriptor, and the official client sorts its output. We should get
+	// exactly the same text as the root's own handler.
+	bs, err := ioutil.ReadFile("testdata/proto_integration_test.txt")
+	require.NoError(t, err, "Failed to open test fixture.")
+	code, actual := scrape(t, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code from Prometheus scrape.")
+	assert.Equal(t, string(bs), actual, "Unexpected Prometheus text.")
+}
+
+func TestCollectorSharesRegistry(t *testing.T) {
+	root := New()
+	c, err := root.Scope().Counter(Spec{
+		Name: "test_counter",
+		Help: "Some help.",
+	})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Inc()
+
+	registry := prometheus.NewRegistry()
+	official := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "official_gauge",
+		Help: "Some help.",
+	})
+	official.Set(2)
+	registry.MustRegister(official)
+	require.NoError(t, registry.Register(root.Collector()), "Failed to register root.")
+
+	code, actual := scrape(t, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code from Prometheus scrape.")
+	assert.Equal(t, "# HELP official_gauge Some help.\n"+
+		"# TYPE official_gauge gauge\n"+
+		"official_gauge 2\n"+
+		"# HELP test_counter Some help.\n"+
+		"# TYPE test_counter counter\n"+
+		"test_counter 1", actual, "Unexpected Prometheus text.")
+}
+
+func TestCollectorDescribe(t *testing.T) {
+	root := New()
+	_, err := root.Scope().Counter(Spec{Name: "test_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	_, err = root.Scope().Tagged(Tags{"service": "users"}).GaugeVector(Spec{
+		Name:    "test_gauge",
+		Help:    "Other help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge vector.")
+
+	ch := make(chan *prometheus.Desc, 10)
+	root.Collector().Describe(ch)
+	close(ch)
+	var descs []string
+	for d := range ch {
+		descs = append(descs, d.String())
+	}
+	assert.ElementsMatch(t, []string{
+		`Desc{fqName: "test_counter", help: "Some help.", constLabels: {}, variableLabels: []}`,
+		`Desc{fqName: "test_gauge", help: "Other help.", constLabels: {service="users"}, variableLabels: [var]}`,
+	}, descs, "Unexpected descriptors.")
+}
+
+func TestCollectorConflicts(t *testing.T) {
+	newConflictingRegistry := func() *prometheus.Registry {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "test_counter",
+			Help: "Some help.",
+		}))
+		return registry
+	}
+	newVector := func(root *Root) {
+		vec, err := root.Scope().CounterVector(Spec{
+			Name:    "test_counter",
+			Help:    "Some help.",
+			VarTags: []string{"var"},
+		})
+		require.NoError(t, err, "Unexpected error constructing counter vector.")
+		vec.MustGet("var", "foo").Inc()
+	}
+
+	t.Run("before registration", func(t *testing.T) {
+		root := New()
+		newVector(root)
+		registry := newConflictingRegistry()
+		assert.Error(t, registry.Register(root.Collector()), "Expected an error registering conflicting metrics.")
+	})
+
+	t.Run("after registration", func(t *testing.T) {
+		root := New()
+		registry := newConflictingRegistry()
+		require.NoError(t, registry.Register(root.Collector()), "Failed to register root.")
+		newVector(root)
+		_, err := registry.Gather()
+		assert.Error(t, err, "Expected an error gathering conflicting metrics.")
+	})
+}
+
+func TestCollectorMetricsCreatedAfterRegistration(t *testing.T) {
+	root := New()
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(root.Collector()), "Failed to register root.")
+
+	vec, err := root.Scope().CounterVector(Spec{
+		Name:    "test_counter",
+		Help:    "Some help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	vec.MustGet("var", "foo").Inc()
+	g, err := root.Scope().Tagged(Tags{"service": "users"}).Gauge(Spec{
+		Name: "test_gauge",
+		Help: "Some help.",
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+	g.Store(2)
+
+	code, actual := scrape(t, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code from Prometheus scrape.")
+	assert.Equal(t, "# HELP test_counter Some help.\n"+
+		"# TYPE test_counter counter\n"+
+		"test_counter{var=\"foo\"} 1\n"+
+		"# HELP test_gauge Some help.\n"+
+		"# TYPE test_gauge gauge\n"+
+		"test_gauge{service=\"users\"} 2", actual, "Unexpected Prometheus text.")
+}
@@ -22,6 +22,7 @@ package metrics
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -44,29 +45,125 @@ type core struct {
 	ids        map[string]struct{}
 	metrics    []metric
 	gatherer   prometheus.Gatherer
+	external   prometheus.Gatherer // optional, user-supplied
+	clock      Clock
+	scrubber   scrubber
+
+	hooksMu sync.Mutex
+	hooks   []func()
 }
 
-func newCore() *core {
+func newCore(external prometheus.Gatherer, clock Clock, policy ScrubPolicy) *core {
 	c := &core{
 		dimsByName: make(map[string]string, _defaultCollectionSize),
 		ids:        make(map[string]struct{}, _defaultCollectionSize),
 		metrics:    make([]metric, 0, _defaultCollectionSize),
+		external:   external,
+		clock:      clock,
+		scrubber:   scrubber{policy: policy},
 	}
-	c.gatherer = prometheus.GathererFunc(func() ([]*promproto.MetricFamily, error) {
-		c.RLock()
-		protos := make([]*promproto.MetricFamily, 0, len(c.metrics))
-		for _, m := range c.metrics {
-			p := m.proto()
-			if p != nil && len(p.Metric) > 0 {
-				protos = append(protos, p)
-			}
-		}
-		c.RUnlock()
-		return protos, nil
-	})
+	c.gatherer = prometheus.GathererFunc(c.gather)
 	return c
 }
 
+func (c *core) gather() ([]*promproto.MetricFamily, error) {
+	return c.gatherMatching(nil /* filter */)
+}
+
+// gatherMatching gathers only the metrics that satisfy the supplied filter.
+// To avoid unnecessary work, it checks each metric's metadata before
+// calling proto.
+func (c *core) gatherMatching(f *filter) ([]*promproto.MetricFamily, error) {
+	c.refresh()
+	c.RLock()
+	protos := make([]*promproto.MetricFamily, 0, len(c.metrics))
+	for _, m := range c.metrics {
+		if !f.matchMetadata(m.describe()) {
+			continue
+		}
+		p := m.proto()
+		if p == nil {
+			continue
+		}
+		if p = f.filterMetrics(p); len(p.Metric) > 0 {
+			protos = append(protos, p)
+		}
+	}
+	c.RUnlock()
+
+	external, err := c.gatherExternal(f)
+	for _, family := range external {
+		if family = f.filterMetrics(family); len(family.Metric) > 0 {
+			protos = append(protos, family)
+		}
+	}
+	return protos, err
+}
+
+// gatherExternal gathers metrics from the user-supplied gatherers, skipping
+// any families whose names don't satisfy the filter. Families that collide
+// with the root's own metrics are omitted and reported as errors. Like the
+// Prometheus client's Gatherers, it returns as much data as possible along
+// with any errors.
+func (c *core) gatherExternal(f *filter) ([]*promproto.MetricFamily, error) {
+	if c.external == nil {
+		return nil, nil
+	}
+	var errs prometheus.MultiError
+	external, err := c.external.Gather()
+	if multi, ok := err.(prometheus.MultiError); ok {
+		errs = append(errs, multi...)
+	} else if err != nil {
+		errs = append(errs, err)
+	}
+	families := make([]*promproto.MetricFamily, 0, len(external))
+	c.RLock()
+	for _, family := range external {
+		if !f.matchName(family.GetName()) {
+			continue
+		}
+		if err := c.checkExternal(family); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		families = append(families, family)
+	}
+	c.RUnlock()
+	return families, errs.MaybeUnwrap()
+}
+
+// checkExternal applies the same uniqueness checks as register to a metric
+// family gathered from an external source. Since we can't tell constant and
+// variable tags apart, we treat them all as variable. The caller must hold
+// the read lock.
+func (c *core) checkExternal(f *promproto.MetricFamily) error {
+	name := f.GetName()
+	existing, ok := c.dimsByName[name]
+	if !ok {
+		// Fast path: the root doesn't have any metrics with this name.
+		return nil
+	}
+	for _, m := range f.Metric {
+		varNames := make([]string, 0, len(m.Label))
+		for _, pair := range m.Label {
+			varNames = append(varNames, pair.GetName())
+		}
+		sort.Strings(varNames)
+		if existing != makeDims(name, nil /* const names */, varNames) {
+			return fmt.Errorf("a metric with name %q and different tag "+
+				"names is already registered", name)
+		}
+	}
+	id := newDigester()
+	defer id.free()
+	id.add("", name) // no constant tags
+	if _, ok := c.ids[string(id.digest())]; ok {
+		return fmt.Errorf("a metric with name %q and the same constant "+
+			"tag names and values is already registered: %q", name, string(id.digest()))
+	}
+	return nil
+}
+
 func (c *core) register(m metric) error {
 	id := newDigester()
 	defer id.free()
@@ -93,7 +190,35 @@ func (c *core) register(m metric) error {
 	return nil
 }
 
+// all returns the metrics registered so far. Metrics are never unregistered,
+// so the returned slice is safe to read after releasing the lock.
+func (c *core) all() []metric {
+	c.RLock()
+	ms := c.metrics
+	c.RUnlock()
+	return ms
+}
+
+// addHook registers a function to run before each export.
+func (c *core) addHook(f func()) {
+	c.hooksMu.Lock()
+	c.hooks = append(c.hooks, f)
+	c.hooksMu.Unlock()
+}
+
+// refresh runs all the hooks registered with Scope.BeforeExport. Hooks may
+// register new metrics, so we must not hold the core's lock.
+func (c *core) refresh() {
+	c.hooksMu.Lock()
+	hooks := c.hooks
+	c.hooksMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
 func (c *core) snapshot() *RootSnapshot {
+	c.refresh()
 	c.RLock()
 	defer c.RUnlock()
 	s := &RootSnapshot{}
@@ -105,9 +230,13 @@ func (c *core) snapshot() *RootSnapshot {
 }
 
 func (c *core) push(target push.Target) {
+	c.refresh()
 	c.RLock()
 	for _, m := range c.metrics {
 		m.push(target)
 	}
 	c.RUnlock()
+	if f, ok := target.(push.Flusher); ok {
+		f.Flush()
+	}
 }
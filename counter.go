@@ -22,7 +22,6 @@ package metrics
 
 import (
 	"fmt"
-	"sort"
 
 	promproto "github.com/prometheus/client_model/go"
 	"go.uber.org/net/metrics/push"
@@ -32,16 +31,26 @@ import (
 // its exported methods are safe to use concurrently, and nil *Counters are
 // safe no-op implementations.
 type Counter struct {
-	val    value
-	pusher push.Counter
+	val     value
+	stripes *stripedCounts // nil unless this is a StripedCounter
+	resets  resetTotals
+	pusher  push.Counter
 }
 
 func newCounter(m metadata) *Counter {
-	return &Counter{val: newValue(m)}
+	c := &Counter{val: newValue(m)}
+	if m.Striped {
+		c.stripes = newStripedCounts(1)
+	}
+	return c
 }
 
 func newDynamicCounter(m metadata, variableTagPairs []string) metric {
-	return &Counter{val: newDynamicValue(m, variableTagPairs)}
+	c := &Counter{val: newDynamicValue(m, variableTagPairs)}
+	if m.Striped {
+		c.stripes = newStripedCounts(1)
+	}
+	return c
 }
 
 // Add increases the value of the counter and returns the new value. Since
@@ -70,15 +79,47 @@ func (c *Counter) Load() int64 {
 	if c == nil {
 		return 0
 	}
+	if c.stripes != nil {
+		return c.stripes.load(0)
+	}
 	return c.val.Load()
 }
 
+// Reset sets the counter's value to zero and returns its previous value.
+// Prometheus treats a counter that decreases as having been reset, and push
+// targets keep receiving a running total that includes the reset value, so
+// this is safe. Still, it should be rare: frequent resets make rates harder
+// to compute.
+func (c *Counter) Reset() int64 {
+	if c == nil {
+		return 0
+	}
+	var prev int64
+	c.resets.reset(1, func(int) int64 {
+		if c.stripes != nil {
+			prev = c.stripes.swap(0)
+		} else {
+			prev = c.val.Swap(0)
+		}
+		return prev
+	})
+	return prev
+}
+
+func (c *Counter) reset() {
+	c.Reset()
+}
+
 func (c *Counter) describe() metadata {
 	return c.val.meta
 }
 
 func (c *Counter) snapshot() Snapshot {
-	return c.val.snapshot()
+	s := c.val.snapshot()
+	if c.stripes != nil {
+		s.Value = c.Load()
+	}
+	return s
 }
 
 func (c *Counter) proto() *promproto.MetricFamily {
@@ -91,13 +132,28 @@ func (c *Counter) proto() *promproto.MetricFamily {
 }
 
 func (c *Counter) metric() *promproto.Metric {
-	n := float64(c.val.Load())
+	n := float64(c.Load())
 	return &promproto.Metric{
 		Label:   c.val.tagPairs,
 		Counter: &promproto.Counter{Value: &n},
 	}
 }
 
+func (c *Counter) text(w *textWriter) {
+	w.begin(c.val.meta, promproto.MetricType_COUNTER)
+	c.samples(w)
+}
+
+func (c *Counter) labels() string {
+	return c.val.labels
+}
+
+func (c *Counter) samples(w *textWriter) {
+	if w.accept(c.val.tagPairs) {
+		w.sample(w.valueSuffix(), c.val.labels, "", 0, float64(c.Load()))
+	}
+}
+
 func (c *Counter) push(target push.Target) {
 	if c.val.meta.DisablePush {
 		return
@@ -108,7 +164,13 @@ func (c *Counter) push(target push.Target) {
 			Tags: zip(c.val.tagPairs),
 		})
 	}
-	c.pusher.Set(c.Load())
+	// Push the total including reset values, so the target sees every
+	// increment.
+	c.resets.push(1, func(int) int64 {
+		return c.Load()
+	}, func(_ int, total int64) {
+		c.pusher.Set(total)
+	})
 }
 
 // A CounterVector is a collection of Counters that share a name and some
@@ -126,7 +188,6 @@ func newCounterVector(m metadata) *CounterVector {
 	return &CounterVector{vector{
 		meta:           m,
 		factory:        newDynamicCounter,
-		metrics:        make(map[string]uint32, _defaultCollectionSize),
 		metricsStorage: make([]metric, 0, _defaultCollectionSize),
 	}}
 }
@@ -135,7 +196,8 @@ func newCounterVector(m metadata) *CounterVector {
 // from the vector, creating one if necessary. The variable tags must be
 // supplied in the same order used when creating the vector.
 //
-// Get returns an error if the number or order of tags is incorrect.
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
 func (cv *CounterVector) Get(variableTagPairs ...string) (*Counter, error) {
 	if cv == nil {
 		return nil, nil
@@ -147,6 +209,39 @@ func (cv *CounterVector) Get(variableTagPairs ...string) (*Counter, error) {
 	return m.(*Counter), nil
 }
 
+// Lookup behaves like Get, but identifies the counter with a precomputed key.
+// It's the fastest way to retrieve an existing counter.
+//
+// Lookup returns an error if the key's tag names don't match the vector's.
+func (cv *CounterVector) Lookup(key VectorKey) (*Counter, error) {
+	if cv == nil {
+		return nil, nil
+	}
+	m, err := cv.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Counter), nil
+}
+
+// With fixes some of the vector's variable tags, returning a narrower vector
+// whose Get method takes only the remaining tags. The fixed tags must be
+// supplied in the same order used when creating the vector, but needn't be
+// contiguous.
+//
+// With returns an error if any tag isn't one of the vector's variable tags,
+// or if the root's ScrubPolicy rejects a tag value.
+func (cv *CounterVector) With(tagPairs ...string) (*CurriedCounterVector, error) {
+	if cv == nil {
+		return nil, nil
+	}
+	c, err := newCurry(cv.meta).with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedCounterVector{vec: cv, curry: c}, nil
+}
+
 // MustGet behaves exactly like Get, but panics on errors. If code using this
 // method is covered by unit tests, this is safe.
 func (cv *CounterVector) MustGet(variableTagPairs ...string) *Counter {
@@ -160,25 +255,117 @@ func (cv *CounterVector) MustGet(variableTagPairs ...string) *Counter {
 	return c
 }
 
+// Range calls f for each counter in the vector, sorted by tags, until f
+// returns false. The tags passed to f include the vector's constant tags.
+//
+// Range copies the vector's contents before calling f, so f may safely use
+// the vector. Counters created while Range is running aren't visited.
+func (cv *CounterVector) Range(f func(Tags, *Counter) bool) {
+	if cv == nil {
+		return
+	}
+	for _, c := range cv.children() {
+		m := c.(*Counter)
+		if !f(zip(m.val.tagPairs), m) {
+			return
+		}
+	}
+}
+
+// Reset drops all the counters in the vector. Counters retrieved before the
+// reset remain usable, but they're no longer exported.
+func (cv *CounterVector) Reset() {
+	if cv == nil {
+		return
+	}
+	cv.vector.reset()
+}
+
+func (cv *CounterVector) reset() {
+	cv.Reset()
+}
+
 func (cv *CounterVector) describe() metadata {
 	return cv.meta
 }
 
+func (cv *CounterVector) text(w *textWriter) {
+	w.begin(cv.meta, promproto.MetricType_COUNTER)
+	cv.vector.samples(w)
+}
+
 func (cv *CounterVector) proto() *promproto.MetricFamily {
 	mf := &promproto.MetricFamily{
 		Name: cv.meta.Name,
 		Help: cv.meta.Help,
 		Type: promproto.MetricType_COUNTER.Enum(),
 	}
-	cv.metricsMu.RLock()
-	protos := make([]*promproto.Metric, 0, len(cv.metrics))
-	for _, metric := range cv.metricsStorage {
-		protos = append(protos, metric.(*Counter).metric())
+	children := cv.children()
+	protos := make([]*promproto.Metric, 0, len(children))
+	for _, c := range children {
+		protos = append(protos, c.(*Counter).metric())
 	}
-	cv.metricsMu.RUnlock()
-	sort.Slice(protos, func(i, j int) bool {
-		return protos[i].String() < protos[j].String()
-	})
 	mf.Metric = protos
 	return mf
 }
+
+// A CurriedCounterVector is a CounterVector with some of its variable tags fixed.
+// It shares its counters with the original vector. All exported methods are
+// safe to use concurrently, and nil *CurriedCounterVectors are safe to use
+// and always return no-op counters.
+type CurriedCounterVector struct {
+	vec   *CounterVector
+	curry curry
+}
+
+// Get retrieves the counter with the supplied remaining variable tag names
+// and values, creating one if necessary. The tags must be supplied in the
+// same order used when creating the original vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (c *CurriedCounterVector) Get(variableTagPairs ...string) (*Counter, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.curry.validate(variableTagPairs); err != nil {
+		return nil, err
+	}
+	digester := newDigester()
+	if err := c.curry.digest(digester, variableTagPairs); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := c.vec.index.load(digester.digest())
+	if !ok {
+		m = c.vec.get(digester.digest(), c.curry.pairs(variableTagPairs))
+	}
+	digester.free()
+	return m.(*Counter), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (c *CurriedCounterVector) MustGet(variableTagPairs ...string) *Counter {
+	if c == nil {
+		return nil
+	}
+	m, err := c.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get counter: %v", err))
+	}
+	return m
+}
+
+// With fixes more of the vector's variable tags, returning an even narrower
+// vector.
+func (c *CurriedCounterVector) With(tagPairs ...string) (*CurriedCounterVector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	next, err := c.curry.with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedCounterVector{vec: c.vec, curry: next}, nil
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A curry fixes some of a vector's variable tags. Fixed tag values are
+// scrubbed once, up front, so that lookups only need to scrub the remaining
+// values.
+type curry struct {
+	meta      metadata
+	names     []string // all of the vector's variable tag names, in order
+	fixed     []string // scrubbed fixed values, indexed like names
+	raw       []string // unscrubbed fixed values, indexed like names
+	isFixed   []bool
+	remaining []string // names of the tags that aren't fixed, in order
+}
+
+// newCurry creates a curry with no fixed tags.
+func newCurry(m metadata) curry {
+	return curry{
+		meta:      m,
+		names:     m.varTagNames,
+		fixed:     make([]string, len(m.varTagNames)),
+		raw:       make([]string, len(m.varTagNames)),
+		isFixed:   make([]bool, len(m.varTagNames)),
+		remaining: m.varTagNames,
+	}
+}
+
+// with fixes additional tags, returning a new curry. The tags must be a
+// subset of the remaining tags, in the same order.
+func (c curry) with(tagPairs []string) (curry, error) {
+	if len(tagPairs)%2 != 0 {
+		return curry{}, errors.New("tags must be supplied as name-value pairs")
+	}
+	next := curry{
+		meta:      c.meta,
+		names:     c.names,
+		fixed:     append([]string(nil), c.fixed...),
+		raw:       append([]string(nil), c.raw...),
+		isFixed:   append([]bool(nil), c.isFixed...),
+		remaining: make([]string, 0, len(c.remaining)),
+	}
+	j := 0 // index into tagPairs
+	for i, name := range c.names {
+		if c.isFixed[i] {
+			continue
+		}
+		if j < len(tagPairs) && tagPairs[j] == name {
+			scrubbed, err := c.meta.scrubTagValue(tagPairs[j+1])
+			if err != nil {
+				return curry{}, err
+			}
+			next.fixed[i] = scrubbed
+			next.raw[i] = tagPairs[j+1]
+			next.isFixed[i] = true
+			j += 2
+			continue
+		}
+		next.remaining = append(next.remaining, name)
+	}
+	if j < len(tagPairs) {
+		return curry{}, fmt.Errorf(
+			"can't fix tag %s: tags must be unfixed variable tags, in the order used when creating the vector",
+			tagPairs[j],
+		)
+	}
+	return next, nil
+}
+
+// validate checks that the user-supplied tags match the remaining tags.
+func (c curry) validate(variableTagPairs []string) error {
+	if len(variableTagPairs) != 2*len(c.remaining) {
+		return errInconsistentCardinality
+	}
+	for i, expected := range c.remaining {
+		if expected != variableTagPairs[i*2] {
+			return fmt.Errorf(
+				"variable tag #%d doesn't match curried vector: expected %s, got %s",
+				i,
+				expected,
+				variableTagPairs[i*2],
+			)
+		}
+	}
+	return nil
+}
+
+// digest adds the full set of tag values to the digester, in the same format
+// vectors use for their map keys. It returns an error if the scrub policy
+// rejects a value.
+func (c curry) digest(d *digester, variableTagPairs []string) error {
+	j := 1 // index of the next remaining value in variableTagPairs
+	for i := range c.names {
+		if c.isFixed[i] {
+			d.add("", c.fixed[i])
+			continue
+		}
+		val, err := c.meta.scrubTagValue(variableTagPairs[j])
+		if err != nil {
+			return err
+		}
+		d.add("", val)
+		j += 2
+	}
+	return nil
+}
+
+// pairs merges the fixed and remaining tags into a complete list of variable
+// tag pairs. It's only needed when creating a new metric.
+func (c curry) pairs(variableTagPairs []string) []string {
+	pairs := make([]string, 0, 2*len(c.names))
+	j := 1
+	for i, name := range c.names {
+		if c.isFixed[i] {
+			pairs = append(pairs, name, c.raw[i])
+			continue
+		}
+		pairs = append(pairs, name, variableTagPairs[j])
+		j += 2
+	}
+	return pairs
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCurrySpec(name string) Spec {
+	return Spec{
+		Name:    name,
+		Help:    "Some help.",
+		VarTags: []string{"service", "procedure", "outcome"},
+	}
+}
+
+func TestCurriedCounterVector(t *testing.T) {
+	cv, err := New().Scope().CounterVector(newCurrySpec("test"))
+	require.NoError(t, err, "Unexpected error constructing vector.")
+
+	t.Run("prefix", func(t *testing.T) {
+		curried, err := cv.With("service", "users", "procedure", "get")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		c, err := curried.Get("outcome", "success")
+		require.NoError(t, err, "Unexpected error getting counter.")
+		assert.True(t, c == cv.MustGet("service", "users", "procedure", "get", "outcome", "success"),
+			"Expected curried and original vectors to share counters.")
+	})
+
+	t.Run("non-contiguous", func(t *testing.T) {
+		curried, err := cv.With("service", "users", "outcome", "error")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		assert.True(t, curried.MustGet("procedure", "get") == cv.MustGet("service", "users", "procedure", "get", "outcome", "error"),
+			"Expected curried and original vectors to share counters.")
+	})
+
+	t.Run("chained", func(t *testing.T) {
+		curried, err := cv.With("procedure", "get")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		curried, err = curried.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying curried vector.")
+		assert.True(t, curried.MustGet("outcome", "success") == cv.MustGet("service", "users", "procedure", "get", "outcome", "success"),
+			"Expected chained curried vectors to share counters.")
+
+		all, err := curried.With("outcome", "success")
+		require.NoError(t, err, "Unexpected error fixing all tags.")
+		assert.True(t, all.MustGet() == curried.MustGet("outcome", "success"),
+			"Expected fully-curried vector to return the same counter.")
+	})
+
+	t.Run("scrubbing", func(t *testing.T) {
+		curried, err := cv.With("service", "user service")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		c := curried.MustGet("procedure", "get all", "outcome", "success")
+		assert.True(t, c == cv.MustGet("service", "user_service", "procedure", "get_all", "outcome", "success"),
+			"Expected curried vectors to scrub tags like the original vector.")
+		assert.Equal(t, Tags{"service": "user_service", "procedure": "get_all", "outcome": "success"}, c.snapshot().Tags,
+			"Unexpected tags.")
+	})
+
+	t.Run("invalid With", func(t *testing.T) {
+		for _, tags := range [][]string{
+			{"service"},
+			{"region", "us-west"},
+			{"procedure", "get", "service", "users"},
+			{"service", "users", "service", "groups"},
+		} {
+			_, err := cv.With(tags...)
+			assert.Error(t, err, "Expected an error currying vector with tags %v.", tags)
+		}
+
+		curried, err := cv.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		_, err = curried.With("service", "groups")
+		assert.Error(t, err, "Expected an error fixing the same tag twice.")
+	})
+
+	t.Run("invalid Get", func(t *testing.T) {
+		curried, err := cv.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		for _, tags := range [][]string{
+			{"procedure", "get"},
+			{"outcome", "success", "procedure", "get"},
+			{"service", "users", "procedure", "get", "outcome", "success"},
+		} {
+			_, err := curried.Get(tags...)
+			assert.Error(t, err, "Expected an error getting counter with tags %v.", tags)
+		}
+		assert.Panics(t, func() { curried.MustGet("procedure", "get") }, "Expected MustGet to panic on invalid tags.")
+	})
+
+	t.Run("allocations", func(t *testing.T) {
+		curried, err := cv.With("service", "users", "procedure", "get")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		curried.MustGet("outcome", "success")
+		for i := 0; i < 100; i++ {
+			curried.MustGet("outcome", "success") // publish the new counter
+		}
+		assertNoAllocs(t, func() {
+			curried.MustGet("outcome", "success").Inc()
+		}, "Expected curried Get to be allocation-free for existing counters.")
+	})
+}
+
+func TestCurriedVectorTypes(t *testing.T) {
+	scope := New().Scope()
+	full := []string{"service", "users", "procedure", "get", "outcome", "success"}
+
+	t.Run("gauge", func(t *testing.T) {
+		gv, err := scope.GaugeVector(newCurrySpec("test_gauge"))
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		curried, err := gv.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		assert.True(t, curried.MustGet("procedure", "get", "outcome", "success") == gv.MustGet(full...),
+			"Expected curried and original vectors to share gauges.")
+		_, err = curried.With("region", "us-west")
+		assert.Error(t, err, "Expected an error fixing an unknown tag.")
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		hv, err := scope.HistogramVector(HistogramSpec{
+			Spec:    newCurrySpec("test_histogram"),
+			Unit:    time.Millisecond,
+			Buckets: []int64{10},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		curried, err := hv.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		assert.True(t, curried.MustGet("procedure", "get", "outcome", "success") == hv.MustGet(full...),
+			"Expected curried and original vectors to share histograms.")
+		_, err = curried.With("region", "us-west")
+		assert.Error(t, err, "Expected an error fixing an unknown tag.")
+	})
+
+	t.Run("float histogram", func(t *testing.T) {
+		hv, err := scope.FloatHistogramVector(FloatHistogramSpec{
+			Spec:    newCurrySpec("test_float_histogram"),
+			Buckets: []float64{0.5},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		curried, err := hv.With("service", "users")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		assert.True(t, curried.MustGet("procedure", "get", "outcome", "success") == hv.MustGet(full...),
+			"Expected curried and original vectors to share histograms.")
+		_, err = curried.With("region", "us-west")
+		assert.Error(t, err, "Expected an error fixing an unknown tag.")
+	})
+}
+
+func BenchmarkCurriedVector(b *testing.B) {
+	cv, err := New().Scope().CounterVector(newCurrySpec("test"))
+	require.NoError(b, err, "Unexpected error constructing vector.")
+	curried, err := cv.With("service", "users", "procedure", "get")
+	require.NoError(b, err, "Unexpected error currying vector.")
+	curried.MustGet("outcome", "success")
+
+	b.Run("get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			runtime.KeepAlive(cv.MustGet("service", "users", "procedure", "get", "outcome", "success"))
+		}
+	})
+
+	b.Run("curried get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			runtime.KeepAlive(curried.MustGet("outcome", "success"))
+		}
+	})
+}
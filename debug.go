@@ -0,0 +1,302 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+
+	promproto "github.com/prometheus/client_model/go"
+)
+
+// Quantiles estimated for each histogram on the debug page.
+var _debugQuantiles = []float64{0.5, 0.9, 0.99}
+
+type debugPage struct {
+	Errors    []string
+	Quantiles []string
+	Families  []debugFamily
+}
+
+type debugFamily struct {
+	Name     string
+	Help     string
+	Type     string
+	TagNames []string
+	Series   []debugSeries
+}
+
+type debugSeries struct {
+	Tags      []string // aligned with the family's TagNames
+	Value     string
+	Histogram *debugHistogram
+}
+
+type debugHistogram struct {
+	Count     uint64
+	Sum       string
+	Quantiles []debugQuantile
+	Buckets   []debugBucket
+}
+
+type debugQuantile struct {
+	Text string
+	Sort string // understood by JavaScript's parseFloat
+}
+
+type debugBucket struct {
+	Upper   string
+	Count   uint64
+	Percent float64 // bar width, relative to the fullest bucket
+}
+
+// DebugHandler returns an http.Handler that renders all the root's metrics,
+// including those merged in using WithGatherers or WithCollectors, as a
+// human-readable HTML page. Each metric's help text is displayed along with
+// a sortable table of its tags and values; histograms also include bar
+// charts of their buckets and estimated percentiles.
+//
+// The page is built from the same data as ServeHTTP, so it's no cheaper to
+// render. It's meant for interactive debugging, not for automated scrapers.
+func (r *Root) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		families, err := r.core.gatherer.Gather()
+		page := newDebugPage(families)
+		if err != nil {
+			page.Errors = []string{err.Error()}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := _debugTemplate.Execute(w, page); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func newDebugPage(families []*promproto.MetricFamily) *debugPage {
+	page := &debugPage{
+		Quantiles: make([]string, len(_debugQuantiles)),
+		Families:  make([]debugFamily, 0, len(families)),
+	}
+	for i, q := range _debugQuantiles {
+		page.Quantiles[i] = "p" + formatFloat(q*100)
+	}
+	for _, f := range families {
+		page.Families = append(page.Families, newDebugFamily(f))
+	}
+	return page
+}
+
+func newDebugFamily(f *promproto.MetricFamily) debugFamily {
+	df := debugFamily{
+		Name:   f.GetName(),
+		Help:   f.GetHelp(),
+		Type:   debugType(f.GetType()),
+		Series: make([]debugSeries, 0, len(f.Metric)),
+	}
+	// Metrics in a family should all have the same tag names, but external
+	// gatherers may not enforce that. Use the union, in order of appearance.
+	index := make(map[string]int)
+	for _, m := range f.Metric {
+		for _, pair := range m.Label {
+			if _, ok := index[pair.GetName()]; !ok {
+				index[pair.GetName()] = len(df.TagNames)
+				df.TagNames = append(df.TagNames, pair.GetName())
+			}
+		}
+	}
+	for _, m := range f.Metric {
+		s := debugSeries{Tags: make([]string, len(df.TagNames))}
+		for _, pair := range m.Label {
+			s.Tags[index[pair.GetName()]] = pair.GetValue()
+		}
+		switch {
+		case m.Counter != nil:
+			s.Value = formatFloat(m.Counter.GetValue())
+		case m.Gauge != nil:
+			s.Value = formatFloat(m.Gauge.GetValue())
+		case m.Untyped != nil:
+			s.Value = formatFloat(m.Untyped.GetValue())
+		case m.Summary != nil:
+			s.Value = "count " + strconv.FormatUint(m.Summary.GetSampleCount(), 10) +
+				", sum " + formatFloat(m.Summary.GetSampleSum())
+		case m.Histogram != nil:
+			s.Histogram = newDebugHistogram(m.Histogram)
+		}
+		df.Series = append(df.Series, s)
+	}
+	return df
+}
+
+func newDebugHistogram(h *promproto.Histogram) *debugHistogram {
+	dh := &debugHistogram{
+		Count:     h.GetSampleCount(),
+		Sum:       formatFloat(h.GetSampleSum()),
+		Quantiles: make([]debugQuantile, len(_debugQuantiles)),
+		Buckets:   make([]debugBucket, 0, len(h.Bucket)+1),
+	}
+
+	// Prometheus buckets are cumulative and usually omit the final catch-all
+	// bucket, so convert to per-bucket counts and add it back.
+	var prev uint64
+	lastUpper := math.Inf(-1)
+	for _, b := range h.Bucket {
+		dh.Buckets = append(dh.Buckets, debugBucket{
+			Upper: formatFloat(b.GetUpperBound()),
+			Count: b.GetCumulativeCount() - prev,
+		})
+		prev = b.GetCumulativeCount()
+		lastUpper = b.GetUpperBound()
+	}
+	if !math.IsInf(lastUpper, 1) {
+		dh.Buckets = append(dh.Buckets, debugBucket{
+			Upper: "+Inf",
+			Count: h.GetSampleCount() - prev,
+		})
+	}
+	var max uint64
+	for _, b := range dh.Buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	if max > 0 {
+		for i := range dh.Buckets {
+			dh.Buckets[i].Percent = 100 * float64(dh.Buckets[i].Count) / float64(max)
+		}
+	}
+
+	for i, q := range _debugQuantiles {
+		v := estimateQuantile(q, h)
+		switch {
+		case math.IsNaN(v):
+			dh.Quantiles[i] = debugQuantile{Text: "-", Sort: "-Infinity"}
+		case math.IsInf(v, 1):
+			dh.Quantiles[i] = debugQuantile{Text: "> " + formatFloat(lastUpper), Sort: "Infinity"}
+		default:
+			dh.Quantiles[i] = debugQuantile{Text: formatFloat(v), Sort: formatFloat(v)}
+		}
+	}
+	return dh
+}
+
+// estimateQuantile estimates the qth quantile of a Prometheus histogram.
+// See quantile for details.
+func estimateQuantile(q float64, h *promproto.Histogram) float64 {
+	return quantile(q, h.GetSampleCount(), len(h.Bucket), func(i int) (float64, uint64) {
+		return h.Bucket[i].GetUpperBound(), h.Bucket[i].GetCumulativeCount()
+	})
+}
+
+func debugType(t promproto.MetricType) string {
+	switch t {
+	case promproto.MetricType_COUNTER:
+		return "counter"
+	case promproto.MetricType_GAUGE:
+		return "gauge"
+	case promproto.MetricType_HISTOGRAM:
+		return "histogram"
+	case promproto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var _debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Metrics</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+section { margin-bottom: 2em; }
+h2 { font-family: monospace; margin-bottom: 0.2em; }
+.type { font-size: small; font-weight: normal; color: #666; }
+.help { margin-top: 0; color: #333; }
+.error { color: #b00; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+th { background: #eee; cursor: pointer; user-select: none; }
+td.num { text-align: right; font-family: monospace; }
+.bars td { border: none; padding: 0 0.4em; }
+.bar { background: #4a90d9; height: 0.9em; min-width: 1px; }
+</style>
+</head>
+<body>
+<h1>Metrics</h1>
+{{range .Errors}}<p class="error">{{.}}</p>
+{{end}}
+<ul>
+{{range .Families}}<li><a href="#{{.Name}}">{{.Name}}</a></li>
+{{end}}</ul>
+{{$quantiles := .Quantiles}}
+{{range .Families}}<section id="{{.Name}}">
+<h2>{{.Name}} <span class="type">{{.Type}}</span></h2>
+<p class="help">{{.Help}}</p>
+<table class="sortable">
+<thead><tr>
+{{range .TagNames}}<th>{{.}}</th>{{end}}
+{{if eq .Type "histogram"}}<th>count</th><th>sum</th>{{range $quantiles}}<th>{{.}}</th>{{end}}<th>buckets</th>{{else}}<th>value</th>{{end}}
+</tr></thead>
+<tbody>
+{{range .Series}}<tr>
+{{range .Tags}}<td>{{.}}</td>{{end}}
+{{with .Histogram}}<td class="num">{{.Count}}</td><td class="num">{{.Sum}}</td>
+{{range .Quantiles}}<td class="num" data-sort="{{.Sort}}">{{.Text}}</td>{{end}}
+<td><details><summary>show</summary><table class="bars">
+{{range .Buckets}}<tr><td class="num">&le; {{.Upper}}</td><td class="num">{{.Count}}</td><td style="width: 20em"><div class="bar" style="width: {{printf "%.1f" .Percent}}%"></div></td></tr>
+{{end}}</table></details></td>
+{{else}}<td class="num">{{.Value}}</td>{{end}}
+</tr>
+{{end}}</tbody>
+</table>
+</section>
+{{end}}
+<script>
+document.querySelectorAll("table.sortable > thead th").forEach(function(th) {
+  th.addEventListener("click", function() {
+    var body = th.closest("table").tBodies[0];
+    var index = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var asc = th.dataset.order !== "asc";
+    th.dataset.order = asc ? "asc" : "desc";
+    var key = function(row) {
+      var cell = row.cells[index];
+      return cell.dataset.sort !== undefined ? cell.dataset.sort : cell.textContent;
+    };
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function(a, b) {
+      var x = key(a), y = key(b), nx = parseFloat(x), ny = parseFloat(y);
+      var c = !isNaN(nx) && !isNaN(ny) ? nx - ny : x.localeCompare(y);
+      return asc ? c : -c;
+    });
+    rows.forEach(function(row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,172 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promproto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	official := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "official_gauge",
+		Help: "Some help.",
+	})
+	official.Set(7)
+	registry.MustRegister(official)
+
+	root := New(WithGatherers(registry))
+	scope := root.Scope()
+
+	c, err := scope.Counter(Spec{
+		Name: "test_counter",
+		Help: "Counter <em>help</em>.",
+	})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Add(3)
+
+	vec, err := scope.HistogramVector(HistogramSpec{
+		Spec: Spec{
+			Name:    "test_latency_ms",
+			Help:    "Some help.",
+			VarTags: []string{"procedure"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50, 100},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+	h := vec.MustGet("procedure", "get")
+	h.IncBucket(5)
+	h.IncBucket(70)
+
+	rec := httptest.NewRecorder()
+	root.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Unexpected HTTP status code.")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"), "Unexpected content type.")
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<h2>test_counter <span class="type">counter</span></h2>`,
+		`<p class="help">Counter &lt;em&gt;help&lt;/em&gt;.</p>`,
+		`<td class="num">3</td>`,
+		`<h2>test_latency_ms <span class="type">histogram</span></h2>`,
+		`<th>procedure</th>`,
+		`<td>get</td>`,
+		`<th>p50</th><th>p90</th><th>p99</th>`,
+		`<td class="num" data-sort="10">10</td>`,
+		`<td class="num" data-sort="90">90</td>`,
+		`<div class="bar" style="width: 100.0%">`,
+		`<h2>official_gauge <span class="type">gauge</span></h2>`,
+		`<td class="num">7</td>`,
+	} {
+		assert.Contains(t, body, want, "Expected debug page to contain %q.", want)
+	}
+}
+
+func TestDebugHandlerErrors(t *testing.T) {
+	official := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "official_gauge",
+		Help: "Some help.",
+	})
+	root := New(WithCollectors(official, official))
+
+	rec := httptest.NewRecorder()
+	root.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Unexpected HTTP status code.")
+	assert.Contains(t, rec.Body.String(), `<p class="error">`, "Expected debug page to display gathering errors.")
+}
+
+func TestEstimateQuantile(t *testing.T) {
+	histogram := func(count uint64, bounds []float64, cumulative []uint64) *promproto.Histogram {
+		h := &promproto.Histogram{SampleCount: &count}
+		for i := range bounds {
+			h.Bucket = append(h.Bucket, &promproto.Bucket{
+				UpperBound:      &bounds[i],
+				CumulativeCount: &cumulative[i],
+			})
+		}
+		return h
+	}
+
+	tests := []struct {
+		desc string
+		q    float64
+		h    *promproto.Histogram
+		want float64
+	}{
+		{
+			desc: "empty",
+			q:    0.5,
+			h:    histogram(0, []float64{10}, []uint64{0}),
+			want: math.NaN(),
+		},
+		{
+			desc: "first bucket",
+			q:    0.5,
+			h:    histogram(4, []float64{10, 20}, []uint64{4, 4}),
+			want: 5,
+		},
+		{
+			desc: "interpolated",
+			q:    0.75,
+			h:    histogram(4, []float64{10, 20}, []uint64{2, 4}),
+			want: 15,
+		},
+		{
+			desc: "negative first bucket",
+			q:    0.5,
+			h:    histogram(2, []float64{-5, 20}, []uint64{2, 2}),
+			want: -5,
+		},
+		{
+			desc: "catch-all bucket",
+			q:    0.99,
+			h:    histogram(4, []float64{10, 20}, []uint64{2, 3}),
+			want: math.Inf(1),
+		},
+		{
+			desc: "explicit infinite bucket",
+			q:    0.99,
+			h:    histogram(4, []float64{10, math.Inf(1)}, []uint64{2, 4}),
+			want: math.Inf(1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got := estimateQuantile(tt.q, tt.h)
+			if math.IsNaN(tt.want) {
+				assert.True(t, math.IsNaN(got), "Expected NaN, got %v.", got)
+				return
+			}
+			assert.Equal(t, tt.want, got, "Unexpected quantile estimate.")
+		})
+	}
+}
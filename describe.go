@@ -0,0 +1,127 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// Type identifies the kind of a metric.
+type Type int
+
+// Supported metric types.
+const (
+	CounterType Type = iota + 1
+	GaugeType
+	HistogramType
+)
+
+// String returns the lowercase name of the type, like "counter".
+func (t Type) String() string {
+	switch t {
+	case CounterType:
+		return "counter"
+	case GaugeType:
+		return "gauge"
+	case HistogramType:
+		return "histogram"
+	default:
+		return "unknown"
+	}
+}
+
+// A Descriptor describes a registered metric. Names and tags are scrubbed,
+// so they match the exposed metrics rather than the original Spec.
+type Descriptor struct {
+	Name        string
+	Help        string
+	Type        Type
+	ConstTags   Tags
+	VarTags     []string // in the order used to create the vector
+	DisablePush bool
+
+	// Only set for histograms and histogram vectors.
+	Unit    time.Duration
+	Buckets []int64 // doesn't include the implicit catch-all bucket
+
+	// Only set for float histograms and float histogram vectors.
+	FloatBuckets []float64 // doesn't include the implicit catch-all bucket
+}
+
+func (d Descriptor) less(other Descriptor) bool {
+	if d.Name != other.Name {
+		return d.Name < other.Name
+	}
+	return d.ConstTags.less(other.ConstTags)
+}
+
+func newDescriptor(m metric) Descriptor {
+	meta := m.describe()
+	d := Descriptor{
+		Name:        *meta.Name,
+		Help:        *meta.Help,
+		ConstTags:   zip(meta.constTagPairs),
+		DisablePush: meta.DisablePush,
+	}
+	if len(meta.varTagNames) > 0 {
+		d.VarTags = make([]string, len(meta.varTagNames))
+		for i := range meta.varTagNames {
+			d.VarTags[i] = meta.varTagName(i)
+		}
+	}
+	switch v := m.(type) {
+	case *Counter, *CounterVector:
+		d.Type = CounterType
+	case *Gauge, *GaugeVector:
+		d.Type = GaugeType
+	case *Histogram:
+		d.Type = HistogramType
+		d.Unit = v.unit
+		d.Buckets = append([]int64(nil), v.bounds...)
+	case *HistogramVector:
+		d.Type = HistogramType
+		d.Unit = v.unit
+		d.Buckets = append([]int64(nil), v.bounds...)
+	case *FloatHistogram:
+		d.Type = HistogramType
+		d.FloatBuckets = append([]float64(nil), v.bounds...)
+	case *FloatHistogramVector:
+		d.Type = HistogramType
+		d.FloatBuckets = append([]float64(nil), v.bounds...)
+	}
+	return d
+}
+
+func (c *core) describeAll() []Descriptor {
+	metrics := c.all()
+	descs := make([]Descriptor, 0, len(metrics))
+	for _, m := range metrics {
+		if m.describe().internal {
+			continue
+		}
+		descs = append(descs, newDescriptor(m))
+	}
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].less(descs[j])
+	})
+	return descs
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "go.uber.org/net/metrics"
+)
+
+func TestDescribe(t *testing.T) {
+	root := New()
+	assert.Empty(t, root.Describe(), "Expected no descriptors for an empty root.")
+
+	scope := root.Scope().Tagged(Tags{"service": "users"})
+	_, err := scope.Gauge(Spec{
+		Name:        "test_gauge",
+		Help:        "Gauge help.",
+		ConstTags:   Tags{"foo!": "bar!"},
+		DisablePush: true,
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+
+	cv, err := scope.CounterVector(Spec{
+		Name:    "test-counter",
+		Help:    "Counter help.",
+		VarTags: []string{"zone", "dc!"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	cv.MustGet("zone", "z1", "dc!", "dca").Inc()
+
+	buckets := []int64{10, 50, 100}
+	_, err = scope.HistogramVector(HistogramSpec{
+		Spec: Spec{
+			Name:    "test_latency_ms",
+			Help:    "Histogram help.",
+			VarTags: []string{"procedure"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: buckets,
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+	buckets[0] = 5 // shouldn't affect descriptor
+
+	descs := root.Describe()
+	assert.Equal(t, []Descriptor{
+		{
+			Name:      "test_counter",
+			Help:      "Counter help.",
+			Type:      CounterType,
+			ConstTags: Tags{"service": "users"},
+			VarTags:   []string{"zone", "dc_"},
+		},
+		{
+			Name:        "test_gauge",
+			Help:        "Gauge help.",
+			Type:        GaugeType,
+			ConstTags:   Tags{"foo_": "bar_", "service": "users"},
+			DisablePush: true,
+		},
+		{
+			Name:      "test_latency_ms",
+			Help:      "Histogram help.",
+			Type:      HistogramType,
+			ConstTags: Tags{"service": "users"},
+			VarTags:   []string{"procedure"},
+			Unit:      time.Millisecond,
+			Buckets:   []int64{10, 50, 100},
+		},
+	}, descs, "Unexpected descriptors.")
+
+	descs[2].Buckets[0] = 1
+	assert.Equal(t, []int64{10, 50, 100}, root.Describe()[2].Buckets, "Expected descriptors to be copies.")
+}
+
+func TestTypeString(t *testing.T) {
+	assert.Equal(t, "counter", CounterType.String(), "Unexpected string for counters.")
+	assert.Equal(t, "gauge", GaugeType.String(), "Unexpected string for gauges.")
+	assert.Equal(t, "histogram", HistogramType.String(), "Unexpected string for histograms.")
+	assert.Equal(t, "unknown", Type(0).String(), "Unexpected string for unknown types.")
+}
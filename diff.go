@@ -0,0 +1,329 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// A Change describes how a metric differs between two snapshots.
+type Change int
+
+// Kinds of changes.
+const (
+	Added Change = iota + 1
+	Removed
+	Changed
+)
+
+// String returns the lowercase name of the change, like "added".
+func (c Change) String() string {
+	switch c {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// A SnapshotDiff lists the metrics that differ between two snapshots.
+// Metrics that didn't change are omitted. Like RootSnapshot, each slice is
+// sorted by name and tags.
+type SnapshotDiff struct {
+	Counters   []Delta
+	Gauges     []Delta
+	Histograms []HistogramDelta
+
+	FloatHistograms []FloatHistogramDelta
+}
+
+// A Delta describes how a counter or gauge changed. Added metrics have a
+// zero Before value, and removed metrics have a zero After value.
+type Delta struct {
+	Name   string
+	Tags   Tags
+	Change Change
+	Before int64
+	After  int64
+}
+
+// Value returns the difference between the before and after values.
+func (d Delta) Value() int64 {
+	return d.After - d.Before
+}
+
+// A HistogramDelta describes how a histogram changed.
+type HistogramDelta struct {
+	Name    string
+	Tags    Tags
+	Unit    time.Duration
+	Change  Change
+	Count   int64         // change in the number of observations
+	Sum     int64         // change in the sum of observations
+	Buckets []BucketDelta // only buckets whose counts changed, in order
+}
+
+// A BucketDelta describes the change in a single histogram bucket's count.
+type BucketDelta struct {
+	Upper int64 // inclusive upper bound
+	Count int64
+}
+
+// A FloatHistogramDelta describes how a float histogram changed.
+type FloatHistogramDelta struct {
+	Name    string
+	Tags    Tags
+	Change  Change
+	Count   int64              // change in the number of observations
+	Sum     float64            // change in the sum of observations
+	Buckets []FloatBucketDelta // only buckets whose counts changed, in order
+}
+
+// A FloatBucketDelta describes the change in a single float histogram
+// bucket's count.
+type FloatBucketDelta struct {
+	Upper float64 // inclusive upper bound
+	Count int64
+}
+
+// Diff compares the receiver to a later snapshot, typically to check the
+// metrics emitted by the code under test:
+//
+//	before := root.Snapshot()
+//	handleRequest()
+//	diff := before.Diff(root.Snapshot())
+//	assert.Equal(t, int64(1), diff.Delta("requests", metrics.Tags{"service": "users"}))
+func (s *RootSnapshot) Diff(later *RootSnapshot) *SnapshotDiff {
+	return &SnapshotDiff{
+		Counters:   diffValues(s.Counters, later.Counters),
+		Gauges:     diffValues(s.Gauges, later.Gauges),
+		Histograms: diffHistograms(s.Histograms, later.Histograms),
+
+		FloatHistograms: diffFloatHistograms(s.FloatHistograms, later.FloatHistograms),
+	}
+}
+
+// Empty reports whether the two snapshots were identical.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Counters) == 0 && len(d.Gauges) == 0 && len(d.Histograms) == 0 &&
+		len(d.FloatHistograms) == 0
+}
+
+// Delta returns the change in the counter or gauge with the supplied name and
+// tags. Tags must match exactly, including any constant tags added by
+// scopes. If the metric didn't change (or doesn't exist), Delta returns zero.
+func (d *SnapshotDiff) Delta(name string, tags Tags) int64 {
+	for _, deltas := range [][]Delta{d.Counters, d.Gauges} {
+		for _, delta := range deltas {
+			if delta.Name == name && delta.Tags.equal(tags) {
+				return delta.Value()
+			}
+		}
+	}
+	return 0
+}
+
+// HistogramDelta returns the change in the histogram with the supplied name
+// and tags. Tags must match exactly, including any constant tags added by
+// scopes. If the histogram didn't change (or doesn't exist), the returned
+// delta is empty and the boolean is false.
+func (d *SnapshotDiff) HistogramDelta(name string, tags Tags) (HistogramDelta, bool) {
+	for _, delta := range d.Histograms {
+		if delta.Name == name && delta.Tags.equal(tags) {
+			return delta, true
+		}
+	}
+	return HistogramDelta{}, false
+}
+
+// FloatHistogramDelta behaves like HistogramDelta, but looks up float
+// histograms.
+func (d *SnapshotDiff) FloatHistogramDelta(name string, tags Tags) (FloatHistogramDelta, bool) {
+	for _, delta := range d.FloatHistograms {
+		if delta.Name == name && delta.Tags.equal(tags) {
+			return delta, true
+		}
+	}
+	return FloatHistogramDelta{}, false
+}
+
+// seriesLess orders metrics in the same way as RootSnapshot.
+func seriesLess(leftName string, leftTags Tags, rightName string, rightTags Tags) bool {
+	if leftName != rightName {
+		return leftName < rightName
+	}
+	return leftTags.less(rightTags)
+}
+
+func snapshotKey(name string, tags Tags) string {
+	d := newDigester()
+	d.add("", name)
+	tags.addToDigester(d)
+	key := string(d.digest())
+	d.free()
+	return key
+}
+
+func diffValues(before, after []Snapshot) []Delta {
+	prev := make(map[string]Snapshot, len(before))
+	for _, s := range before {
+		prev[snapshotKey(s.Name, s.Tags)] = s
+	}
+	var deltas []Delta
+	for _, s := range after {
+		key := snapshotKey(s.Name, s.Tags)
+		old, ok := prev[key]
+		delete(prev, key)
+		switch {
+		case !ok:
+			deltas = append(deltas, Delta{Name: s.Name, Tags: s.Tags, Change: Added, After: s.Value})
+		case old.Value != s.Value:
+			deltas = append(deltas, Delta{Name: s.Name, Tags: s.Tags, Change: Changed, Before: old.Value, After: s.Value})
+		}
+	}
+	for _, s := range prev {
+		deltas = append(deltas, Delta{Name: s.Name, Tags: s.Tags, Change: Removed, Before: s.Value})
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return seriesLess(deltas[i].Name, deltas[i].Tags, deltas[j].Name, deltas[j].Tags)
+	})
+	return deltas
+}
+
+func diffHistograms(before, after []HistogramSnapshot) []HistogramDelta {
+	prev := make(map[string]HistogramSnapshot, len(before))
+	for _, h := range before {
+		prev[snapshotKey(h.Name, h.Tags)] = h
+	}
+	var deltas []HistogramDelta
+	for _, h := range after {
+		key := snapshotKey(h.Name, h.Tags)
+		old, ok := prev[key]
+		delete(prev, key)
+		if !ok {
+			delta := diffHistogram(HistogramSnapshot{}, h)
+			delta.Change = Added
+			deltas = append(deltas, delta)
+			continue
+		}
+		if delta := diffHistogram(old, h); delta.Sum != 0 || len(delta.Buckets) > 0 {
+			delta.Change = Changed
+			deltas = append(deltas, delta)
+		}
+	}
+	for _, h := range prev {
+		delta := diffHistogram(h, HistogramSnapshot{Name: h.Name, Tags: h.Tags, Unit: h.Unit})
+		delta.Change = Removed
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return seriesLess(deltas[i].Name, deltas[i].Tags, deltas[j].Name, deltas[j].Tags)
+	})
+	return deltas
+}
+
+func diffHistogram(before, after HistogramSnapshot) HistogramDelta {
+	counts := make(map[int64]int64, len(after.Buckets))
+	for _, b := range after.Buckets {
+		counts[b.Upper] += b.Count
+	}
+	for _, b := range before.Buckets {
+		counts[b.Upper] -= b.Count
+	}
+	delta := HistogramDelta{
+		Name:  after.Name,
+		Tags:  after.Tags,
+		Unit:  after.Unit,
+		Count: after.Count - before.Count,
+		Sum:   after.Sum - before.Sum,
+	}
+	for upper, n := range counts {
+		if n != 0 {
+			delta.Buckets = append(delta.Buckets, BucketDelta{Upper: upper, Count: n})
+		}
+	}
+	sort.Slice(delta.Buckets, func(i, j int) bool {
+		return delta.Buckets[i].Upper < delta.Buckets[j].Upper
+	})
+	return delta
+}
+
+func diffFloatHistograms(before, after []FloatHistogramSnapshot) []FloatHistogramDelta {
+	prev := make(map[string]FloatHistogramSnapshot, len(before))
+	for _, h := range before {
+		prev[snapshotKey(h.Name, h.Tags)] = h
+	}
+	var deltas []FloatHistogramDelta
+	for _, h := range after {
+		key := snapshotKey(h.Name, h.Tags)
+		old, ok := prev[key]
+		delete(prev, key)
+		if !ok {
+			delta := diffFloatHistogram(FloatHistogramSnapshot{}, h)
+			delta.Change = Added
+			deltas = append(deltas, delta)
+			continue
+		}
+		if delta := diffFloatHistogram(old, h); delta.Sum != 0 || len(delta.Buckets) > 0 {
+			delta.Change = Changed
+			deltas = append(deltas, delta)
+		}
+	}
+	for _, h := range prev {
+		delta := diffFloatHistogram(h, FloatHistogramSnapshot{Name: h.Name, Tags: h.Tags})
+		delta.Change = Removed
+		deltas = append(deltas, delta)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return seriesLess(deltas[i].Name, deltas[i].Tags, deltas[j].Name, deltas[j].Tags)
+	})
+	return deltas
+}
+
+func diffFloatHistogram(before, after FloatHistogramSnapshot) FloatHistogramDelta {
+	counts := make(map[float64]int64, len(after.Buckets))
+	for _, b := range after.Buckets {
+		counts[b.Upper] += b.Count
+	}
+	for _, b := range before.Buckets {
+		counts[b.Upper] -= b.Count
+	}
+	delta := FloatHistogramDelta{
+		Name:  after.Name,
+		Tags:  after.Tags,
+		Count: after.Count - before.Count,
+		Sum:   after.Sum - before.Sum,
+	}
+	for upper, n := range counts {
+		if n != 0 {
+			delta.Buckets = append(delta.Buckets, FloatBucketDelta{Upper: upper, Count: n})
+		}
+	}
+	sort.Slice(delta.Buckets, func(i, j int) bool {
+		return delta.Buckets[i].Upper < delta.Buckets[j].Upper
+	})
+	return delta
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "go.uber.org/net/metrics"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	root := New()
+	scope := root.Scope().Tagged(Tags{"service": "users"})
+
+	unchanged, err := scope.Counter(Spec{Name: "test_unchanged", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	unchanged.Inc()
+	counters, err := scope.CounterVector(Spec{
+		Name:    "test_counter",
+		Help:    "Some help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	counters.MustGet("var", "x").Add(2)
+	gauge, err := scope.Gauge(Spec{Name: "test_gauge", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+	gauge.Store(10)
+	hist, err := scope.Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	hist.IncBucket(5)
+
+	before := root.Snapshot()
+	assert.True(t, before.Diff(root.Snapshot()).Empty(), "Expected no changes between identical snapshots.")
+
+	counters.MustGet("var", "x").Inc()
+	counters.MustGet("var", "y").Add(3)
+	gauge.Sub(4)
+	hist.IncBucket(5)
+	hist.IncBucket(20)
+	hist.IncBucket(100)
+	after := root.Snapshot()
+
+	diff := before.Diff(after)
+	assert.False(t, diff.Empty(), "Expected changes.")
+	assert.Equal(t, []Delta{
+		{
+			Name:   "test_counter",
+			Tags:   Tags{"service": "users", "var": "x"},
+			Change: Changed,
+			Before: 2,
+			After:  3,
+		},
+		{
+			Name:   "test_counter",
+			Tags:   Tags{"service": "users", "var": "y"},
+			Change: Added,
+			After:  3,
+		},
+	}, diff.Counters, "Unexpected counter deltas.")
+	assert.Equal(t, []Delta{{
+		Name:   "test_gauge",
+		Tags:   Tags{"service": "users"},
+		Change: Changed,
+		Before: 10,
+		After:  6,
+	}}, diff.Gauges, "Unexpected gauge deltas.")
+	assert.Equal(t, []HistogramDelta{{
+		Name:   "test_latency_ms",
+		Tags:   Tags{"service": "users"},
+		Unit:   time.Millisecond,
+		Change: Changed,
+		Count:  3,
+		Sum:    125,
+		Buckets: []BucketDelta{
+			{Upper: 10, Count: 1},
+			{Upper: 50, Count: 1},
+			{Upper: math.MaxInt64, Count: 1},
+		},
+	}}, diff.Histograms, "Unexpected histogram deltas.")
+
+	t.Run("helpers", func(t *testing.T) {
+		assert.Equal(t, int64(1), diff.Delta("test_counter", Tags{"service": "users", "var": "x"}), "Unexpected counter delta.")
+		assert.Equal(t, int64(3), diff.Delta("test_counter", Tags{"service": "users", "var": "y"}), "Unexpected counter delta.")
+		assert.Equal(t, int64(-4), diff.Delta("test_gauge", Tags{"service": "users"}), "Unexpected gauge delta.")
+		assert.Equal(t, int64(0), diff.Delta("test_unchanged", Tags{"service": "users"}), "Unexpected delta for unchanged counter.")
+		assert.Equal(t, int64(0), diff.Delta("test_gauge", Tags{}), "Expected tags to match exactly.")
+
+		h, ok := diff.HistogramDelta("test_latency_ms", Tags{"service": "users"})
+		assert.True(t, ok, "Expected to find histogram delta.")
+		assert.Equal(t, int64(3), h.Count, "Unexpected change in histogram count.")
+		_, ok = diff.HistogramDelta("test_latency_ms", nil)
+		assert.False(t, ok, "Expected tags to match exactly.")
+	})
+
+	t.Run("reversed", func(t *testing.T) {
+		diff := after.Diff(before)
+		assert.Equal(t, Removed, diff.Counters[1].Change, "Expected counter to be removed.")
+		assert.Equal(t, int64(-3), diff.Counters[1].Value(), "Unexpected removed counter delta.")
+		assert.Equal(t, int64(-3), diff.Histograms[0].Count, "Unexpected change in histogram count.")
+		assert.Equal(t, int64(-125), diff.Histograms[0].Sum, "Unexpected change in histogram sum.")
+	})
+
+	t.Run("histogram added and removed", func(t *testing.T) {
+		empty := &RootSnapshot{}
+		added := empty.Diff(after).Histograms
+		require.Equal(t, 1, len(added), "Unexpected number of histogram deltas.")
+		assert.Equal(t, Added, added[0].Change, "Expected histogram to be added.")
+		assert.Equal(t, int64(4), added[0].Count, "Unexpected change in histogram count.")
+
+		removed := after.Diff(empty).Histograms
+		require.Equal(t, 1, len(removed), "Unexpected number of histogram deltas.")
+		assert.Equal(t, Removed, removed[0].Change, "Expected histogram to be removed.")
+		assert.Equal(t, "test_latency_ms", removed[0].Name, "Unexpected name for removed histogram.")
+		assert.Equal(t, time.Millisecond, removed[0].Unit, "Unexpected unit for removed histogram.")
+		assert.Equal(t, int64(-130), removed[0].Sum, "Unexpected change in histogram sum.")
+	})
+}
+
+func TestSnapshotDiffFloatHistograms(t *testing.T) {
+	root := New()
+	scope := root.Scope()
+	h, err := scope.FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+		Buckets: []float64{0.5, 1},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+	h.Observe(0.25)
+
+	before := root.Snapshot()
+	assert.True(t, before.Diff(root.Snapshot()).Empty(), "Expected no changes between identical snapshots.")
+
+	h.Observe(0.75)
+	h.Observe(2)
+	_, err = scope.FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_new_ratio", Help: "Some help."},
+		Buckets: []float64{0.5},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+
+	diff := before.Diff(root.Snapshot())
+	assert.False(t, diff.Empty(), "Expected changes.")
+	assert.Equal(t, []FloatHistogramDelta{
+		{Name: "test_new_ratio", Tags: Tags{}, Change: Added},
+		{
+			Name:   "test_ratio",
+			Tags:   Tags{},
+			Change: Changed,
+			Count:  2,
+			Sum:    2.75,
+			Buckets: []FloatBucketDelta{
+				{Upper: 1, Count: 1},
+				{Upper: math.Inf(1), Count: 1},
+			},
+		},
+	}, diff.FloatHistograms, "Unexpected float histogram deltas.")
+
+	delta, ok := diff.FloatHistogramDelta("test_ratio", Tags{})
+	assert.True(t, ok, "Expected to find float histogram delta.")
+	assert.Equal(t, int64(2), delta.Count, "Unexpected count delta.")
+	_, ok = diff.FloatHistogramDelta("test_ratio", Tags{"foo": "bar"})
+	assert.False(t, ok, "Expected no delta for unknown tags.")
+
+	removed := root.Snapshot().Diff(before)
+	deltas := removed.FloatHistograms
+	require.Equal(t, 2, len(deltas), "Unexpected number of deltas.")
+	assert.Equal(t, Removed, deltas[0].Change, "Expected new histogram to be removed.")
+	assert.Equal(t, int64(-2), deltas[1].Count, "Unexpected count delta.")
+}
+
+func TestChangeString(t *testing.T) {
+	assert.Equal(t, "added", Added.String(), "Unexpected string for additions.")
+	assert.Equal(t, "removed", Removed.String(), "Unexpected string for removals.")
+	assert.Equal(t, "changed", Changed.String(), "Unexpected string for changes.")
+	assert.Equal(t, "unknown", Change(0).String(), "Unexpected string for unknown changes.")
+}
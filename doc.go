@@ -23,7 +23,7 @@
 // with both push- and pull-based collection systems. Like Prometheus and
 // Tally, it supports metrics tagged with arbitrary key-value pairs.
 //
-// Metric Names and Uniqueness
+// # Metric Names and Uniqueness
 //
 // Like Prometheus, but unlike Tally, metric names should be relatively long and
 // descriptive - generally speaking, metrics from the same process shouldn't
@@ -33,7 +33,7 @@
 // and vague. Where relevant, metric names should indicate their unit of
 // measurement (e.g., "grpc_success_latency_ms").
 //
-// Counters and Gauges
+// # Counters and Gauges
 //
 // Counters represent monotonically increasing values, like a car's odometer.
 // Gauges represent point-in-time readings, like a car's speedometer. Both
@@ -42,7 +42,7 @@
 // into your business logic: you can use them anywhere you'd otherwise use a
 // 64-bit atomic integer.
 //
-// Histograms
+// # Histograms
 //
 // This package doesn't support analogs of Tally's timer or Prometheus's
 // summary, because they can't be accurately aggregated at query time.
@@ -51,7 +51,11 @@
 // flexible when queried. See https://prometheus.io/docs/practices/histograms/
 // for a more detailed discussion of the trade-offs involved.
 //
-// Vectors
+// Histograms are designed for latencies, so they record integral multiples
+// of a time.Duration unit. To record other distributions, like ratios or
+// scores, use a FloatHistogram.
+//
+// # Vectors
 //
 // Plain counters, gauges, and histograms have a fixed set of tags. However,
 // it's common to encounter situations where a subset of a metric's tags vary
@@ -67,7 +71,16 @@
 // name. Usage examples are included in the documentation for each vector
 // type.
 //
-// Push and Pull
+// When some variable tags are known well before the others, a vector's With
+// method fixes them up front and returns a curried vector, whose Get method
+// takes only the remaining tags.
+//
+// Vectors accept variable tags as a list of names and values, so mistakes in
+// their names or order are only caught at runtime. To have the compiler check
+// them instead, use a generic vector like CounterVec, whose tags are the
+// fields of a struct.
+//
+// # Push and Pull
 //
 // This package integrates with StatsD- and M3-based collection systems by
 // periodically pushing differential updates. (Users can integrate with other
@@ -77,10 +90,11 @@
 // of both push and pull integration are included in the documentation for the
 // root struct's Push and ServeHTTP methods.
 //
-// See Also
+// # See Also
 //
 // If you're unfamiliar with Tally and Prometheus, you may want to consult
 // their documentation:
-//   https://godoc.org/github.com/uber-go/tally
-//   https://godoc.org/github.com/prometheus/client_golang/prometheus
+//
+//	https://godoc.org/github.com/uber-go/tally
+//	https://godoc.org/github.com/prometheus/client_golang/prometheus
 package metrics // import "go.uber.org/net/metrics"
@@ -28,6 +28,7 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/uber-go/tally"
 	"go.uber.org/net/metrics"
 	"go.uber.org/net/metrics/tallypush"
@@ -124,6 +125,52 @@ func ExampleCounterVector() {
 	vec.MustGet("table" /* tag name */, "trips" /* tag value */).Inc()
 }
 
+func ExampleCounterVector_With() {
+	vec, err := metrics.New().Scope().CounterVector(metrics.Spec{
+		Name:    "requests_by_procedure",
+		Help:    "Number of requests by service, procedure, and outcome.",
+		VarTags: []string{"service", "procedure", "outcome"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Middleware often knows some tags up front. Fixing them once, when the
+	// middleware is constructed, makes each lookup cheaper.
+	requests, err := vec.With("service", "users", "procedure", "get")
+	if err != nil {
+		panic(err)
+	}
+	outcome := "success"
+	// Handle the request, setting outcome to "error" if it fails...
+	requests.MustGet("outcome", outcome).Inc()
+}
+
+func ExampleNewCounterVec() {
+	// Each string field is a variable tag. Since tags are supplied as a
+	// struct, the compiler catches misspelled or misordered tags.
+	type requestTags struct {
+		Service   string `metric:"service"`
+		Procedure string `metric:"procedure"`
+	}
+
+	vec, err := metrics.NewCounterVec[requestTags](metrics.New().Scope(), metrics.Spec{
+		Name: "requests_by_procedure",
+		Help: "Number of requests by service and procedure.",
+	})
+	if err != nil {
+		panic(err)
+	}
+	c, err := vec.Get(requestTags{Service: "users", Procedure: "get"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(c.Inc())
+
+	// Output:
+	// 1
+}
+
 func ExampleGauge() {
 	g, err := metrics.New().Scope().Gauge(metrics.Spec{
 		Name:      "selects_in_progress",                       // required
@@ -183,6 +230,26 @@ func ExampleHistogramVector() {
 	vec.MustGet("table" /* tag name */, "trips" /* tag value */).Observe(37 * time.Millisecond)
 }
 
+func ExampleHistogramVector_Start() {
+	vec, err := metrics.New().Scope().HistogramVector(metrics.HistogramSpec{
+		Spec: metrics.Spec{
+			Name:    "selects_latency_by_outcome_ms",
+			Help:    "SELECT query latency by outcome.",
+			VarTags: []string{"outcome"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{5, 10, 25, 50, 100, 200, 500},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	sw := vec.Start()
+	outcome := "success"
+	// Run the query, setting outcome to "error" if it fails...
+	sw.Stop("outcome", outcome) // tags are chosen after the operation completes
+}
+
 func ExampleRoot_ServeHTTP() {
 	// First, construct a root and add some metrics.
 	root := metrics.New()
@@ -222,6 +289,58 @@ func ExampleRoot_ServeHTTP() {
 	// example{host="example01"} 1
 }
 
+func ExampleRoot_Collector() {
+	root := metrics.New()
+	c, err := root.Scope().Counter(metrics.Spec{
+		Name: "example",
+		Help: "Counter demonstrating Prometheus client integration.",
+	})
+	if err != nil {
+		panic(err)
+	}
+	c.Inc()
+
+	// Register the root with a Prometheus registry, so that its metrics are
+	// exposed alongside any other collectors.
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(root.Collector())
+	families, err := registry.Gather()
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range families {
+		fmt.Println(f.GetName(), f.GetMetric()[0].GetCounter().GetValue())
+	}
+
+	// Output:
+	// example 1
+}
+
+func ExampleRoot_Describe() {
+	root := metrics.New()
+	_, err := root.Scope().HistogramVector(metrics.HistogramSpec{
+		Spec: metrics.Spec{
+			Name:    "selects_latency_by_table_ms",
+			Help:    "SELECT query latency by table.",
+			VarTags: []string{"table"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{5, 10, 25, 50, 100, 200, 500},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	// Descriptors don't include any metric values, so they're a convenient
+	// way to generate a catalog of the metrics exposed by a process.
+	for _, d := range root.Describe() {
+		fmt.Printf("%s (%v): %s Tags: %v. Unit: %v.\n", d.Name, d.Type, d.Help, d.VarTags, d.Unit)
+	}
+
+	// Output:
+	// selects_latency_by_table_ms (histogram): SELECT query latency by table. Tags: [table]. Unit: 1ms.
+}
+
 func ExampleRoot_Push() {
 	// First, we need something to push to. In this example, we'll use Tally's
 	// testing scope.
@@ -254,8 +373,8 @@ func ExampleRoot_Push() {
 }
 
 func ExampleRoot_Snapshot() {
-	// Snapshots are the simplest way to unit test your metrics. A future
-	// release will add a more full-featured metricstest package.
+	// Snapshots are the simplest way to unit test your metrics. For more
+	// convenient assertions, see the metricstest package.
 	root := metrics.New()
 	c, err := root.Scope().Counter(metrics.Spec{
 		Name:      "example",
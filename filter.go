@@ -0,0 +1,170 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	promproto "github.com/prometheus/client_model/go"
+)
+
+// Query parameters understood by Root.ServeHTTP.
+const (
+	_nameParam = "name[]"
+	_tagParam  = "tag[]"
+)
+
+// A filter restricts exposition to a subset of metrics. Names are
+// alternatives, so a metric must match any one of them; tag matchers are
+// requirements, so a metric must match all of them.
+type filter struct {
+	names map[string]struct{} // nil matches all names
+	tags  []tagMatcher
+}
+
+// A tagMatcher requires a tag to have a particular value. Like Prometheus
+// label matchers, a missing tag is equivalent to an empty value.
+type tagMatcher struct {
+	name, value string
+}
+
+// newFilter parses a filter from URL query parameters. If the query doesn't
+// restrict the exposed metrics, it returns nil.
+func newFilter(query url.Values) (*filter, error) {
+	names, tags := query[_nameParam], query[_tagParam]
+	if len(names) == 0 && len(tags) == 0 {
+		return nil, nil
+	}
+	f := &filter{}
+	if len(names) > 0 {
+		f.names = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			f.names[name] = struct{}{}
+		}
+	}
+	if len(tags) > 0 {
+		f.tags = make([]tagMatcher, 0, len(tags))
+		for _, tag := range tags {
+			idx := strings.IndexByte(tag, '=')
+			if idx < 0 {
+				return nil, fmt.Errorf("tag matcher %q must be of the form name=value", tag)
+			}
+			f.tags = append(f.tags, tagMatcher{name: tag[:idx], value: tag[idx+1:]})
+		}
+	}
+	return f, nil
+}
+
+// matchName reports whether the filter accepts metrics with the supplied
+// name. Nil filters accept everything.
+func (f *filter) matchName(name string) bool {
+	if f == nil || f.names == nil {
+		return true
+	}
+	_, ok := f.names[name]
+	return ok
+}
+
+// matchMetadata reports whether any metric described by the supplied
+// metadata could match the filter. Since it's checked before calling proto,
+// it lets us skip metrics (and vectors' locks) that can't possibly match.
+func (f *filter) matchMetadata(meta metadata) bool {
+	if f == nil {
+		return true
+	}
+	if !f.matchName(*meta.Name) {
+		return false
+	}
+	for _, m := range f.tags {
+		if value, ok := constTagValue(meta, m.name); ok {
+			if value != m.value {
+				return false
+			}
+			continue
+		}
+		if hasVarTag(meta, m.name) {
+			continue // must check each metric in the vector
+		}
+		if m.value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// filterMetrics drops the metrics in a family that don't satisfy the
+// filter's tag matchers. It doesn't modify the supplied family.
+func (f *filter) filterMetrics(family *promproto.MetricFamily) *promproto.MetricFamily {
+	if f == nil || len(f.tags) == 0 {
+		return family
+	}
+	kept := make([]*promproto.Metric, 0, len(family.Metric))
+	for _, m := range family.Metric {
+		if f.matchTags(m.Label) {
+			kept = append(kept, m)
+		}
+	}
+	return &promproto.MetricFamily{
+		Name:   family.Name,
+		Help:   family.Help,
+		Type:   family.Type,
+		Metric: kept,
+	}
+}
+
+func (f *filter) matchTags(pairs []*promproto.LabelPair) bool {
+	if f == nil {
+		return true
+	}
+	for _, m := range f.tags {
+		value := ""
+		for _, pair := range pairs {
+			if pair.GetName() == m.name {
+				value = pair.GetValue()
+				break
+			}
+		}
+		if value != m.value {
+			return false
+		}
+	}
+	return true
+}
+
+func constTagValue(meta metadata, name string) (string, bool) {
+	for _, pair := range meta.constTagPairs {
+		if pair.GetName() == name {
+			return pair.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+func hasVarTag(meta metadata, name string) bool {
+	for i := range meta.varTagNames {
+		if meta.varTagName(i) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promproto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingMetric counts the number of times it's exported.
+type countingMetric struct {
+	metric
+
+	exports int
+}
+
+func (m *countingMetric) proto() *promproto.MetricFamily {
+	m.exports++
+	return m.metric.proto()
+}
+
+func (m *countingMetric) text(w *textWriter) {
+	m.exports++
+	m.metric.text(w)
+}
+
+func scrapeQuery(t testing.TB, root *Root, query string) (int, string) {
+	server := httptest.NewServer(root)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?" + query)
+	require.NoError(t, err, "Unexpected error scraping Prometheus endpoint.")
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "Unexpected error reading response body.")
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestServeHTTPFiltering(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	official := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "official_gauge",
+		Help: "Some help.",
+	}, []string{"service"})
+	official.WithLabelValues("users").Set(1)
+	official.WithLabelValues("trips").Set(2)
+	registry.MustRegister(official)
+
+	root := New(WithGatherers(registry))
+	users := root.Scope().Tagged(Tags{"service": "users"})
+	trips := root.Scope().Tagged(Tags{"service": "trips"})
+
+	for _, s := range []*Scope{users, trips} {
+		c, err := s.Counter(Spec{Name: "test_counter", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		c.Inc()
+	}
+	vec, err := root.Scope().GaugeVector(Spec{
+		Name:    "test_gauge",
+		Help:    "Some help.",
+		VarTags: []string{"service"},
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge vector.")
+	vec.MustGet("service", "users").Store(3)
+	vec.MustGet("service", "trips").Store(4)
+
+	tests := []struct {
+		desc  string
+		query string
+		want  string
+	}{
+		{
+			desc:  "unrelated query",
+			query: "foo=bar",
+			want: "# HELP test_counter Some help.\n" +
+				"# TYPE test_counter counter\n" +
+				`test_counter{service="users"} 1` + "\n" +
+				"# HELP test_counter Some help.\n" +
+				"# TYPE test_counter counter\n" +
+				`test_counter{service="trips"} 1` + "\n" +
+				"# HELP test_gauge Some help.\n" +
+				"# TYPE test_gauge gauge\n" +
+				`test_gauge{service="trips"} 4` + "\n" +
+				`test_gauge{service="users"} 3` + "\n" +
+				"# HELP official_gauge Some help.\n" +
+				"# TYPE official_gauge gauge\n" +
+				`official_gauge{service="trips"} 2` + "\n" +
+				`official_gauge{service="users"} 1`,
+		},
+		{
+			desc:  "names",
+			query: "name[]=test_counter&name[]=official_gauge",
+			want: "# HELP test_counter Some help.\n" +
+				"# TYPE test_counter counter\n" +
+				`test_counter{service="users"} 1` + "\n" +
+				"# HELP test_counter Some help.\n" +
+				"# TYPE test_counter counter\n" +
+				`test_counter{service="trips"} 1` + "\n" +
+				"# HELP official_gauge Some help.\n" +
+				"# TYPE official_gauge gauge\n" +
+				`official_gauge{service="trips"} 2` + "\n" +
+				`official_gauge{service="users"} 1`,
+		},
+		{
+			desc:  "tags",
+			query: "tag[]=service=users",
+			want: "# HELP test_counter Some help.\n" +
+				"# TYPE test_counter counter\n" +
+				`test_counter{service="users"} 1` + "\n" +
+				"# HELP test_gauge Some help.\n" +
+				"# TYPE test_gauge gauge\n" +
+				`test_gauge{service="users"} 3` + "\n" +
+				"# HELP official_gauge Some help.\n" +
+				"# TYPE official_gauge gauge\n" +
+				`official_gauge{service="users"} 1`,
+		},
+		{
+			desc:  "names and tags",
+			query: "name[]=test_gauge&tag[]=service=trips",
+			want: "# HELP test_gauge Some help.\n" +
+				"# TYPE test_gauge gauge\n" +
+				`test_gauge{service="trips"} 4`,
+		},
+		{
+			desc:  "missing tag matches empty value",
+			query: "name[]=test_gauge&tag[]=region=",
+			want: "# HELP test_gauge Some help.\n" +
+				"# TYPE test_gauge gauge\n" +
+				`test_gauge{service="trips"} 4` + "\n" +
+				`test_gauge{service="users"} 3`,
+		},
+		{
+			desc:  "no matches",
+			query: "tag[]=region=us-west",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			code, body := scrapeQuery(t, root, tt.query)
+			assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code.")
+			assert.Equal(t, strings.Split(tt.want, "\n"), strings.Split(body, "\n"), "Unexpected Prometheus text.")
+		})
+	}
+
+	t.Run("malformed tag matcher", func(t *testing.T) {
+		code, _ := scrapeQuery(t, root, "tag[]=service")
+		assert.Equal(t, http.StatusBadRequest, code, "Unexpected HTTP response code.")
+	})
+}
+
+func TestServeHTTPFilteringSkipsProto(t *testing.T) {
+	root := New()
+	scope := root.Scope().Tagged(Tags{"service": "users"})
+
+	register := func(name string) *countingMetric {
+		meta, err := newMetadata(scope.addConstTags(Spec{Name: name, Help: "Some help."}), scrubber{})
+		require.NoError(t, err, "Unexpected error constructing metadata.")
+		m := &countingMetric{metric: newCounter(meta)}
+		require.NoError(t, root.core.register(m), "Unexpected error registering metric.")
+		return m
+	}
+	wanted, unwanted := register("wanted"), register("unwanted")
+
+	code, _ := scrapeQuery(t, root, "name[]=wanted")
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code.")
+	assert.Equal(t, 1, wanted.exports, "Expected matching metric to be gathered.")
+	assert.Equal(t, 0, unwanted.exports, "Expected non-matching metric to be skipped.")
+
+	code, _ = scrapeQuery(t, root, "tag[]=service=trips")
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code.")
+	assert.Equal(t, 1, wanted.exports, "Expected metric with mismatched constant tags to be skipped.")
+	assert.Equal(t, 0, unwanted.exports, "Expected metric with mismatched constant tags to be skipped.")
+
+	// The protocol buffer encoding is also filtered.
+	code = scrapeProtobuf(t, root, "name[]=wanted")
+	assert.Equal(t, http.StatusOK, code, "Unexpected HTTP response code.")
+	assert.Equal(t, 2, wanted.exports, "Expected matching metric to be gathered.")
+	assert.Equal(t, 0, unwanted.exports, "Expected non-matching metric to be skipped.")
+}
+
+func scrapeProtobuf(t testing.TB, root *Root, query string) int {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	req.Header.Set("Accept", string(expfmt.FmtProtoDelim))
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, req)
+	assert.Equal(t, string(expfmt.FmtProtoDelim), rec.Header().Get("Content-Type"), "Unexpected content type.")
+	return rec.Code
+}
@@ -0,0 +1,507 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+
+	promproto "github.com/prometheus/client_model/go"
+	"go.uber.org/atomic"
+	"go.uber.org/net/metrics/push"
+)
+
+type floatBucket struct {
+	atomic.Int64
+
+	upper float64 // bucket upper bound, inclusive
+}
+
+type floatBuckets []*floatBucket
+
+func newFloatBuckets(upperBounds []float64) floatBuckets {
+	bs := make(floatBuckets, 0, len(upperBounds)+1)
+	for _, upper := range upperBounds {
+		bs = append(bs, &floatBucket{upper: upper})
+	}
+	if !math.IsInf(upperBounds[len(upperBounds)-1], 1) {
+		bs = append(bs, &floatBucket{upper: math.Inf(1)})
+	}
+	return bs
+}
+
+func (bs floatBuckets) get(val float64) *floatBucket {
+	// Binary search to find the correct bucket for this observation. Bucket
+	// upper bounds are inclusive.
+	i, j := 0, len(bs)
+	for i < j {
+		h := i + (j-i)/2
+		if val > bs[h].upper {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return bs[i]
+}
+
+// A FloatHistogram approximates a distribution of floating-point values.
+// Unlike a Histogram, which is designed for latencies, it doesn't have a unit
+// and its bucket bounds and observations may be fractional or negative. It's
+// useful for ratios, scores, and other non-duration distributions.
+//
+// All exported methods are safe to use concurrently, and nil
+// *FloatHistograms are valid no-op implementations.
+type FloatHistogram struct {
+	meta        metadata
+	bounds      []float64
+	buckets     floatBuckets
+	sum         atomic.Float64
+	resets      resetTotals
+	pusher      push.Histogram
+	floatPusher push.FloatHistogram // pusher, if it supports float bounds
+	tagPairs    []*promproto.LabelPair
+	rendered    string // rendered tagPairs, used for sorting and text output
+}
+
+func newFloatHistogram(m metadata, uppers []float64) *FloatHistogram {
+	return newDynamicFloatHistogram(m, append([]float64(nil), uppers...), nil /* variable tag pairs */)
+}
+
+func newDynamicFloatHistogram(m metadata, uppers []float64, variableTagPairs []string) *FloatHistogram {
+	pairs := m.MergeTags(variableTagPairs)
+	return &FloatHistogram{
+		meta:     m,
+		bounds:   uppers,
+		buckets:  newFloatBuckets(uppers),
+		tagPairs: pairs,
+		rendered: renderLabels(pairs),
+	}
+}
+
+// Observe finds the correct bucket for the supplied value and increments its
+// counter. NaNs are ignored.
+func (h *FloatHistogram) Observe(v float64) {
+	if h == nil || math.IsNaN(v) {
+		return
+	}
+	h.buckets.get(v).Inc()
+	h.sum.Add(v)
+}
+
+// Count returns the total number of observations recorded so far.
+func (h *FloatHistogram) Count() int64 {
+	if h == nil {
+		return 0
+	}
+	var n int64
+	for _, b := range h.buckets {
+		n += b.Load()
+	}
+	return n
+}
+
+// Sum returns the sum of the values observed so far.
+func (h *FloatHistogram) Sum() float64 {
+	if h == nil {
+		return 0
+	}
+	return h.sum.Load()
+}
+
+// Quantile estimates the qth quantile (0 <= q <= 1) of the values observed so
+// far. See Histogram.Quantile for details.
+func (h *FloatHistogram) Quantile(q float64) float64 {
+	if h == nil {
+		return math.NaN()
+	}
+	var cumulative uint64
+	return quantile(q, uint64(h.Count()), len(h.buckets), func(i int) (float64, uint64) {
+		cumulative += uint64(h.buckets[i].Load())
+		return h.buckets[i].upper, cumulative
+	})
+}
+
+// Mean returns the mean of the values observed so far. It returns NaN if the
+// histogram is empty.
+func (h *FloatHistogram) Mean() float64 {
+	if h == nil {
+		return math.NaN()
+	}
+	return floatMean(h.Sum(), h.Count())
+}
+
+// Reset clears all the histogram's buckets and its sum. It isn't atomic:
+// concurrent observations and exports may see a partially-cleared histogram.
+func (h *FloatHistogram) Reset() {
+	if h == nil {
+		return
+	}
+	h.resets.reset(len(h.buckets), func(i int) int64 {
+		return h.buckets[i].Swap(0)
+	})
+	h.sum.Store(0)
+}
+
+func (h *FloatHistogram) reset() {
+	h.Reset()
+}
+
+func (h *FloatHistogram) describe() metadata {
+	return h.meta
+}
+
+func (h *FloatHistogram) labels() string {
+	return h.rendered
+}
+
+func (h *FloatHistogram) snapshot() FloatHistogramSnapshot {
+	snap := FloatHistogramSnapshot{
+		Name:    *h.meta.Name,
+		Tags:    zip(h.tagPairs),
+		Buckets: make([]FloatBucketSnapshot, len(h.buckets)),
+		Sum:     h.sum.Load(),
+	}
+	for i, b := range h.buckets {
+		n := b.Load()
+		snap.Buckets[i] = FloatBucketSnapshot{Upper: b.upper, Count: n}
+		snap.Count += n
+	}
+	return snap
+}
+
+func (h *FloatHistogram) proto() *promproto.MetricFamily {
+	return &promproto.MetricFamily{
+		Name:   h.meta.Name,
+		Help:   h.meta.Help,
+		Type:   promproto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*promproto.Metric{h.metric()},
+	}
+}
+
+func (h *FloatHistogram) metric() *promproto.Metric {
+	n := uint64(0)
+	promBuckets := make([]*promproto.Bucket, 0, len(h.buckets)-1)
+	for _, b := range h.buckets {
+		n += uint64(b.Load())
+		if math.IsInf(b.upper, 1) {
+			// Prometheus doesn't want us to export the final catch-all bucket.
+			continue
+		}
+		cumulativeCount := n
+		upper := b.upper
+		promBuckets = append(promBuckets, &promproto.Bucket{
+			CumulativeCount: &cumulativeCount,
+			UpperBound:      &upper,
+		})
+	}
+
+	sum := h.sum.Load()
+	return &promproto.Metric{
+		Label: h.tagPairs,
+		Histogram: &promproto.Histogram{
+			SampleCount: &n,
+			SampleSum:   &sum,
+			Bucket:      promBuckets,
+		},
+	}
+}
+
+func (h *FloatHistogram) text(w *textWriter) {
+	w.begin(h.meta, promproto.MetricType_HISTOGRAM)
+	h.samples(w)
+}
+
+func (h *FloatHistogram) samples(w *textWriter) {
+	if !w.accept(h.tagPairs) {
+		return
+	}
+	var n int64
+	for _, b := range h.buckets {
+		n += b.Load()
+		if math.IsInf(b.upper, 1) {
+			// Like the Prometheus client, write the catch-all bucket last.
+			continue
+		}
+		w.sample("_bucket", h.rendered, "le", b.upper, float64(n))
+	}
+	w.sample("_bucket", h.rendered, "le", math.Inf(1), float64(n))
+	w.sample("_sum", h.rendered, "", 0, h.sum.Load())
+	w.sample("_count", h.rendered, "", 0, float64(n))
+}
+
+func (h *FloatHistogram) push(target push.Target) {
+	if h.meta.DisablePush {
+		return
+	}
+	if h.pusher == nil {
+		h.pusher = target.NewHistogram(push.HistogramSpec{
+			Spec: push.Spec{
+				Name: *h.meta.Name,
+				Tags: zip(h.tagPairs),
+			},
+			FloatBuckets: h.bounds,
+		})
+		h.floatPusher, _ = h.pusher.(push.FloatHistogram)
+	}
+	h.resets.push(len(h.buckets), func(i int) int64 {
+		return h.buckets[i].Load()
+	}, func(index int, total int64) {
+		upper := h.buckets[index].upper
+		if h.floatPusher != nil {
+			h.floatPusher.SetFloatIndex(index, upper, total)
+			return
+		}
+		h.pusher.SetIndex(index, ceilBound(upper), total)
+	})
+}
+
+// ceilBound rounds a float bucket bound up to an integer for push targets
+// that only support integer bounds.
+func ceilBound(upper float64) int64 {
+	switch {
+	case upper >= math.MaxInt64:
+		return math.MaxInt64
+	case upper <= math.MinInt64:
+		return math.MinInt64
+	default:
+		return int64(math.Ceil(upper))
+	}
+}
+
+// A FloatHistogramVector is a collection of FloatHistograms that share a name
+// and some constant tags, but also have a consistent set of variable tags.
+// All exported methods are safe to use concurrently. Nil
+// *FloatHistogramVectors are safe to use and always return no-op histograms.
+//
+// For a general description of vector types, see the package-level
+// documentation.
+type FloatHistogramVector struct {
+	vector
+
+	bounds []float64
+}
+
+func newFloatHistogramVector(m metadata, uppers []float64) *FloatHistogramVector {
+	bounds := append([]float64(nil), uppers...) // don't alias user-supplied slice
+	return &FloatHistogramVector{
+		vector: vector{
+			meta: m,
+			factory: func(m metadata, variableTagPairs []string) metric {
+				return newDynamicFloatHistogram(m, bounds, variableTagPairs)
+			},
+			metricsStorage: make([]metric, 0, _defaultCollectionSize),
+		},
+		bounds: bounds,
+	}
+}
+
+// Get retrieves the histogram with the supplied variable tag names and values
+// from the vector, creating one if necessary. The variable tags must be
+// supplied in the same order used when creating the vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (hv *FloatHistogramVector) Get(variableTagPairs ...string) (*FloatHistogram, error) {
+	if hv == nil {
+		return nil, nil
+	}
+	m, err := hv.getOrCreate(variableTagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return m.(*FloatHistogram), nil
+}
+
+// Lookup behaves like Get, but identifies the histogram with a precomputed key.
+// It's the fastest way to retrieve an existing histogram.
+//
+// Lookup returns an error if the key's tag names don't match the vector's.
+func (hv *FloatHistogramVector) Lookup(key VectorKey) (*FloatHistogram, error) {
+	if hv == nil {
+		return nil, nil
+	}
+	m, err := hv.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.(*FloatHistogram), nil
+}
+
+// With fixes some of the vector's variable tags, returning a narrower vector
+// whose Get method takes only the remaining tags. The fixed tags must be
+// supplied in the same order used when creating the vector, but needn't be
+// contiguous.
+//
+// With returns an error if any tag isn't one of the vector's variable tags,
+// or if the root's ScrubPolicy rejects a tag value.
+func (hv *FloatHistogramVector) With(tagPairs ...string) (*CurriedFloatHistogramVector, error) {
+	if hv == nil {
+		return nil, nil
+	}
+	c, err := newCurry(hv.meta).with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedFloatHistogramVector{vec: hv, curry: c}, nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (hv *FloatHistogramVector) MustGet(variableTagPairs ...string) *FloatHistogram {
+	if hv == nil {
+		return nil
+	}
+	h, err := hv.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get histogram: %v", err))
+	}
+	return h
+}
+
+// Range calls f for each histogram in the vector, sorted by tags, until f
+// returns false. The tags passed to f include the vector's constant tags.
+//
+// Range copies the vector's contents before calling f, so f may safely use
+// the vector. Histograms created while Range is running aren't visited.
+func (hv *FloatHistogramVector) Range(f func(Tags, *FloatHistogram) bool) {
+	if hv == nil {
+		return
+	}
+	for _, c := range hv.children() {
+		m := c.(*FloatHistogram)
+		if !f(zip(m.tagPairs), m) {
+			return
+		}
+	}
+}
+
+// Reset clears the buckets of every histogram in the vector. Unlike counter
+// and gauge vectors, histogram vectors keep their histograms.
+func (hv *FloatHistogramVector) Reset() {
+	if hv == nil {
+		return
+	}
+	hv.metricsMu.RLock()
+	for _, m := range hv.metricsStorage {
+		m.(*FloatHistogram).Reset()
+	}
+	hv.metricsMu.RUnlock()
+}
+
+func (hv *FloatHistogramVector) reset() {
+	hv.Reset()
+}
+
+func (hv *FloatHistogramVector) describe() metadata {
+	return hv.meta
+}
+
+func (hv *FloatHistogramVector) snapshot() []FloatHistogramSnapshot {
+	hv.metricsMu.RLock()
+	defer hv.metricsMu.RUnlock()
+	snaps := make([]FloatHistogramSnapshot, 0, len(hv.metricsStorage))
+	for _, m := range hv.metricsStorage {
+		snaps = append(snaps, m.(*FloatHistogram).snapshot())
+	}
+	return snaps
+}
+
+func (hv *FloatHistogramVector) proto() *promproto.MetricFamily {
+	children := hv.children()
+	protos := make([]*promproto.Metric, 0, len(children))
+	for _, h := range children {
+		protos = append(protos, h.(*FloatHistogram).metric())
+	}
+
+	return &promproto.MetricFamily{
+		Name:   hv.meta.Name,
+		Help:   hv.meta.Help,
+		Type:   promproto.MetricType_HISTOGRAM.Enum(),
+		Metric: protos,
+	}
+}
+
+func (hv *FloatHistogramVector) text(w *textWriter) {
+	w.begin(hv.meta, promproto.MetricType_HISTOGRAM)
+	hv.vector.samples(w)
+}
+
+// A CurriedFloatHistogramVector is a FloatHistogramVector with some of its variable tags fixed.
+// It shares its histograms with the original vector. All exported methods are
+// safe to use concurrently, and nil *CurriedFloatHistogramVectors are safe to use
+// and always return no-op histograms.
+type CurriedFloatHistogramVector struct {
+	vec   *FloatHistogramVector
+	curry curry
+}
+
+// Get retrieves the histogram with the supplied remaining variable tag names
+// and values, creating one if necessary. The tags must be supplied in the
+// same order used when creating the original vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (c *CurriedFloatHistogramVector) Get(variableTagPairs ...string) (*FloatHistogram, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.curry.validate(variableTagPairs); err != nil {
+		return nil, err
+	}
+	digester := newDigester()
+	if err := c.curry.digest(digester, variableTagPairs); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := c.vec.index.load(digester.digest())
+	if !ok {
+		m = c.vec.get(digester.digest(), c.curry.pairs(variableTagPairs))
+	}
+	digester.free()
+	return m.(*FloatHistogram), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (c *CurriedFloatHistogramVector) MustGet(variableTagPairs ...string) *FloatHistogram {
+	if c == nil {
+		return nil
+	}
+	m, err := c.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get histogram: %v", err))
+	}
+	return m
+}
+
+// With fixes more of the vector's variable tags, returning an even narrower
+// vector.
+func (c *CurriedFloatHistogramVector) With(tagPairs ...string) (*CurriedFloatHistogramVector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	next, err := c.curry.with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedFloatHistogramVector{vec: c.vec, curry: next}, nil
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics/push"
+)
+
+func TestFloatHistogramSpec(t *testing.T) {
+	tests := []struct {
+		desc    string
+		buckets []float64
+		ok      bool
+	}{
+		{"no buckets", nil, false},
+		{"negative and fractional", []float64{-10, -0.5, 0, 0.5}, true},
+		{"explicit catch-all", []float64{1, math.Inf(1)}, true},
+		{"negative infinity", []float64{math.Inf(-1), 0}, true},
+		{"NaN", []float64{1, math.NaN()}, false},
+		{"unsorted", []float64{1, 0.5}, false},
+		{"duplicate", []float64{1, 1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := New().Scope().FloatHistogram(FloatHistogramSpec{
+				Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+				Buckets: tt.buckets,
+			})
+			if tt.ok {
+				assert.NoError(t, err, "Expected success.")
+			} else {
+				assert.Error(t, err, "Expected an error.")
+			}
+		})
+	}
+
+	_, err := New().Scope().FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help.", VarTags: []string{"foo"}},
+		Buckets: []float64{1},
+	})
+	assert.Error(t, err, "Expected an error constructing scalar with variable tags.")
+	_, err = New().Scope().FloatHistogramVector(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+		Buckets: []float64{1},
+	})
+	assert.Error(t, err, "Expected an error constructing vector without variable tags.")
+}
+
+func TestFloatHistogram(t *testing.T) {
+	root := New()
+	buckets := []float64{-1, 0, 0.5}
+	h, err := root.Scope().Tagged(Tags{"service": "users"}).FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_clock_skew_seconds", Help: "Some help."},
+		Buckets: buckets,
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+	buckets[0] = -100 // shouldn't affect histogram
+
+	assert.Zero(t, h.Count(), "Unexpected count for empty histogram.")
+	assert.True(t, math.IsNaN(h.Quantile(0.5)), "Expected NaN quantile for empty histogram.")
+	assert.True(t, math.IsNaN(h.Mean()), "Expected NaN mean for empty histogram.")
+
+	h.Observe(-2)
+	h.Observe(-1)
+	h.Observe(-0.5)
+	h.Observe(0.25)
+	h.Observe(3)
+	h.Observe(math.NaN())
+
+	assert.Equal(t, int64(5), h.Count(), "Unexpected count.")
+	assert.Equal(t, -0.25, h.Sum(), "Unexpected sum.")
+	assert.Equal(t, -0.05, h.Mean(), "Unexpected mean.")
+	assert.Equal(t, float64(-1), h.Quantile(0.2), "Unexpected p20.")
+	assert.Equal(t, -0.5, h.Quantile(0.5), "Unexpected median.")
+	assert.Equal(t, math.Inf(1), h.Quantile(0.9), "Unexpected p90.")
+
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.FloatHistograms), "Unexpected number of float histogram snapshots.")
+	assert.Equal(t, FloatHistogramSnapshot{
+		Name: "test_clock_skew_seconds",
+		Tags: Tags{"service": "users"},
+		Buckets: []FloatBucketSnapshot{
+			{Upper: -1, Count: 2},
+			{Upper: 0, Count: 1},
+			{Upper: 0.5, Count: 1},
+			{Upper: math.Inf(1), Count: 1},
+		},
+		Count: 5,
+		Sum:   -0.25,
+	}, snap.FloatHistograms[0], "Unexpected snapshot.")
+	assert.Equal(t, h.Quantile(0.5), snap.FloatHistograms[0].Quantile(0.5), "Live and snapshot estimates differ.")
+	assert.Equal(t, h.Mean(), snap.FloatHistograms[0].Mean(), "Live and snapshot means differ.")
+
+	descs := root.Describe()
+	require.Equal(t, 1, len(descs), "Unexpected number of descriptors.")
+	assert.Equal(t, HistogramType, descs[0].Type, "Unexpected type.")
+	assert.Equal(t, []float64{-1, 0, 0.5}, descs[0].FloatBuckets, "Unexpected buckets.")
+	assert.Nil(t, descs[0].Buckets, "Unexpected integer buckets.")
+}
+
+func TestFloatHistogramVector(t *testing.T) {
+	root := New()
+	hv, err := root.Scope().FloatHistogramVector(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help.", VarTags: []string{"var"}},
+		Buckets: []float64{0.5, 1},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram vector.")
+
+	x, err := hv.Get("var", "x")
+	require.NoError(t, err, "Unexpected error calling Get.")
+	x.Observe(0.25)
+	hv.MustGet("var", "y").Observe(0.75)
+	hv.MustGet("var", "x").Observe(0.5)
+
+	_, err = hv.Get("wrong", "x")
+	assert.Error(t, err, "Expected an error getting histogram with wrong tags.")
+	assert.Panics(t, func() { hv.MustGet("wrong", "x") }, "Expected a panic getting histogram with wrong tags.")
+
+	snap := root.Snapshot()
+	require.Equal(t, 2, len(snap.FloatHistograms), "Unexpected number of float histogram snapshots.")
+	assert.Equal(t, Tags{"var": "x"}, snap.FloatHistograms[0].Tags, "Unexpected tags on first snapshot.")
+	assert.Equal(t, int64(2), snap.FloatHistograms[0].Count, "Unexpected count on first snapshot.")
+	assert.Equal(t, Tags{"var": "y"}, snap.FloatHistograms[1].Tags, "Unexpected tags on second snapshot.")
+	assert.Equal(t, 0.75, snap.FloatHistograms[1].Sum, "Unexpected sum on second snapshot.")
+}
+
+// intTarget wraps a push.Target, hiding support for float histograms.
+type intTarget struct {
+	push.Target
+	histograms []*intHistogram
+}
+
+type intHistogram struct {
+	spec push.HistogramSpec
+	sets map[int]int64 // upper bounds by index
+}
+
+func (t *intTarget) NewHistogram(spec push.HistogramSpec) push.Histogram {
+	h := &intHistogram{spec: spec, sets: make(map[int]int64)}
+	t.histograms = append(t.histograms, h)
+	return h
+}
+
+func (h *intHistogram) Set(bucket, total int64) {}
+
+func (h *intHistogram) SetIndex(index int, bucket, total int64) {
+	h.sets[index] = bucket
+}
+
+func TestFloatHistogramPushFallback(t *testing.T) {
+	root := New()
+	_, err := root.Scope().FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+		Buckets: []float64{-1.5, 0.25, 1e30},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+
+	target := &intTarget{}
+	root.push(target)
+	require.Equal(t, 1, len(target.histograms), "Unexpected number of pushed histograms.")
+	h := target.histograms[0]
+	assert.Equal(t, []float64{-1.5, 0.25, 1e30}, h.spec.FloatBuckets, "Unexpected float buckets in spec.")
+	assert.Nil(t, h.spec.Buckets, "Unexpected integer buckets in spec.")
+	assert.Equal(t, map[int]int64{
+		0: -1,
+		1: 1,
+		2: math.MaxInt64,
+		3: math.MaxInt64,
+	}, h.sets, "Unexpected rounded bucket bounds.")
+}
@@ -22,7 +22,6 @@ package metrics
 
 import (
 	"fmt"
-	"sort"
 
 	promproto "github.com/prometheus/client_model/go"
 	"go.uber.org/net/metrics/push"
@@ -106,6 +105,10 @@ func (g *Gauge) Load() int64 {
 	return g.val.Load()
 }
 
+func (g *Gauge) reset() {
+	g.Store(0)
+}
+
 func (g *Gauge) describe() metadata {
 	return g.val.meta
 }
@@ -131,6 +134,21 @@ func (g *Gauge) metric() *promproto.Metric {
 	}
 }
 
+func (g *Gauge) text(w *textWriter) {
+	w.begin(g.val.meta, promproto.MetricType_GAUGE)
+	g.samples(w)
+}
+
+func (g *Gauge) labels() string {
+	return g.val.labels
+}
+
+func (g *Gauge) samples(w *textWriter) {
+	if w.accept(g.val.tagPairs) {
+		w.sample(w.valueSuffix(), g.val.labels, "", 0, float64(g.val.Load()))
+	}
+}
+
 func (g *Gauge) push(target push.Target) {
 	if g.val.meta.DisablePush {
 		return
@@ -159,7 +177,6 @@ func newGaugeVector(m metadata) *GaugeVector {
 	return &GaugeVector{vector{
 		meta:           m,
 		factory:        newDynamicGauge,
-		metrics:        make(map[string]uint32, _defaultCollectionSize),
 		metricsStorage: make([]metric, 0, _defaultCollectionSize),
 	}}
 }
@@ -168,7 +185,8 @@ func newGaugeVector(m metadata) *GaugeVector {
 // from the vector, creating one if necessary. The variable tags must be
 // supplied in the same order used when creating the vector.
 //
-// Get returns an error if the number or order of tags is incorrect.
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
 func (gv *GaugeVector) Get(variableTagPairs ...string) (*Gauge, error) {
 	if gv == nil {
 		return nil, nil
@@ -180,6 +198,39 @@ func (gv *GaugeVector) Get(variableTagPairs ...string) (*Gauge, error) {
 	return m.(*Gauge), nil
 }
 
+// Lookup behaves like Get, but identifies the gauge with a precomputed key.
+// It's the fastest way to retrieve an existing gauge.
+//
+// Lookup returns an error if the key's tag names don't match the vector's.
+func (gv *GaugeVector) Lookup(key VectorKey) (*Gauge, error) {
+	if gv == nil {
+		return nil, nil
+	}
+	m, err := gv.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Gauge), nil
+}
+
+// With fixes some of the vector's variable tags, returning a narrower vector
+// whose Get method takes only the remaining tags. The fixed tags must be
+// supplied in the same order used when creating the vector, but needn't be
+// contiguous.
+//
+// With returns an error if any tag isn't one of the vector's variable tags,
+// or if the root's ScrubPolicy rejects a tag value.
+func (gv *GaugeVector) With(tagPairs ...string) (*CurriedGaugeVector, error) {
+	if gv == nil {
+		return nil, nil
+	}
+	c, err := newCurry(gv.meta).with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedGaugeVector{vec: gv, curry: c}, nil
+}
+
 // MustGet behaves exactly like Get, but panics on errors. If code using this
 // method is covered by unit tests, this is safe.
 func (gv *GaugeVector) MustGet(variableTagPairs ...string) *Gauge {
@@ -193,25 +244,119 @@ func (gv *GaugeVector) MustGet(variableTagPairs ...string) *Gauge {
 	return g
 }
 
+// Range calls f for each gauge in the vector, sorted by tags, until f
+// returns false. The tags passed to f include the vector's constant tags.
+//
+// Range copies the vector's contents before calling f, so f may safely use
+// the vector. Gauges created while Range is running aren't visited.
+func (gv *GaugeVector) Range(f func(Tags, *Gauge) bool) {
+	if gv == nil {
+		return
+	}
+	for _, c := range gv.children() {
+		m := c.(*Gauge)
+		if !f(zip(m.val.tagPairs), m) {
+			return
+		}
+	}
+}
+
+// Reset drops all the gauges in the vector, which is useful when the set of
+// tags changes over time (for example, when tracking the current members of
+// a cluster). Gauges retrieved before the reset remain usable, but they're no
+// longer exported.
+func (gv *GaugeVector) Reset() {
+	if gv == nil {
+		return
+	}
+	gv.vector.reset()
+}
+
+func (gv *GaugeVector) reset() {
+	gv.Reset()
+}
+
 func (gv *GaugeVector) describe() metadata {
 	return gv.meta
 }
 
+func (gv *GaugeVector) text(w *textWriter) {
+	w.begin(gv.meta, promproto.MetricType_GAUGE)
+	gv.vector.samples(w)
+}
+
 func (gv *GaugeVector) proto() *promproto.MetricFamily {
 	mf := &promproto.MetricFamily{
 		Name: gv.meta.Name,
 		Help: gv.meta.Help,
 		Type: promproto.MetricType_GAUGE.Enum(),
 	}
-	gv.metricsMu.RLock()
-	protos := make([]*promproto.Metric, 0, len(gv.metrics))
-	for _, metric := range gv.metricsStorage {
-		protos = append(protos, metric.(*Gauge).metric())
+	children := gv.children()
+	protos := make([]*promproto.Metric, 0, len(children))
+	for _, c := range children {
+		protos = append(protos, c.(*Gauge).metric())
 	}
-	gv.metricsMu.RUnlock()
-	sort.Slice(protos, func(i, j int) bool {
-		return protos[i].String() < protos[j].String()
-	})
 	mf.Metric = protos
 	return mf
 }
+
+// A CurriedGaugeVector is a GaugeVector with some of its variable tags fixed.
+// It shares its gauges with the original vector. All exported methods are
+// safe to use concurrently, and nil *CurriedGaugeVectors are safe to use
+// and always return no-op gauges.
+type CurriedGaugeVector struct {
+	vec   *GaugeVector
+	curry curry
+}
+
+// Get retrieves the gauge with the supplied remaining variable tag names
+// and values, creating one if necessary. The tags must be supplied in the
+// same order used when creating the original vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (c *CurriedGaugeVector) Get(variableTagPairs ...string) (*Gauge, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.curry.validate(variableTagPairs); err != nil {
+		return nil, err
+	}
+	digester := newDigester()
+	if err := c.curry.digest(digester, variableTagPairs); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := c.vec.index.load(digester.digest())
+	if !ok {
+		m = c.vec.get(digester.digest(), c.curry.pairs(variableTagPairs))
+	}
+	digester.free()
+	return m.(*Gauge), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (c *CurriedGaugeVector) MustGet(variableTagPairs ...string) *Gauge {
+	if c == nil {
+		return nil
+	}
+	m, err := c.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get gauge: %v", err))
+	}
+	return m
+}
+
+// With fixes more of the vector's variable tags, returning an even narrower
+// vector.
+func (c *CurriedGaugeVector) With(tagPairs ...string) (*CurriedGaugeVector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	next, err := c.curry.with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedGaugeVector{vec: c.vec, curry: next}, nil
+}
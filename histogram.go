@@ -52,6 +52,10 @@ func newBuckets(upperBounds []int64) buckets {
 }
 
 func (bs buckets) get(val int64) *bucket {
+	return bs[bs.index(val)]
+}
+
+func (bs buckets) index(val int64) int {
 	// Binary search to find the correct bucket for this observation. Bucket
 	// upper bounds are inclusive.
 	i, j := 0, len(bs)
@@ -63,7 +67,7 @@ func (bs buckets) get(val int64) *bucket {
 			j = h
 		}
 	}
-	return bs[i]
+	return i
 }
 
 // A Histogram approximates a distribution of values. They're both more
@@ -78,21 +82,72 @@ type Histogram struct {
 	unit     time.Duration
 	bounds   []int64
 	buckets  buckets
-	sum      atomic.Int64 // required by Prometheus
+	sum      atomic.Int64   // required by Prometheus
+	stripes  *stripedCounts // nil unless striped; replaces buckets' counters and sum
+	resets   resetTotals
 	pusher   push.Histogram
 	tagPairs []*promproto.LabelPair
+	labels   string // rendered tagPairs, used for sorting and text output
+	clock    Clock  // used by Start
 }
 
-func newHistogram(m metadata, unit time.Duration, uppers []int64) *Histogram {
-	return &Histogram{
+func newHistogram(m metadata, unit time.Duration, uppers []int64, clock Clock) *Histogram {
+	pairs := m.MergeTags(nil /* variable tag vals */)
+	h := &Histogram{
 		buckets:  newBuckets(uppers),
 		meta:     m,
 		unit:     unit,
-		bounds:   uppers,
-		tagPairs: m.MergeTags(nil /* variable tag vals */),
+		bounds:   append([]int64(nil), uppers...), // don't alias user-supplied slice
+		tagPairs: pairs,
+		labels:   renderLabels(pairs),
+		clock:    clock,
+	}
+	h.stripe()
+	return h
+}
+
+// stripe switches the histogram to striped storage if its metadata asks for
+// it. The final striped counter holds the sum.
+func (h *Histogram) stripe() {
+	if h.meta.Striped {
+		h.stripes = newStripedCounts(len(h.buckets) + 1)
 	}
 }
 
+// addBucket adds count to the ith bucket.
+func (h *Histogram) addBucket(i int, count int64) {
+	if h.stripes != nil {
+		h.stripes.add(i, count)
+		return
+	}
+	h.buckets[i].Add(count)
+}
+
+// addSum adds n to the sum of all observations.
+func (h *Histogram) addSum(n int64) {
+	if h.stripes != nil {
+		h.stripes.add(len(h.buckets), n)
+		return
+	}
+	h.sum.Add(n)
+}
+
+// bucketCount loads the ith bucket's count.
+func (h *Histogram) bucketCount(i int) int64 {
+	if h.stripes != nil {
+		return h.stripes.load(i)
+	}
+	return h.buckets[i].Load()
+}
+
+// loadSum loads the sum of all observations.
+func (h *Histogram) loadSum() int64 {
+	if h.stripes != nil {
+		return h.stripes.load(len(h.buckets))
+	}
+	return h.sum.Load()
+}
+
 // Observe finds the correct bucket for the supplied duration and increments
 // its counter. This is purely a convenience - it's equivalent to dividing the
 // duration by the histogram's unit and calling IncBucket directly.
@@ -110,33 +165,174 @@ func (h *Histogram) IncBucket(n int64) {
 	if h == nil {
 		return
 	}
+	if h.stripes != nil {
+		i := h.buckets.index(n)
+		h.stripes.add(i, 1)
+		h.stripes.add(len(h.buckets), n)
+		return
+	}
 	bucket := h.buckets.get(n)
 	bucket.Inc()
 	h.sum.Add(n)
 }
 
-func (h *Histogram) describe() metadata {
-	return h.meta
+// IncBucketN behaves like IncBucket, but records count observations of the
+// supplied value at once. Non-positive counts are ignored.
+func (h *Histogram) IncBucketN(n, count int64) {
+	if h == nil || count <= 0 {
+		return
+	}
+	h.addBucket(h.buckets.index(n), count)
+	h.addSum(n * count)
 }
 
-func (h *Histogram) snapshot() HistogramSnapshot {
-	return HistogramSnapshot{
-		Name:   *h.meta.Name,
-		Tags:   zip(h.tagPairs),
-		Unit:   h.unit,
-		Values: h.observations(),
+// ObserveN behaves like Observe, but records count observations of the
+// supplied duration at once. Non-positive counts are ignored.
+func (h *Histogram) ObserveN(d time.Duration, count int64) {
+	if h == nil {
+		return
+	}
+	h.IncBucketN(int64(d/h.unit), count)
+}
+
+// ObserveMany records a batch of observations, updating the histogram's sum
+// only once.
+func (h *Histogram) ObserveMany(ds []time.Duration) {
+	if h == nil || len(ds) == 0 {
+		return
+	}
+	var sum int64
+	for _, d := range ds {
+		n := int64(d / h.unit)
+		h.addBucket(h.buckets.index(n), 1)
+		sum += n
+	}
+	h.addSum(sum)
+}
+
+// Merge adds all the observations recorded by another histogram to this one.
+// Both histograms must have the same unit and bucket upper bounds. Merging
+// isn't atomic: concurrent exports may see only some of the merged buckets.
+func (h *Histogram) Merge(other *Histogram) error {
+	if h == nil || other == nil {
+		return nil
+	}
+	if h.unit != other.unit || !sameBounds(h.buckets, other.buckets) {
+		return fmt.Errorf("can't merge histogram %q into %q: units and buckets must match", *other.meta.Name, *h.meta.Name)
+	}
+	for i := range other.buckets {
+		if n := other.bucketCount(i); n != 0 {
+			h.addBucket(i, n)
+		}
+	}
+	h.addSum(other.loadSum())
+	return nil
+}
+
+func sameBounds(left, right buckets) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i].upper != right[i].upper {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the total number of observations recorded so far.
+func (h *Histogram) Count() int64 {
+	if h == nil {
+		return 0
+	}
+	var n int64
+	for i := range h.buckets {
+		n += h.bucketCount(i)
+	}
+	return n
+}
+
+// Sum returns the exact sum of the values observed so far, in units.
+func (h *Histogram) Sum() int64 {
+	if h == nil {
+		return 0
 	}
+	return h.loadSum()
+}
+
+// Quantile estimates the qth quantile (0 <= q <= 1) of the values observed so
+// far, in units, by interpolating linearly within buckets. It returns +Inf if
+// the quantile falls in the catch-all bucket and NaN if the histogram is
+// empty.
+//
+// Quantile reads the bucket counters directly, without allocating or taking
+// a snapshot, so it's cheap enough to call on hot paths (for example, to
+// compute hedging thresholds). Observations made concurrently may or may not
+// be included in the estimate.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h == nil {
+		return math.NaN()
+	}
+	var cumulative uint64
+	return quantile(q, uint64(h.Count()), len(h.buckets), func(i int) (float64, uint64) {
+		cumulative += uint64(h.bucketCount(i))
+		return upperBound(h.buckets[i].upper), cumulative
+	})
 }
 
-func (h *Histogram) observations() []int64 {
-	var obs []int64
-	for _, b := range h.buckets {
-		n := b.Load()
-		for i := int64(0); i < n; i++ {
-			obs = append(obs, b.upper)
+// Mean returns the mean of the values observed so far, in units. It returns
+// NaN if the histogram is empty. Since the count and sum are read separately,
+// observations made concurrently may make the result slightly inaccurate.
+func (h *Histogram) Mean() float64 {
+	if h == nil {
+		return math.NaN()
+	}
+	return mean(h.Sum(), h.Count())
+}
+
+// Reset clears all the histogram's buckets and its sum. Like Merge, it isn't
+// atomic: concurrent observations and exports may see a partially-cleared
+// histogram.
+func (h *Histogram) Reset() {
+	if h == nil {
+		return
+	}
+	h.resets.reset(len(h.buckets), func(i int) int64 {
+		if h.stripes != nil {
+			return h.stripes.swap(i)
 		}
+		return h.buckets[i].Swap(0)
+	})
+	if h.stripes != nil {
+		h.stripes.swap(len(h.buckets))
+		return
+	}
+	h.sum.Store(0)
+}
+
+func (h *Histogram) reset() {
+	h.Reset()
+}
+
+func (h *Histogram) describe() metadata {
+	return h.meta
+}
+
+func (h *Histogram) snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{
+		Name:    *h.meta.Name,
+		Tags:    zip(h.tagPairs),
+		Unit:    h.unit,
+		Buckets: make([]BucketSnapshot, len(h.buckets)),
+		Sum:     h.loadSum(),
 	}
-	return obs
+	for i, b := range h.buckets {
+		n := h.bucketCount(i)
+		snap.Buckets[i] = BucketSnapshot{Upper: b.upper, Count: n}
+		snap.Count += n
+	}
+	return snap
 }
 
 func (h *Histogram) proto() *promproto.MetricFamily {
@@ -151,8 +347,8 @@ func (h *Histogram) proto() *promproto.MetricFamily {
 func (h *Histogram) metric() *promproto.Metric {
 	n := uint64(0)
 	promBuckets := make([]*promproto.Bucket, 0, len(h.buckets)-1)
-	for _, b := range h.buckets {
-		n += uint64(b.Load())
+	for i, b := range h.buckets {
+		n += uint64(h.bucketCount(i))
 		if b.upper == math.MaxInt64 {
 			// Prometheus doesn't want us to export the final catch-all bucket.
 			continue
@@ -165,7 +361,7 @@ func (h *Histogram) metric() *promproto.Metric {
 		})
 	}
 
-	sum := float64(h.sum.Load())
+	sum := float64(h.loadSum())
 	return &promproto.Metric{
 		Label: h.tagPairs,
 		Histogram: &promproto.Histogram{
@@ -176,6 +372,29 @@ func (h *Histogram) metric() *promproto.Metric {
 	}
 }
 
+func (h *Histogram) text(w *textWriter) {
+	w.begin(h.meta, promproto.MetricType_HISTOGRAM)
+	h.samples(w)
+}
+
+func (h *Histogram) samples(w *textWriter) {
+	if !w.accept(h.tagPairs) {
+		return
+	}
+	var n int64
+	for i, b := range h.buckets {
+		n += h.bucketCount(i)
+		if b.upper == math.MaxInt64 {
+			// Like the Prometheus client, write the catch-all bucket last.
+			continue
+		}
+		w.sample("_bucket", h.labels, "le", float64(b.upper), float64(n))
+	}
+	w.sample("_bucket", h.labels, "le", math.Inf(1), float64(n))
+	w.sample("_sum", h.labels, "", 0, float64(h.loadSum()))
+	w.sample("_count", h.labels, "", 0, float64(n))
+}
+
 func (h *Histogram) push(target push.Target) {
 	if h.meta.DisablePush {
 		return
@@ -189,9 +408,9 @@ func (h *Histogram) push(target push.Target) {
 			Buckets: h.bounds,
 		})
 	}
-	for index, bucket := range h.buckets {
-		h.pusher.SetIndex(index, bucket.upper, bucket.Load())
-	}
+	h.resets.push(len(h.buckets), h.bucketCount, func(index int, total int64) {
+		h.pusher.SetIndex(index, h.buckets[index].upper, total)
+	})
 }
 
 // A HistogramVector is a collection of Histograms that share a name and some
@@ -205,18 +424,22 @@ type HistogramVector struct {
 	meta   metadata
 	unit   time.Duration
 	bounds []int64
+	clock  Clock // used by Start
+
+	index readMap // key is variable tag vals, value is *Histogram
 
-	histogramsMu     sync.RWMutex
-	histograms       map[string]uint32 // key is variable tag vals
+	histogramsMu     sync.RWMutex // guards creation and the slices below
 	histogramStorage []*Histogram
+	sorted           []*Histogram // ordered by rendered tags unless unsorted is set
+	unsorted         bool         // see vector.unsorted
 }
 
-func newHistogramVector(m metadata, unit time.Duration, uppers []int64) *HistogramVector {
+func newHistogramVector(m metadata, unit time.Duration, uppers []int64, clock Clock) *HistogramVector {
 	return &HistogramVector{
 		meta:             m,
+		clock:            clock,
 		unit:             unit,
-		bounds:           uppers,
-		histograms:       make(map[string]uint32, _defaultCollectionSize),
+		bounds:           append([]int64(nil), uppers...), // don't alias user-supplied slice
 		histogramStorage: make([]*Histogram, 0, _defaultCollectionSize),
 	}
 }
@@ -225,7 +448,8 @@ func newHistogramVector(m metadata, unit time.Duration, uppers []int64) *Histogr
 // from the vector, creating one if necessary. The variable tags must be
 // supplied in the same order used when creating the vector.
 //
-// Get returns an error if the number or order of tags is incorrect.
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
 func (hv *HistogramVector) Get(variableTagPairs ...string) (*Histogram, error) {
 	if hv == nil {
 		return nil, nil
@@ -234,26 +458,49 @@ func (hv *HistogramVector) Get(variableTagPairs ...string) (*Histogram, error) {
 		return nil, err
 	}
 	digester := newDigester()
-	for i := 0; i < len(variableTagPairs)/2; i++ {
-		digester.add("", scrubTagValue(variableTagPairs[i*2+1]))
-	}
-
-	hv.histogramsMu.RLock()
-	hIndex, ok := hv.histograms[string(digester.digest())]
-	if ok {
-		h := hv.histogramStorage[hIndex]
-		hv.histogramsMu.RUnlock()
+	if err := hv.meta.digestVariableTags(digester, variableTagPairs); err != nil {
 		digester.free()
-		return h, nil
+		return nil, err
 	}
-	hv.histogramsMu.RUnlock()
 
-	hv.histogramsMu.Lock()
-	h, err := hv.newHistogram(digester.digest(), variableTagPairs)
-	hv.histogramsMu.Unlock()
+	h := hv.get(digester.digest(), variableTagPairs)
 	digester.free()
+	return h, nil
+}
 
-	return h, err
+// Lookup behaves like Get, but identifies the histogram with a precomputed key.
+// It's the fastest way to retrieve an existing histogram.
+//
+// Lookup returns an error if the key's tag names don't match the vector's.
+func (hv *HistogramVector) Lookup(key VectorKey) (*Histogram, error) {
+	if hv == nil {
+		return nil, nil
+	}
+	if !hv.meta.scrubber.isDefault() {
+		return hv.Get(key.pairs...)
+	}
+	if err := hv.meta.ValidateVariableTags(key.pairs); err != nil {
+		return nil, err
+	}
+	return hv.get(key.digest, key.pairs), nil
+}
+
+// With fixes some of the vector's variable tags, returning a narrower vector
+// whose Get method takes only the remaining tags. The fixed tags must be
+// supplied in the same order used when creating the vector, but needn't be
+// contiguous.
+//
+// With returns an error if any tag isn't one of the vector's variable tags,
+// or if the root's ScrubPolicy rejects a tag value.
+func (hv *HistogramVector) With(tagPairs ...string) (*CurriedHistogramVector, error) {
+	if hv == nil {
+		return nil, nil
+	}
+	c, err := newCurry(hv.meta).with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedHistogramVector{vec: hv, curry: c}, nil
 }
 
 // MustGet behaves exactly like Get, but panics on errors. If code using this
@@ -269,21 +516,93 @@ func (hv *HistogramVector) MustGet(variableTagPairs ...string) *Histogram {
 	return h
 }
 
-func (hv *HistogramVector) newHistogram(key []byte, variableTagPairs []string) (*Histogram, error) {
-	hIndex, ok := hv.histograms[string(key)]
-	if ok {
-		return hv.histogramStorage[hIndex], nil
+func (hv *HistogramVector) get(key []byte, variableTagPairs []string) *Histogram {
+	if h, ok := hv.index.load(key); ok {
+		return h.(*Histogram)
+	}
+	hv.histogramsMu.Lock()
+	h := hv.newHistogram(key, variableTagPairs)
+	hv.histogramsMu.Unlock()
+	return h
+}
+
+func (hv *HistogramVector) newHistogram(key []byte, variableTagPairs []string) *Histogram {
+	if h, ok := hv.index.loadLocked(key); ok {
+		return h.(*Histogram)
 	}
+	pairs := hv.meta.MergeTags(variableTagPairs)
 	h := &Histogram{
 		buckets:  newBuckets(hv.bounds),
 		meta:     hv.meta,
 		unit:     hv.unit,
 		bounds:   hv.bounds,
-		tagPairs: hv.meta.MergeTags(variableTagPairs),
+		tagPairs: pairs,
+		labels:   renderLabels(pairs),
+		clock:    hv.clock,
 	}
-	hv.histograms[string(key)] = uint32(len(hv.histogramStorage))
+	h.stripe()
+	hv.index.storeLocked(key, h)
 	hv.histogramStorage = append(hv.histogramStorage, h)
-	return h, nil
+	hv.sorted = append(hv.sorted, h)
+	hv.unsorted = true
+	return h
+}
+
+// sortedHistograms appends the vector's histograms, ordered by their rendered
+// tags, to dst. It sorts the histograms only if new ones were added since the
+// last call.
+func (hv *HistogramVector) sortedHistograms(dst []*Histogram) []*Histogram {
+	hv.histogramsMu.RLock()
+	if !hv.unsorted {
+		dst = append(dst, hv.sorted...)
+		hv.histogramsMu.RUnlock()
+		return dst
+	}
+	hv.histogramsMu.RUnlock()
+
+	hv.histogramsMu.Lock()
+	if hv.unsorted {
+		sort.Slice(hv.sorted, func(i, j int) bool {
+			return hv.sorted[i].labels < hv.sorted[j].labels
+		})
+		hv.unsorted = false
+	}
+	dst = append(dst, hv.sorted...)
+	hv.histogramsMu.Unlock()
+	return dst
+}
+
+// Range calls f for each histogram in the vector, sorted by tags, until f
+// returns false. The tags passed to f include the vector's constant tags.
+//
+// Range copies the vector's contents before calling f, so f may safely use
+// the vector. Histograms created while Range is running aren't visited.
+func (hv *HistogramVector) Range(f func(Tags, *Histogram) bool) {
+	if hv == nil {
+		return
+	}
+	for _, h := range hv.sortedHistograms(nil) {
+		if !f(zip(h.tagPairs), h) {
+			return
+		}
+	}
+}
+
+// Reset clears the buckets of every histogram in the vector. Unlike counter
+// and gauge vectors, histogram vectors keep their histograms.
+func (hv *HistogramVector) Reset() {
+	if hv == nil {
+		return
+	}
+	hv.histogramsMu.RLock()
+	for _, h := range hv.histogramStorage {
+		h.Reset()
+	}
+	hv.histogramsMu.RUnlock()
+}
+
+func (hv *HistogramVector) reset() {
+	hv.Reset()
 }
 
 func (hv *HistogramVector) describe() metadata {
@@ -293,7 +612,7 @@ func (hv *HistogramVector) describe() metadata {
 func (hv *HistogramVector) snapshot() []HistogramSnapshot {
 	hv.histogramsMu.RLock()
 	defer hv.histogramsMu.RUnlock()
-	snaps := make([]HistogramSnapshot, 0, len(hv.histograms))
+	snaps := make([]HistogramSnapshot, 0, len(hv.histogramStorage))
 	for _, h := range hv.histogramStorage {
 		snaps = append(snaps, h.snapshot())
 	}
@@ -301,15 +620,11 @@ func (hv *HistogramVector) snapshot() []HistogramSnapshot {
 }
 
 func (hv *HistogramVector) proto() *promproto.MetricFamily {
-	hv.histogramsMu.RLock()
-	protos := make([]*promproto.Metric, 0, len(hv.histograms))
-	for _, h := range hv.histogramStorage {
+	histograms := hv.sortedHistograms(nil)
+	protos := make([]*promproto.Metric, 0, len(histograms))
+	for _, h := range histograms {
 		protos = append(protos, h.metric())
 	}
-	hv.histogramsMu.RUnlock()
-	sort.Slice(protos, func(i, j int) bool {
-		return protos[i].String() < protos[j].String()
-	})
 
 	return &promproto.MetricFamily{
 		Name:   hv.meta.Name,
@@ -319,6 +634,15 @@ func (hv *HistogramVector) proto() *promproto.MetricFamily {
 	}
 }
 
+func (hv *HistogramVector) text(w *textWriter) {
+	w.begin(hv.meta, promproto.MetricType_HISTOGRAM)
+	w.histograms = hv.sortedHistograms(w.histograms[:0])
+	for _, h := range w.histograms {
+		h.samples(w)
+		w.maybeFlush()
+	}
+}
+
 func (hv *HistogramVector) push(target push.Target) {
 	hv.histogramsMu.RLock()
 	for _, m := range hv.histogramStorage {
@@ -326,3 +650,67 @@ func (hv *HistogramVector) push(target push.Target) {
 	}
 	hv.histogramsMu.RUnlock()
 }
+
+// A CurriedHistogramVector is a HistogramVector with some of its variable
+// tags fixed. It shares its histograms with the original vector. All
+// exported methods are safe to use concurrently, and nil
+// *CurriedHistogramVectors are safe to use and always return no-op
+// histograms.
+type CurriedHistogramVector struct {
+	vec   *HistogramVector
+	curry curry
+}
+
+// Get retrieves the histogram with the supplied remaining variable tag names
+// and values, creating one if necessary. The tags must be supplied in the
+// same order used when creating the original vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (c *CurriedHistogramVector) Get(variableTagPairs ...string) (*Histogram, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.curry.validate(variableTagPairs); err != nil {
+		return nil, err
+	}
+	digester := newDigester()
+	if err := c.curry.digest(digester, variableTagPairs); err != nil {
+		digester.free()
+		return nil, err
+	}
+	var h *Histogram
+	if m, ok := c.vec.index.load(digester.digest()); ok {
+		h = m.(*Histogram)
+	} else {
+		h = c.vec.get(digester.digest(), c.curry.pairs(variableTagPairs))
+	}
+	digester.free()
+	return h, nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (c *CurriedHistogramVector) MustGet(variableTagPairs ...string) *Histogram {
+	if c == nil {
+		return nil
+	}
+	h, err := c.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get histogram: %v", err))
+	}
+	return h
+}
+
+// With fixes more of the vector's variable tags, returning an even narrower
+// vector.
+func (c *CurriedHistogramVector) With(tagPairs ...string) (*CurriedHistogramVector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	next, err := c.curry.with(tagPairs)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedHistogramVector{vec: c.vec, curry: next}, nil
+}
@@ -84,9 +84,121 @@ func TestHistogram(t *testing.T) {
 			Name:   "test_latency_ns",
 			Tags:   Tags{"foo": "bar", "service": "users"},
 			Values: []int64{10, 10, 10, 100, math.MaxInt64},
+			Buckets: []BucketSnapshot{
+				{Upper: 10, Count: 3},
+				{Upper: 50, Count: 0},
+				{Upper: 100, Count: 1},
+				{Upper: math.MaxInt64, Count: 1},
+			},
+			Count: 5,
+			Sum:   234,
 		}, got, "Unexpected histogram snapshot.")
 	})
 
+	t.Run("batched observations", func(t *testing.T) {
+		h, err := s.Histogram(HistogramSpec{
+			Spec: Spec{
+				Name: "test_batched_latency_ns",
+				Help: "Some help.",
+			},
+			Unit:    time.Nanosecond,
+			Buckets: []int64{10, 50, 100},
+		})
+		require.NoError(t, err, "Unexpected construction error.")
+
+		h.IncBucketN(5, 2)
+		h.IncBucketN(75, 1)
+		h.IncBucketN(75, 0)
+		h.IncBucketN(75, -1)
+
+		assert.Equal(t, []int64{10, 10, 100}, h.snapshot().values(), "Unexpected observations.")
+		assert.Equal(t, float64(85), h.metric().Histogram.GetSampleSum(), "Unexpected sum.")
+
+		h.ObserveN(3, 50)
+		h.ObserveN(3, 0)
+		h.ObserveMany([]time.Duration{45, 60, 1000})
+		h.ObserveMany(nil)
+		assert.Equal(t, int64(56), h.Count(), "Unexpected count after batches.")
+		assert.Equal(t, int64(85+150+45+60+1000), h.Sum(), "Unexpected sum after batches.")
+		assert.Equal(t, []BucketSnapshot{
+			{Upper: 10, Count: 52},
+			{Upper: 50, Count: 1},
+			{Upper: 100, Count: 2},
+			{Upper: math.MaxInt64, Count: 1},
+		}, h.snapshot().Buckets, "Unexpected buckets after batches.")
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		newHist := func(name string, unit time.Duration, buckets []int64) *Histogram {
+			h, err := s.Histogram(HistogramSpec{
+				Spec:    Spec{Name: name, Help: "Some help."},
+				Unit:    unit,
+				Buckets: buckets,
+			})
+			require.NoError(t, err, "Unexpected construction error.")
+			return h
+		}
+		dst := newHist("test_merge_dst_ms", time.Millisecond, []int64{10, 50})
+		src := newHist("test_merge_src_ms", time.Millisecond, []int64{10, 50})
+		dst.IncBucket(5)
+		src.IncBucketN(20, 2)
+		src.IncBucket(100)
+
+		require.NoError(t, dst.Merge(src), "Unexpected error merging histograms.")
+		require.NoError(t, dst.Merge(nil), "Unexpected error merging nil histogram.")
+		assert.Equal(t, []BucketSnapshot{
+			{Upper: 10, Count: 1},
+			{Upper: 50, Count: 2},
+			{Upper: math.MaxInt64, Count: 1},
+		}, dst.snapshot().Buckets, "Unexpected buckets after merge.")
+		assert.Equal(t, int64(145), dst.Sum(), "Unexpected sum after merge.")
+		assert.Equal(t, int64(3), src.Count(), "Merge shouldn't modify source.")
+
+		err := dst.Merge(newHist("test_merge_seconds", time.Second, []int64{10, 50}))
+		assert.Error(t, err, "Expected an error merging histograms with different units.")
+		err = dst.Merge(newHist("test_merge_other_ms", time.Millisecond, []int64{10, 60}))
+		assert.Error(t, err, "Expected an error merging histograms with different buckets.")
+		err = dst.Merge(newHist("test_merge_fewer_ms", time.Millisecond, []int64{10}))
+		assert.Error(t, err, "Expected an error merging histograms with fewer buckets.")
+		assert.Equal(t, int64(4), dst.Count(), "Failed merges shouldn't modify histogram.")
+	})
+
+	t.Run("live estimates", func(t *testing.T) {
+		h, err := s.Histogram(HistogramSpec{
+			Spec: Spec{
+				Name: "test_estimated_latency_ms",
+				Help: "Some help.",
+			},
+			Unit:    time.Millisecond,
+			Buckets: []int64{10, 20, 40},
+		})
+		require.NoError(t, err, "Unexpected construction error.")
+
+		assert.Zero(t, h.Count(), "Unexpected count for empty histogram.")
+		assert.True(t, math.IsNaN(h.Mean()), "Expected NaN mean for empty histogram.")
+		assert.True(t, math.IsNaN(h.Quantile(0.5)), "Expected NaN quantile for empty histogram.")
+
+		h.IncBucketN(4, 2)
+		h.Observe(35 * time.Millisecond)
+		h.IncBucket(38)
+		h.IncBucket(1000)
+
+		assert.Equal(t, int64(5), h.Count(), "Unexpected count.")
+		assert.Equal(t, int64(1081), h.Sum(), "Unexpected sum.")
+		assert.Equal(t, 216.2, h.Mean(), "Unexpected mean.")
+		assert.Equal(t, float64(10), h.Quantile(0.4), "Unexpected median.")
+		assert.Equal(t, float64(30), h.Quantile(0.6), "Unexpected p60.")
+		assert.Equal(t, math.Inf(1), h.Quantile(0.99), "Unexpected p99.")
+
+		snap := h.snapshot()
+		for _, q := range []float64{0, 0.25, 0.5, 0.75, 0.9} {
+			assert.Equal(t, snap.Quantile(q), h.Quantile(q), "Live and snapshot estimates differ for quantile %v.", q)
+		}
+		assertNoAllocs(t, func() {
+			h.Quantile(0.99)
+		}, "Unexpected allocations estimating quantile.")
+	})
+
 	t.Run("prometheus export", func(t *testing.T) {
 		h, err := s.Histogram(HistogramSpec{
 			Spec: Spec{
@@ -155,6 +267,13 @@ func TestHistogramVector(t *testing.T) {
 				Tags:   Tags{"var": "x"},
 				Unit:   time.Millisecond,
 				Values: []int64{1000, 1000},
+				Buckets: []BucketSnapshot{
+					{Upper: 1000, Count: 2},
+					{Upper: 60000, Count: 0},
+					{Upper: math.MaxInt64, Count: 0},
+				},
+				Count: 2,
+				Sum:   2,
 			},
 		},
 		{
@@ -181,6 +300,13 @@ func TestHistogramVector(t *testing.T) {
 				Tags:   Tags{"var": "x_"},
 				Unit:   time.Millisecond,
 				Values: []int64{1000, 1000},
+				Buckets: []BucketSnapshot{
+					{Upper: 1000, Count: 2},
+					{Upper: 60000, Count: 0},
+					{Upper: math.MaxInt64, Count: 0},
+				},
+				Count: 2,
+				Sum:   2,
 			},
 		},
 		{
@@ -247,6 +373,8 @@ func TestHistogramVectorIndependence(t *testing.T) {
 
 	x.Observe(time.Millisecond)
 	y.Observe(time.Millisecond)
+	assert.Equal(t, int64(1), x.Count(), "Unexpected count for first histogram.")
+	assert.Equal(t, float64(1000), vec.MustGet("var", "y").Quantile(1), "Unexpected max for second histogram.")
 
 	snap := root.Snapshot()
 	require.Equal(t, 2, len(snap.Histograms), "Unexpected number of histogram snapshots.")
@@ -256,21 +384,88 @@ func TestHistogramVectorIndependence(t *testing.T) {
 		Tags:   Tags{"var": "x"},
 		Unit:   time.Millisecond,
 		Values: []int64{1000},
+		Buckets: []BucketSnapshot{
+			{Upper: 1000, Count: 1},
+			{Upper: math.MaxInt64, Count: 0},
+		},
+		Count: 1,
+		Sum:   1,
 	}, snap.Histograms[0], "Unexpected first histogram snapshot.")
 	assert.Equal(t, HistogramSnapshot{
 		Name:   "test_latency_ms",
 		Tags:   Tags{"var": "y"},
 		Unit:   time.Millisecond,
 		Values: []int64{1000},
+		Buckets: []BucketSnapshot{
+			{Upper: 1000, Count: 1},
+			{Upper: math.MaxInt64, Count: 0},
+		},
+		Count: 1,
+		Sum:   1,
 	}, snap.Histograms[1], "Unexpected second histogram snapshot.")
 }
 
+func TestHistogramSnapshotEstimates(t *testing.T) {
+	snap := HistogramSnapshot{
+		Unit: time.Millisecond,
+		Buckets: []BucketSnapshot{
+			{Upper: 10, Count: 2},
+			{Upper: 20, Count: 0},
+			{Upper: 40, Count: 2},
+			{Upper: math.MaxInt64, Count: 1},
+		},
+		Count: 5,
+		Sum:   90,
+	}
+	assert.Equal(t, []int64{10, 10, 40, 40, math.MaxInt64}, snap.values(), "Unexpected observations.")
+	assert.Equal(t, float64(18), snap.Mean(), "Unexpected mean.")
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0, want: 0},
+		{q: 0.2, want: 5},
+		{q: 0.4, want: 10},
+		{q: 0.6, want: 30},
+		{q: 0.8, want: 40},
+		{q: 0.9, want: math.Inf(1)},
+		{q: -1, want: math.Inf(-1)},
+		{q: 2, want: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, snap.Quantile(tt.q), "Unexpected estimate for quantile %v.", tt.q)
+	}
+
+	empty := HistogramSnapshot{Buckets: []BucketSnapshot{{Upper: 10}, {Upper: math.MaxInt64}}}
+	assert.Nil(t, empty.values(), "Expected no observations in empty snapshot.")
+	assert.True(t, math.IsNaN(empty.Mean()), "Expected NaN mean for empty snapshot.")
+	assert.True(t, math.IsNaN(empty.Quantile(0.5)), "Expected NaN quantile for empty snapshot.")
+}
+
+func BenchmarkHistogramQuantile(b *testing.B) {
+	h, err := New().Scope().Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000},
+	})
+	require.NoError(b, err, "Unexpected construction error.")
+	for i := int64(0); i < 1000; i++ {
+		h.IncBucket(i)
+	}
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.Quantile(0.99)
+	}
+}
+
 func BenchmarkHistogram(b *testing.B) {
 	pusher := tallypush.New(tally.NoopScope)
 	name := ""
 	hist := newHistogram(metadata{
 		Name: &name,
-	}, time.Millisecond, bucketpkg.NewRPCLatency())
+	}, time.Millisecond, bucketpkg.NewRPCLatency(), systemClock{})
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,229 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The JSON exposition format groups metrics by name. Each family lists its
+// type and one series per tag set:
+//
+//	{
+//	  "requests": {
+//	    "type": "counter",
+//	    "series": [{"tags": {"service": "users"}, "value": 12}]
+//	  },
+//	  "latency_ms": {
+//	    "type": "histogram",
+//	    "unit": "1ms",
+//	    "series": [{
+//	      "tags": {"service": "users"},
+//	      "count": 3,
+//	      "sum": 140,
+//	      "buckets": [{"upper": 10, "count": 1}, {"upper": 100, "count": 2}]
+//	    }]
+//	  }
+//	}
+//
+// Histogram buckets are listed only if they contain observations. Float
+// histograms have no unit. Infinite upper bounds and sums, including the
+// upper bound of every histogram's catch-all bucket, are rendered as the
+// strings "+Inf" and "-Inf".
+type jsonFamily struct {
+	Type   string        `json:"type"`
+	Unit   string        `json:"unit,omitempty"`
+	Series []interface{} `json:"series"`
+}
+
+type jsonValue struct {
+	Tags  Tags  `json:"tags"`
+	Value int64 `json:"value"`
+}
+
+type jsonHistogram struct {
+	Tags    Tags         `json:"tags"`
+	Count   int64        `json:"count"`
+	Sum     int64        `json:"sum"`
+	Buckets []jsonBucket `json:"buckets"`
+}
+
+type jsonBucket struct {
+	Upper jsonUpper `json:"upper"`
+	Count int64     `json:"count"`
+}
+
+// A jsonUpper is an integer bucket bound that renders the catch-all bucket's
+// bound as "+Inf", like a float histogram's.
+type jsonUpper int64
+
+func (u jsonUpper) MarshalJSON() ([]byte, error) {
+	if u == math.MaxInt64 {
+		return []byte(`"+Inf"`), nil
+	}
+	return strconv.AppendInt(nil, int64(u), 10), nil
+}
+
+type jsonFloatHistogram struct {
+	Tags    Tags              `json:"tags"`
+	Count   int64             `json:"count"`
+	Sum     jsonFloat         `json:"sum"`
+	Buckets []jsonFloatBucket `json:"buckets"`
+}
+
+type jsonFloatBucket struct {
+	Upper jsonFloat `json:"upper"`
+	Count int64     `json:"count"`
+}
+
+// A jsonFloat is a float64 that renders infinities and NaN, which JSON can't
+// represent as numbers, as strings.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+// JSONHandler returns an http.Handler that renders a snapshot of the root's
+// metrics as indented JSON, which is much easier to explore with tools like
+// curl and jq than the Prometheus text format. Clients may limit the output
+// to particular metrics by supplying one or more name query parameters:
+//
+//	curl 'localhost:8080/debug/net/metrics.json?name=requests&name=latency_ms'
+//
+// Like Snapshot, the handler is relatively expensive and doesn't include
+// metrics merged in using WithGatherers or WithCollectors.
+func (r *Root) JSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var names map[string]struct{}
+		if vals := req.URL.Query()["name"]; len(vals) > 0 {
+			names = make(map[string]struct{}, len(vals))
+			for _, name := range vals {
+				names[name] = struct{}{}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r.snapshot().families(names)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Expvar adapts the root to the standard library's expvar.Var interface,
+// using the same JSON representation as JSONHandler. To expose the root's
+// metrics on the standard /debug/vars endpoint, publish it under a name of
+// your choosing:
+//
+//	expvar.Publish("metrics", root.Expvar())
+func (r *Root) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return r.snapshot().families(nil)
+	})
+}
+
+// families groups the snapshot by metric name. If names is non-nil, only the
+// named metrics are included.
+func (s *RootSnapshot) families(names map[string]struct{}) map[string]*jsonFamily {
+	fams := make(map[string]*jsonFamily)
+	family := func(name, typ string) *jsonFamily {
+		if names != nil {
+			if _, ok := names[name]; !ok {
+				return nil
+			}
+		}
+		f, ok := fams[name]
+		if !ok {
+			f = &jsonFamily{Type: typ}
+			fams[name] = f
+		}
+		return f
+	}
+
+	for _, c := range s.Counters {
+		if f := family(c.Name, "counter"); f != nil {
+			f.Series = append(f.Series, jsonValue{Tags: c.Tags, Value: c.Value})
+		}
+	}
+	for _, g := range s.Gauges {
+		if f := family(g.Name, "gauge"); f != nil {
+			f.Series = append(f.Series, jsonValue{Tags: g.Tags, Value: g.Value})
+		}
+	}
+	for _, h := range s.Histograms {
+		f := family(h.Name, "histogram")
+		if f == nil {
+			continue
+		}
+		f.Unit = h.Unit.String()
+		f.Series = append(f.Series, jsonHistogram{
+			Tags:    h.Tags,
+			Count:   h.Count,
+			Sum:     h.Sum,
+			Buckets: nonEmptyBuckets(h.Buckets),
+		})
+	}
+	for _, h := range s.FloatHistograms {
+		f := family(h.Name, "histogram")
+		if f == nil {
+			continue
+		}
+		buckets := make([]jsonFloatBucket, 0, len(h.Buckets))
+		for _, b := range h.Buckets {
+			if b.Count > 0 {
+				buckets = append(buckets, jsonFloatBucket{Upper: jsonFloat(b.Upper), Count: b.Count})
+			}
+		}
+		f.Series = append(f.Series, jsonFloatHistogram{
+			Tags:    h.Tags,
+			Count:   h.Count,
+			Sum:     jsonFloat(h.Sum),
+			Buckets: buckets,
+		})
+	}
+	return fams
+}
+
+// nonEmptyBuckets omits empty buckets, which keeps the JSON representation
+// compact.
+func nonEmptyBuckets(buckets []BucketSnapshot) []jsonBucket {
+	nonEmpty := make([]jsonBucket, 0, len(buckets))
+	for _, b := range buckets {
+		if b.Count > 0 {
+			nonEmpty = append(nonEmpty, jsonBucket{Upper: jsonUpper(b.Upper), Count: b.Count})
+		}
+	}
+	return nonEmpty
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "go.uber.org/net/metrics"
+)
+
+func newJSONRoot(t testing.TB) *Root {
+	root := New()
+	scope := root.Scope().Tagged(Tags{"service": "users"})
+
+	c, err := scope.Counter(Spec{
+		Name: "test_counter",
+		Help: "Some help.",
+	})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Add(2)
+
+	gv, err := scope.GaugeVector(Spec{
+		Name:    "test_gauge",
+		Help:    "Some help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge vector.")
+	gv.MustGet("var", "x").Store(3)
+	gv.MustGet("var", "y").Store(4)
+
+	h, err := scope.Histogram(HistogramSpec{
+		Spec: Spec{
+			Name: "test_histogram",
+			Help: "Some help.",
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50, 100},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	h.IncBucket(5)
+	h.IncBucket(40)
+	h.IncBucket(45)
+	h.IncBucket(200)
+
+	return root
+}
+
+func getJSON(t testing.TB, root *Root, query string) string {
+	srv := httptest.NewServer(root.JSONHandler())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + query)
+	require.NoError(t, err, "Unexpected error making HTTP request.")
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode, "Unexpected HTTP status code.")
+	assert.Equal(t, "application/json; charset=utf-8", res.Header.Get("Content-Type"), "Unexpected content type.")
+
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err, "Unexpected error reading response body.")
+	return string(body)
+}
+
+func TestJSONHandler(t *testing.T) {
+	root := newJSONRoot(t)
+
+	t.Run("all metrics", func(t *testing.T) {
+		assert.JSONEq(t, `{
+			"test_counter": {
+				"type": "counter",
+				"series": [{"tags": {"service": "users"}, "value": 2}]
+			},
+			"test_gauge": {
+				"type": "gauge",
+				"series": [
+					{"tags": {"service": "users", "var": "x"}, "value": 3},
+					{"tags": {"service": "users", "var": "y"}, "value": 4}
+				]
+			},
+			"test_histogram": {
+				"type": "histogram",
+				"unit": "1ms",
+				"series": [{
+					"tags": {"service": "users"},
+					"count": 4,
+					"sum": 290,
+					"buckets": [
+						{"upper": 10, "count": 1},
+						{"upper": 50, "count": 2},
+						{"upper": "+Inf", "count": 1}
+					]
+				}]
+			}
+		}`, getJSON(t, root, "/"), "Unexpected JSON output.")
+	})
+
+	t.Run("name filter", func(t *testing.T) {
+		assert.JSONEq(t, `{
+			"test_counter": {
+				"type": "counter",
+				"series": [{"tags": {"service": "users"}, "value": 2}]
+			},
+			"test_gauge": {
+				"type": "gauge",
+				"series": [
+					{"tags": {"service": "users", "var": "x"}, "value": 3},
+					{"tags": {"service": "users", "var": "y"}, "value": 4}
+				]
+			}
+		}`, getJSON(t, root, "/?name=test_counter&name=test_gauge"), "Unexpected JSON output.")
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		assert.JSONEq(t, `{}`, getJSON(t, root, "/?name=unknown"), "Unexpected JSON output.")
+	})
+}
+
+func TestJSONFloatHistogram(t *testing.T) {
+	root := New()
+	h, err := root.Scope().FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+		Buckets: []float64{-0.5, 0.5},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+	h.Observe(-1)
+	h.Observe(0.25)
+	h.Observe(math.Inf(1))
+
+	assert.JSONEq(t, `{
+		"test_ratio": {
+			"type": "histogram",
+			"series": [{
+				"tags": {},
+				"count": 3,
+				"sum": "+Inf",
+				"buckets": [
+					{"upper": -0.5, "count": 1},
+					{"upper": 0.5, "count": 1},
+					{"upper": "+Inf", "count": 1}
+				]
+			}]
+		}
+	}`, getJSON(t, root, "/"), "Unexpected JSON output.")
+}
+
+func TestExpvar(t *testing.T) {
+	root := newJSONRoot(t)
+	v := root.Expvar()
+	assert.JSONEq(t, getJSON(t, root, "/"), v.String(), "Expected expvar and HTTP handler output to match.")
+
+	c, err := root.Scope().Counter(Spec{
+		Name: "test_new_counter",
+		Help: "Some help.",
+	})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Inc()
+	assert.Contains(t, v.String(), "test_new_counter", "Expected expvar output to reflect new metrics.")
+}
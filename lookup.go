@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import "sync/atomic"
+
+// A VectorKey identifies one metric in a vector by its variable tags.
+// Creating a key scrubs and digests the tag values up front, so looking up a
+// metric by key is cheaper than calling Get; callers on hot paths can create
+// keys once and reuse them. Keys aren't validated until they're used.
+//
+// Keys are immutable and safe to share between goroutines. A key may be used
+// with any vector whose variable tag names match its own.
+//
+// Keys are scrubbed with StrictScrubPolicy. In roots configured with another
+// policy, Lookup scrubs the key's tag values again, so it's no faster than
+// Get.
+type VectorKey struct {
+	digest []byte
+	pairs  []string
+}
+
+// NewVectorKey creates a key from variable tag names and values, supplied in
+// the same order Get expects.
+func NewVectorKey(variableTagPairs ...string) VectorKey {
+	d := newDigester()
+	for i := 0; i < len(variableTagPairs)/2; i++ {
+		d.add("", scrubTagValue(variableTagPairs[i*2+1]))
+	}
+	key := VectorKey{
+		digest: append([]byte(nil), d.digest()...),
+		pairs:  append([]string(nil), variableTagPairs...),
+	}
+	d.free()
+	return key
+}
+
+// A readMap indexes a vector's metrics by their digested variable tags. It's
+// optimized for the common case, in which nearly every lookup finds an
+// existing metric: those lookups are lock-free and don't allocate.
+//
+// Like sync.Map, it keeps two maps. The read map is never modified once
+// published, so readers can use it without locking. New entries go into a
+// dirty map, which holds a superset of the read map's entries and is
+// published once enough lookups have fallen through to it. The owning vector
+// must hold its write lock while calling any method except load.
+type readMap struct {
+	read   atomic.Value           // map[string]interface{}
+	dirty  map[string]interface{} // nil if read is up to date
+	misses int                    // lookups satisfied by dirty since it was created
+}
+
+// load finds an entry in the read map.
+func (rm *readMap) load(key []byte) (interface{}, bool) {
+	read, _ := rm.read.Load().(map[string]interface{})
+	v, ok := read[string(key)]
+	return v, ok
+}
+
+// loadLocked finds an entry in either map.
+func (rm *readMap) loadLocked(key []byte) (interface{}, bool) {
+	if v, ok := rm.load(key); ok {
+		return v, true
+	}
+	if rm.dirty == nil {
+		return nil, false
+	}
+	v, ok := rm.dirty[string(key)]
+	if ok {
+		rm.missLocked()
+	}
+	return v, ok
+}
+
+// storeLocked adds a new entry.
+func (rm *readMap) storeLocked(key []byte, v interface{}) {
+	if rm.dirty == nil {
+		read, _ := rm.read.Load().(map[string]interface{})
+		rm.dirty = make(map[string]interface{}, len(read)+1)
+		for k, v := range read {
+			rm.dirty[k] = v
+		}
+	}
+	rm.dirty[string(key)] = v
+	rm.missLocked()
+}
+
+// resetLocked removes all entries.
+func (rm *readMap) resetLocked() {
+	rm.read.Store(map[string]interface{}{})
+	rm.dirty = nil
+	rm.misses = 0
+}
+
+// missLocked publishes the dirty map once the work done falling through to
+// it outweighs the cost of copying it, which keeps inserts amortized O(1).
+func (rm *readMap) missLocked() {
+	rm.misses++
+	if rm.misses < len(rm.dirty) {
+		return
+	}
+	rm.read.Store(rm.dirty)
+	rm.dirty = nil
+	rm.misses = 0
+}
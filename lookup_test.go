@@ -0,0 +1,192 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorLookup(t *testing.T) {
+	scope := New().Scope()
+	spec := Spec{Name: "test", Help: "Some help.", VarTags: []string{"foo"}}
+	cv, err := scope.CounterVector(spec)
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	spec.Name = "test_gauge"
+	gv, err := scope.GaugeVector(spec)
+	require.NoError(t, err, "Unexpected error constructing gauge vector.")
+	spec.Name = "test_histogram"
+	hv, err := scope.HistogramVector(HistogramSpec{Spec: spec, Unit: time.Millisecond, Buckets: []int64{10}})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+	spec.Name = "test_float_histogram"
+	fv, err := scope.FloatHistogramVector(FloatHistogramSpec{Spec: spec, Buckets: []float64{1}})
+	require.NoError(t, err, "Unexpected error constructing float histogram vector.")
+
+	// Keys scrub tag values just like Get, and they're usable with any
+	// vector with matching tag names.
+	key := NewVectorKey("foo", "bar baz")
+
+	t.Run("counter", func(t *testing.T) {
+		c, err := cv.Lookup(key)
+		require.NoError(t, err, "Unexpected error looking up counter.")
+		assert.True(t, c == cv.MustGet("foo", "bar baz"), "Expected Lookup and Get to return the same counter.")
+	})
+
+	t.Run("gauge", func(t *testing.T) {
+		g, err := gv.Lookup(key)
+		require.NoError(t, err, "Unexpected error looking up gauge.")
+		assert.True(t, g == gv.MustGet("foo", "bar_baz"), "Expected Lookup and Get to return the same gauge.")
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		h, err := hv.Lookup(key)
+		require.NoError(t, err, "Unexpected error looking up histogram.")
+		assert.True(t, h == hv.MustGet("foo", "bar baz"), "Expected Lookup and Get to return the same histogram.")
+	})
+
+	t.Run("float histogram", func(t *testing.T) {
+		h, err := fv.Lookup(key)
+		require.NoError(t, err, "Unexpected error looking up float histogram.")
+		assert.True(t, h == fv.MustGet("foo", "bar baz"), "Expected Lookup and Get to return the same histogram.")
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, k := range []VectorKey{{}, NewVectorKey("bar", "baz"), NewVectorKey("foo", "bar", "baz", "quux")} {
+			_, err := cv.Lookup(k)
+			assert.Error(t, err, "Expected an error looking up counter with key %v.", k.pairs)
+			_, err = gv.Lookup(k)
+			assert.Error(t, err, "Expected an error looking up gauge with key %v.", k.pairs)
+			_, err = hv.Lookup(k)
+			assert.Error(t, err, "Expected an error looking up histogram with key %v.", k.pairs)
+			_, err = fv.Lookup(k)
+			assert.Error(t, err, "Expected an error looking up float histogram with key %v.", k.pairs)
+		}
+	})
+
+	t.Run("key doesn't alias input", func(t *testing.T) {
+		pairs := []string{"foo", "one"}
+		k := NewVectorKey(pairs...)
+		pairs[1] = "two"
+		c, err := cv.Lookup(k)
+		require.NoError(t, err, "Unexpected error looking up counter.")
+		assert.Equal(t, Tags{"foo": "one"}, c.snapshot().Tags, "Unexpected tags.")
+	})
+}
+
+func TestVectorLookupAllocations(t *testing.T) {
+	scope := New().Scope()
+	cv, err := scope.CounterVector(Spec{Name: "test_counter", Help: "Some help.", VarTags: []string{"foo"}})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	hv, err := scope.HistogramVector(HistogramSpec{
+		Spec:    Spec{Name: "test_histogram", Help: "Some help.", VarTags: []string{"foo"}},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+
+	key := NewVectorKey("foo", "bar")
+	for i := 0; i < 100; i++ {
+		// Create some extra metrics, so that lookups must fall through to
+		// the dirty map until it's published.
+		cv.MustGet("foo", fmt.Sprint(i))
+		hv.MustGet("foo", fmt.Sprint(i))
+	}
+	cv.MustGet("foo", "bar")
+	hv.MustGet("foo", "bar")
+	for i := 0; i < 200; i++ {
+		cv.MustGet("foo", "bar")
+		hv.MustGet("foo", "bar")
+	}
+
+	assertNoAllocs(t, func() {
+		cv.MustGet("foo", "bar").Inc()
+		hv.MustGet("foo", "bar").IncBucket(1)
+	}, "Expected Get to be allocation-free for existing metrics.")
+	assertNoAllocs(t, func() {
+		c, _ := cv.Lookup(key)
+		c.Inc()
+		h, _ := hv.Lookup(key)
+		h.IncBucket(1)
+	}, "Expected Lookup to be allocation-free for existing metrics.")
+}
+
+func TestVectorConcurrentCreation(t *testing.T) {
+	cv, err := New().Scope().CounterVector(Spec{Name: "test", Help: "Some help.", VarTags: []string{"foo"}})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+
+	const goroutines, tags = 8, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < tags; i++ {
+				cv.MustGet("foo", fmt.Sprint(i)).Inc()
+				c, err := cv.Lookup(NewVectorKey("foo", fmt.Sprint(i)))
+				assert.NoError(t, err, "Unexpected error looking up counter.")
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	snaps := cv.snapshot()
+	require.Equal(t, tags, len(snaps), "Unexpected number of counters.")
+	for _, s := range snaps {
+		assert.Equal(t, int64(2*goroutines), s.Value, "Unexpected value for counter %v.", s.Tags)
+	}
+}
+
+func TestReadMap(t *testing.T) {
+	var rm readMap
+	_, ok := rm.load([]byte("foo"))
+	assert.False(t, ok, "Expected empty map to have no entries.")
+
+	rm.storeLocked([]byte("foo"), 1)
+	rm.storeLocked([]byte("bar"), 2)
+	_, ok = rm.load([]byte("bar"))
+	assert.False(t, ok, "Expected new entries to start in the dirty map.")
+	v, ok := rm.loadLocked([]byte("bar"))
+	assert.True(t, ok, "Expected to find new entries with loadLocked.")
+	assert.Equal(t, 2, v, "Unexpected value.")
+
+	v, ok = rm.load([]byte("bar"))
+	assert.True(t, ok, "Expected dirty map to be published after enough misses.")
+	assert.Equal(t, 2, v, "Unexpected value.")
+	v, ok = rm.load([]byte("foo"))
+	assert.True(t, ok, "Expected published map to include older entries.")
+	assert.Equal(t, 1, v, "Unexpected value.")
+}
+
+// assertNoAllocs asserts that f doesn't allocate. Since sync.Pool drops items
+// at random in race builds, the assertion is skipped there.
+func assertNoAllocs(t testing.TB, f func(), msg string) {
+	t.Helper()
+	if raceEnabled {
+		return
+	}
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, f), msg)
+}
@@ -40,12 +40,16 @@ type metadata struct {
 	Name, Help  *string // proto wants pointers
 	Dims        string
 	DisablePush bool
+	Striped     bool
+	internal    bool // created by the root, not by users
 
 	constTagPairs []*promproto.LabelPair
 	varTagNames   []string // unscrubbed
+	scrubber      scrubber
 }
 
-func newMetadata(o Spec) (metadata, error) {
+func newMetadata(o Spec, s scrubber) (metadata, error) {
+	m := metadata{scrubber: s}
 	// TODO: Consider checking for duplicate tags with Bloom filters, allocating
 	// maps only if we suspect a duplicate.
 	sortedConstNames := make([]string, 0, len(o.ConstTags))
@@ -58,19 +62,29 @@ func newMetadata(o Spec) (metadata, error) {
 	sortedScrubbedConstNames := make([]string, len(sortedConstNames))
 	sortedScrubbedConstVals := make([]string, len(sortedConstNames))
 	for i, name := range sortedConstNames {
-		scrubbedName := scrubName(name)
+		scrubbedName, err := m.scrubName(name)
+		if err != nil {
+			return metadata{}, err
+		}
+		scrubbedVal, err := m.scrubTagValue(o.ConstTags[name])
+		if err != nil {
+			return metadata{}, err
+		}
 		if _, ok := constNameSet[scrubbedName]; ok {
 			return metadata{}, fmt.Errorf("duplicate constant tag name %q", scrubbedName)
 		}
 		constNameSet[scrubbedName] = struct{}{}
 		sortedScrubbedConstNames[i] = scrubbedName
-		sortedScrubbedConstVals[i] = scrubTagValue(o.ConstTags[name])
+		sortedScrubbedConstVals[i] = scrubbedVal
 	}
 
 	varNameSet := make(map[string]struct{}, len(o.VarTags))
 	sortedScrubbedVarNames := make([]string, len(o.VarTags))
 	for i, name := range o.VarTags {
-		scrubbedName := scrubName(name)
+		scrubbedName, err := m.scrubName(name)
+		if err != nil {
+			return metadata{}, err
+		}
 		if _, ok := varNameSet[scrubbedName]; ok {
 			return metadata{}, fmt.Errorf("duplicate variable tag name %q", scrubbedName)
 		}
@@ -92,15 +106,46 @@ func newMetadata(o Spec) (metadata, error) {
 			})
 		}
 	}
-	scrubbedName := scrubName(o.Name)
-	return metadata{
-		Name:          &scrubbedName,
-		Help:          &o.Help,
-		Dims:          makeDims(scrubbedName, sortedScrubbedConstNames, sortedScrubbedVarNames),
-		DisablePush:   o.DisablePush,
-		constTagPairs: pairs,
-		varTagNames:   o.VarTags, // preserve user-defined order
-	}, nil
+	scrubbedName, err := m.scrubName(o.Name)
+	if err != nil {
+		return metadata{}, err
+	}
+	m.Name = &scrubbedName
+	m.Help = &o.Help
+	m.Dims = makeDims(scrubbedName, sortedScrubbedConstNames, sortedScrubbedVarNames)
+	m.DisablePush = o.DisablePush
+	m.constTagPairs = pairs
+	m.varTagNames = o.VarTags // preserve user-defined order
+	return m, nil
+}
+
+func (m *metadata) scrubName(s string) (string, error) {
+	return m.scrubber.name(s)
+}
+
+func (m *metadata) scrubTagValue(s string) (string, error) {
+	return m.scrubber.tagValue(s)
+}
+
+// varTagName returns the ith variable tag name, scrubbed. Since the names
+// were validated (and any scrubbing reported) by newMetadata, scrubbing them
+// again can't fail.
+func (m metadata) varTagName(i int) string {
+	name, _ := m.scrubber.scrubPolicy().ScrubName(m.varTagNames[i])
+	return name
+}
+
+// digestVariableTags adds the scrubbed variable tag values to the digester.
+// It returns an error if the scrub policy rejects a value.
+func (m *metadata) digestVariableTags(d *digester, variableTagPairs []string) error {
+	for i := 0; i < len(variableTagPairs)/2; i++ {
+		val, err := m.scrubber.tagValue(variableTagPairs[i*2+1])
+		if err != nil {
+			return err
+		}
+		d.add("", val)
+	}
+	return nil
 }
 
 // MergeTags merges variable and constant tags.
@@ -112,8 +157,10 @@ func (m metadata) MergeTags(variableTagPairs []string) []*promproto.LabelPair {
 	pairs := make([]*promproto.LabelPair, 0, n)
 	pairs = append(pairs, m.constTagPairs...)
 	for i := range m.varTagNames { // user-supplied order was preserved
-		name := scrubName(m.varTagNames[i])
-		val := scrubTagValue(variableTagPairs[i*2+1])
+		// Vectors have already checked that the policy accepts these values
+		// and reported any scrubbing.
+		name := m.varTagName(i)
+		val, _ := m.scrubber.scrubPolicy().ScrubTagValue(variableTagPairs[i*2+1])
 		pairs = append(pairs, &promproto.LabelPair{
 			Name:  &name,
 			Value: &val,
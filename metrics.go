@@ -21,6 +21,8 @@
 package metrics
 
 import (
+	"sort"
+
 	promproto "github.com/prometheus/client_model/go"
 	"go.uber.org/net/metrics/push"
 )
@@ -28,5 +30,26 @@ import (
 type metric interface {
 	describe() metadata
 	proto() *promproto.MetricFamily
+	text(*textWriter)
 	push(push.Target)
 }
+
+// A resetter is a metric that can be reset by Scope.Reset.
+type resetter interface {
+	reset()
+}
+
+// A child is a metric that can be part of a vector.
+type child interface {
+	metric
+
+	labels() string      // sort key
+	samples(*textWriter) // text output without a family header
+}
+
+// sortChildren orders children by their labels.
+func sortChildren(children []child) {
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].labels() < children[j].labels()
+	})
+}
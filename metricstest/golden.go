@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metricstest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/net/metrics"
+)
+
+// UpdateGoldenEnv is the name of an environment variable that controls
+// AssertGolden. If it's set to a non-empty value, AssertGolden overwrites
+// golden files instead of comparing them:
+//
+//	METRICSTEST_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "METRICSTEST_UPDATE_GOLDEN"
+
+// AssertGolden asserts that the root's Prometheus text output (as served by
+// its ServeHTTP method) matches the contents of the file at path. To create
+// or update golden files, set the environment variable named by
+// UpdateGoldenEnv. It reports whether the assertion succeeded.
+func AssertGolden(t TestingT, root *metrics.Root, path string) bool {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("unexpected status code %d scraping metrics: %s", rec.Code, rec.Body.String())
+		return false
+	}
+	got := rec.Body.Bytes()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("can't create directory for golden file: %v", err)
+			return false
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Errorf("can't update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("can't read golden file (set %s=1 to create it): %v", UpdateGoldenEnv, err)
+		return false
+	}
+	if bytes.Equal(want, got) {
+		return true
+	}
+	wantLines := bytes.Split(want, []byte("\n"))
+	gotLines := bytes.Split(got, []byte("\n"))
+	line := 0
+	for line < len(wantLines) && line < len(gotLines) && bytes.Equal(wantLines[line], gotLines[line]) {
+		line++
+	}
+	var wantLine, gotLine []byte
+	if line < len(wantLines) {
+		wantLine = wantLines[line]
+	}
+	if line < len(gotLines) {
+		gotLine = gotLines[line]
+	}
+	t.Errorf("metrics don't match golden file %s (set %s=1 to update it)\n"+
+		"first difference on line %d:\n  expected: %q\n  actual:   %q\n\nfull output:\n%s",
+		path, UpdateGoldenEnv, line+1, wantLine, gotLine, got)
+	return false
+}
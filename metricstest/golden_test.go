@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metricstest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertGolden(t *testing.T) {
+	root := newRoot(t)
+
+	t.Run("match", func(t *testing.T) {
+		assert.True(t, AssertGolden(t, root, "testdata/golden.txt"), "Expected output to match golden file.")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		rec := &recordingT{}
+		assert.False(t, AssertGolden(rec, root, "testdata/golden_mismatch.txt"), "Expected golden assertion to fail.")
+		require.Equal(t, 1, len(rec.errors), "Unexpected number of failures.")
+		assert.Contains(t, rec.errors[0], "first difference on line 3", "Expected failure to point out first difference.")
+		assert.Contains(t, rec.errors[0], `expected: "test_counter{service=\"users\",var=\"x\"} 1"`, "Expected failure to include golden line.")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		rec := &recordingT{}
+		assert.False(t, AssertGolden(rec, root, "testdata/missing.txt"), "Expected golden assertion to fail.")
+		require.Equal(t, 1, len(rec.errors), "Unexpected number of failures.")
+		assert.Contains(t, rec.errors[0], UpdateGoldenEnv, "Expected failure to explain how to create golden file.")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "metricstest")
+		require.NoError(t, err, "Unexpected error creating temporary directory.")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "nested", "golden.txt")
+
+		defer os.Unsetenv(UpdateGoldenEnv)
+		require.NoError(t, os.Setenv(UpdateGoldenEnv, "1"), "Unexpected error setting environment variable.")
+		assert.True(t, AssertGolden(t, root, path), "Expected update to succeed.")
+		require.NoError(t, os.Unsetenv(UpdateGoldenEnv), "Unexpected error unsetting environment variable.")
+
+		assert.True(t, AssertGolden(t, root, path), "Expected output to match updated golden file.")
+		want, err := ioutil.ReadFile("testdata/golden.txt")
+		require.NoError(t, err, "Unexpected error reading golden file.")
+		got, err := ioutil.ReadFile(path)
+		require.NoError(t, err, "Unexpected error reading updated golden file.")
+		assert.Equal(t, string(want), string(got), "Unexpected contents in updated golden file.")
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package metricstest provides helpers for testing code instrumented with
+// go.uber.org/net/metrics. It includes assertions about the current values of
+// metrics, golden-file comparisons of a root's Prometheus text output, and a
+// push.Target that records every value pushed to it.
+package metricstest // import "go.uber.org/net/metrics/metricstest"
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.uber.org/net/metrics"
+)
+
+// TestingT is the subset of testing.TB used by this package's assertions.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// AssertCounter asserts that the root contains a counter with the supplied
+// name and tags, and that the counter's value is want. Tags must match
+// exactly, including any constant tags added by scopes. It reports whether
+// the assertion succeeded.
+func AssertCounter(t TestingT, root *metrics.Root, name string, tags metrics.Tags, want int64) bool {
+	t.Helper()
+	return assertValue(t, "counter", root.Snapshot().Counters, name, tags, want)
+}
+
+// AssertGauge asserts that the root contains a gauge with the supplied name
+// and tags, and that the gauge's value is want. Tags must match exactly,
+// including any constant tags added by scopes. It reports whether the
+// assertion succeeded.
+func AssertGauge(t TestingT, root *metrics.Root, name string, tags metrics.Tags, want int64) bool {
+	t.Helper()
+	return assertValue(t, "gauge", root.Snapshot().Gauges, name, tags, want)
+}
+
+// AssertHistogram asserts that the root contains a histogram with the
+// supplied name and tags, and that the histogram's observations (rounded up
+// to their bucket's upper bound, as in metrics.HistogramSnapshot.Values) are
+// want.
+// Tags must match exactly, including any constant tags added by scopes. It
+// reports whether the assertion succeeded.
+func AssertHistogram(t TestingT, root *metrics.Root, name string, tags metrics.Tags, want []int64) bool {
+	t.Helper()
+	var candidates []metrics.Tags
+	for _, h := range root.Snapshot().Histograms {
+		if h.Name != name {
+			continue
+		}
+		if !tagsEqual(h.Tags, tags) {
+			candidates = append(candidates, h.Tags)
+			continue
+		}
+		got := h.Values
+		if len(want) == 0 && len(got) == 0 {
+			return true
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("histogram %q with tags %v: expected observations %v, got %v", name, tags, want, got)
+			return false
+		}
+		return true
+	}
+	t.Errorf("%s", notFound("histogram", name, tags, candidates))
+	return false
+}
+
+func assertValue(t TestingT, kind string, snaps []metrics.Snapshot, name string, tags metrics.Tags, want int64) bool {
+	t.Helper()
+	var candidates []metrics.Tags
+	for _, s := range snaps {
+		if s.Name != name {
+			continue
+		}
+		if !tagsEqual(s.Tags, tags) {
+			candidates = append(candidates, s.Tags)
+			continue
+		}
+		if s.Value != want {
+			t.Errorf("%s %q with tags %v: expected %d, got %d", kind, name, tags, want, s.Value)
+			return false
+		}
+		return true
+	}
+	t.Errorf("%s", notFound(kind, name, tags, candidates))
+	return false
+}
+
+func notFound(kind, name string, tags metrics.Tags, candidates []metrics.Tags) string {
+	msg := fmt.Sprintf("no %s %q with tags %v", kind, name, tags)
+	if len(candidates) > 0 {
+		msg += fmt.Sprintf("; found %s %q with tags %v", kind, name, candidates)
+	}
+	return msg
+}
+
+func tagsEqual(left, right metrics.Tags) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for k, v := range left {
+		if rv, ok := right[k]; !ok || rv != v {
+			return false
+		}
+	}
+	return true
+}
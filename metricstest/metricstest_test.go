@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metricstest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+)
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Helper() {}
+
+func newRoot(t testing.TB) *metrics.Root {
+	root := metrics.New()
+	scope := root.Scope().Tagged(metrics.Tags{"service": "users"})
+
+	c, err := scope.CounterVector(metrics.Spec{
+		Name:    "test_counter",
+		Help:    "Some help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	c.MustGet("var", "x").Add(2)
+
+	g, err := scope.Gauge(metrics.Spec{Name: "test_gauge", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+	g.Store(3)
+
+	h, err := scope.Histogram(metrics.HistogramSpec{
+		Spec:    metrics.Spec{Name: "test_latency_ms", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	h.IncBucket(5)
+	h.IncBucket(20)
+
+	_, err = scope.Histogram(metrics.HistogramSpec{
+		Spec:    metrics.Spec{Name: "test_empty_latency_ms", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+
+	return root
+}
+
+func TestAssertions(t *testing.T) {
+	root := newRoot(t)
+	tags := metrics.Tags{"service": "users"}
+	varTags := metrics.Tags{"service": "users", "var": "x"}
+
+	t.Run("success", func(t *testing.T) {
+		rec := &recordingT{}
+		assert.True(t, AssertCounter(rec, root, "test_counter", varTags, 2), "Expected counter assertion to succeed.")
+		assert.True(t, AssertGauge(rec, root, "test_gauge", tags, 3), "Expected gauge assertion to succeed.")
+		assert.True(t, AssertHistogram(rec, root, "test_latency_ms", tags, []int64{10, 50}), "Expected histogram assertion to succeed.")
+		assert.True(t, AssertHistogram(rec, root, "test_empty_latency_ms", tags, nil), "Expected histogram assertion to succeed.")
+		assert.Empty(t, rec.errors, "Unexpected failures.")
+	})
+
+	tests := []struct {
+		desc   string
+		assert func(TestingT) bool
+		want   string
+	}{
+		{
+			desc:   "wrong counter value",
+			assert: func(t TestingT) bool { return AssertCounter(t, root, "test_counter", varTags, 1) },
+			want:   `counter "test_counter" with tags map[service:users var:x]: expected 1, got 2`,
+		},
+		{
+			desc:   "wrong counter tags",
+			assert: func(t TestingT) bool { return AssertCounter(t, root, "test_counter", tags, 2) },
+			want:   `no counter "test_counter" with tags map[service:users]; found counter "test_counter" with tags [map[service:users var:x]]`,
+		},
+		{
+			desc:   "missing gauge",
+			assert: func(t TestingT) bool { return AssertGauge(t, root, "test_counter", varTags, 2) },
+			want:   `no gauge "test_counter" with tags map[service:users var:x]`,
+		},
+		{
+			desc:   "wrong gauge value",
+			assert: func(t TestingT) bool { return AssertGauge(t, root, "test_gauge", tags, 4) },
+			want:   `gauge "test_gauge" with tags map[service:users]: expected 4, got 3`,
+		},
+		{
+			desc:   "wrong histogram observations",
+			assert: func(t TestingT) bool { return AssertHistogram(t, root, "test_latency_ms", tags, []int64{10}) },
+			want:   `histogram "test_latency_ms" with tags map[service:users]: expected observations [10], got [10 50]`,
+		},
+		{
+			desc:   "missing histogram",
+			assert: func(t TestingT) bool { return AssertHistogram(t, root, "test_latency_ms", nil, nil) },
+			want:   `no histogram "test_latency_ms" with tags map[]; found histogram "test_latency_ms" with tags [map[service:users]]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			rec := &recordingT{}
+			assert.False(t, tt.assert(rec), "Expected assertion to fail.")
+			assert.Equal(t, []string{tt.want}, rec.errors, "Unexpected failure message.")
+		})
+	}
+}
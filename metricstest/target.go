@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metricstest
+
+import (
+	"sync"
+
+	"go.uber.org/net/metrics/push"
+)
+
+var (
+	_ push.Target  = (*Target)(nil)
+	_ push.Flusher = (*Target)(nil)
+)
+
+// A Value records a single call to a pushed counter or gauge's Set method.
+type Value struct {
+	Name  string
+	Tags  map[string]string
+	Value int64
+}
+
+// A BucketValue records a single call to a pushed histogram's Set or
+// SetIndex method. Calls to Set have an Index of -1.
+type BucketValue struct {
+	Name  string
+	Tags  map[string]string
+	Index int
+	Upper int64 // inclusive upper bound
+	Total int64
+}
+
+// A FloatBucketValue records a single call to a pushed float histogram's
+// SetFloatIndex method.
+type FloatBucketValue struct {
+	Name  string
+	Tags  map[string]string
+	Index int
+	Upper float64 // inclusive upper bound
+	Total int64
+}
+
+// A Tick records all the values pushed during a single export, in the order
+// they were pushed.
+type Tick struct {
+	Counters   []Value
+	Gauges     []Value
+	Histograms []BucketValue
+
+	FloatHistograms []FloatBucketValue
+}
+
+// A Target is a push.Target that records every value pushed to it. Unlike
+// most push.Targets, it's safe for concurrent use, so tests can inspect the
+// recorded values while a metrics.Root is pushing to it.
+type Target struct {
+	mu      sync.Mutex
+	current Tick
+	ticks   []Tick
+}
+
+// NewTarget creates a recording push.Target.
+func NewTarget() *Target {
+	return &Target{}
+}
+
+// Ticks returns the values recorded during each completed export.
+func (t *Target) Ticks() []Tick {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Tick(nil), t.ticks...)
+}
+
+// Flush implements push.Flusher. A metrics.Root calls it after each push,
+// completing the current tick.
+func (t *Target) Flush() {
+	t.mu.Lock()
+	t.ticks = append(t.ticks, t.current)
+	t.current = Tick{}
+	t.mu.Unlock()
+}
+
+// NewCounter implements push.Target.
+func (t *Target) NewCounter(spec push.Spec) push.Counter {
+	return &recordingValue{target: t, spec: spec, counter: true}
+}
+
+// NewGauge implements push.Target.
+func (t *Target) NewGauge(spec push.Spec) push.Gauge {
+	return &recordingValue{target: t, spec: spec}
+}
+
+// NewHistogram implements push.Target.
+func (t *Target) NewHistogram(spec push.HistogramSpec) push.Histogram {
+	return &recordingHistogram{target: t, spec: spec.Spec}
+}
+
+type recordingValue struct {
+	target  *Target
+	spec    push.Spec
+	counter bool
+}
+
+func (v *recordingValue) Set(total int64) {
+	val := Value{Name: v.spec.Name, Tags: v.spec.Tags, Value: total}
+	t := v.target
+	t.mu.Lock()
+	if v.counter {
+		t.current.Counters = append(t.current.Counters, val)
+	} else {
+		t.current.Gauges = append(t.current.Gauges, val)
+	}
+	t.mu.Unlock()
+}
+
+type recordingHistogram struct {
+	target *Target
+	spec   push.Spec
+}
+
+func (h *recordingHistogram) Set(bucket, total int64) {
+	h.SetIndex(-1, bucket, total)
+}
+
+func (h *recordingHistogram) SetIndex(index int, bucket, total int64) {
+	t := h.target
+	t.mu.Lock()
+	t.current.Histograms = append(t.current.Histograms, BucketValue{
+		Name:  h.spec.Name,
+		Tags:  h.spec.Tags,
+		Index: index,
+		Upper: bucket,
+		Total: total,
+	})
+	t.mu.Unlock()
+}
+
+func (h *recordingHistogram) SetFloatIndex(index int, bucket float64, total int64) {
+	t := h.target
+	t.mu.Lock()
+	t.current.FloatHistograms = append(t.current.FloatHistograms, FloatBucketValue{
+		Name:  h.spec.Name,
+		Tags:  h.spec.Tags,
+		Index: index,
+		Upper: bucket,
+		Total: total,
+	})
+	t.mu.Unlock()
+}
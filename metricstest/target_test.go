@@ -0,0 +1,107 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metricstest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics/push"
+)
+
+func TestTarget(t *testing.T) {
+	root := newRoot(t)
+	target := NewTarget()
+
+	stop, err := root.Push(target, time.Hour)
+	require.NoError(t, err, "Unexpected error starting push.")
+	stop() // pushes once more before returning
+
+	ticks := target.Ticks()
+	require.Equal(t, 1, len(ticks), "Unexpected number of ticks.")
+	tags := map[string]string{"service": "users"}
+	assert.Equal(t, Tick{
+		Counters: []Value{
+			{Name: "test_counter", Tags: map[string]string{"service": "users", "var": "x"}, Value: 2},
+		},
+		Gauges: []Value{
+			{Name: "test_gauge", Tags: tags, Value: 3},
+		},
+		Histograms: []BucketValue{
+			{Name: "test_latency_ms", Tags: tags, Index: 0, Upper: 10, Total: 1},
+			{Name: "test_latency_ms", Tags: tags, Index: 1, Upper: 50, Total: 1},
+			{Name: "test_latency_ms", Tags: tags, Index: 2, Upper: math.MaxInt64, Total: 0},
+			{Name: "test_empty_latency_ms", Tags: tags, Index: 0, Upper: 10, Total: 0},
+			{Name: "test_empty_latency_ms", Tags: tags, Index: 1, Upper: 50, Total: 0},
+			{Name: "test_empty_latency_ms", Tags: tags, Index: 2, Upper: math.MaxInt64, Total: 0},
+		},
+	}, ticks[0], "Unexpected recorded values.")
+}
+
+func TestTargetTicks(t *testing.T) {
+	target := NewTarget()
+	assert.Empty(t, target.Ticks(), "Expected no ticks before first flush.")
+
+	c := target.NewCounter(pushSpec("counter"))
+	c.Set(1)
+	target.Flush()
+	c.Set(2)
+	target.NewHistogram(pushHistogramSpec("histogram")).Set(10, 3)
+	target.Flush()
+	target.Flush()
+
+	assert.Equal(t, []Tick{
+		{Counters: []Value{{Name: "counter", Value: 1}}},
+		{
+			Counters:   []Value{{Name: "counter", Value: 2}},
+			Histograms: []BucketValue{{Name: "histogram", Index: -1, Upper: 10, Total: 3}},
+		},
+		{},
+	}, target.Ticks(), "Unexpected ticks.")
+}
+
+func TestTargetFloatHistogram(t *testing.T) {
+	target := NewTarget()
+	h := target.NewHistogram(push.HistogramSpec{Spec: pushSpec("ratio"), FloatBuckets: []float64{0.5}})
+	fh, ok := h.(push.FloatHistogram)
+	require.True(t, ok, "Expected recorded histograms to support float bounds.")
+	fh.SetFloatIndex(0, 0.5, 2)
+	fh.SetFloatIndex(1, math.Inf(1), 1)
+	target.Flush()
+
+	assert.Equal(t, []Tick{{
+		FloatHistograms: []FloatBucketValue{
+			{Name: "ratio", Index: 0, Upper: 0.5, Total: 2},
+			{Name: "ratio", Index: 1, Upper: math.Inf(1), Total: 1},
+		},
+	}}, target.Ticks(), "Unexpected ticks.")
+}
+
+func pushSpec(name string) push.Spec {
+	return push.Spec{Name: name}
+}
+
+func pushHistogramSpec(name string) push.HistogramSpec {
+	return push.HistogramSpec{Spec: pushSpec(name), Buckets: []int64{10}}
+}
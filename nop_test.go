@@ -21,6 +21,7 @@
 package metrics
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -36,6 +37,14 @@ func TestNopCounterVector(t *testing.T) {
 	assertNopCounterVector(t, nil)
 }
 
+func TestNopStripedCounter(t *testing.T) {
+	assertNopStripedCounter(t, nil)
+}
+
+func TestNopStripedCounterVector(t *testing.T) {
+	assertNopStripedCounterVector(t, nil)
+}
+
 func TestNopGauge(t *testing.T) {
 	assertNopGauge(t, nil)
 }
@@ -55,6 +64,7 @@ func TestNopHistogramVector(t *testing.T) {
 func TestNopScope(t *testing.T) {
 	var s *Scope
 	s = s.Tagged(Tags{"foo": "bar"})
+	assert.NotPanics(t, s.Reset, "Failed Reset on nil scope.")
 	c, err := s.Counter(Spec{})
 	assert.NoError(t, err, "Error calling Counter on nil scope.")
 	assertNopCounter(t, c)
@@ -63,6 +73,14 @@ func TestNopScope(t *testing.T) {
 	assert.NoError(t, err, "Error calling CounterVector on nil scope.")
 	assertNopCounterVector(t, cv)
 
+	sc, err := s.StripedCounter(Spec{})
+	assert.NoError(t, err, "Error calling StripedCounter on nil scope.")
+	assertNopStripedCounter(t, sc)
+
+	scv, err := s.StripedCounterVector(Spec{})
+	assert.NoError(t, err, "Error calling StripedCounterVector on nil scope.")
+	assertNopStripedCounterVector(t, scv)
+
 	g, err := s.Gauge(Spec{})
 	assert.NoError(t, err, "Error calling Gauge on nil scope.")
 	assertNopGauge(t, g)
@@ -78,12 +96,29 @@ func TestNopScope(t *testing.T) {
 	hv, err := s.HistogramVector(HistogramSpec{})
 	assert.NoError(t, err, "Error calling HistogramVector on nil scope.")
 	assertNopHistogramVector(t, hv)
+
+	fh, err := s.FloatHistogram(FloatHistogramSpec{})
+	assert.NoError(t, err, "Error calling FloatHistogram on nil scope.")
+	assertNopFloatHistogram(t, fh)
+
+	fhv, err := s.FloatHistogramVector(FloatHistogramSpec{})
+	assert.NoError(t, err, "Error calling FloatHistogramVector on nil scope.")
+	assertNopFloatHistogramVector(t, fhv)
+
+	w, err := s.WindowedHistogram(WindowedHistogramSpec{})
+	assert.NoError(t, err, "Error calling WindowedHistogram on nil scope.")
+	assert.Nil(t, w, "Expected nil windowed histogram from nil scope.")
+
+	assert.NotPanics(t, func() {
+		s.BeforeExport(func() {})
+	}, "Unexpected panic registering hook on nil scope.")
 }
 
 func assertNopCounter(t testing.TB, c *Counter) {
 	assert.Equal(t, int64(0), c.Add(42), "Unexpected result from no-op Add.")
 	assert.Equal(t, int64(0), c.Inc(), "Unexpected result from no-op Inc.")
 	assert.Equal(t, int64(0), c.Load(), "Unexpected result from no-op Load.")
+	assert.Equal(t, int64(0), c.Reset(), "Unexpected result from no-op Reset.")
 }
 
 func assertNopCounterVector(t *testing.T, vec *CounterVector) {
@@ -92,7 +127,62 @@ func assertNopCounterVector(t *testing.T, vec *CounterVector) {
 	assert.NotPanics(t, func() {
 		vec.MustGet("foo", "bar")
 	}, "Failed MustGet from no-op CounterVector.")
+	assert.NotPanics(t, vec.Reset, "Failed Reset on no-op CounterVector.")
 	assertNopCounter(t, c)
+
+	vec.Range(func(Tags, *Counter) bool {
+		t.Error("Unexpected call to Range callback on no-op CounterVector.")
+		return true
+	})
+
+	curried, err := vec.With("foo", "bar")
+	require.NoError(t, err, "Failed With from no-op CounterVector.")
+	curried, err = curried.With("baz", "quux")
+	require.NoError(t, err, "Failed With from no-op CurriedCounterVector.")
+	c, err = curried.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op CurriedCounterVector.")
+	assert.NotPanics(t, func() {
+		curried.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op CurriedCounterVector.")
+	assertNopCounter(t, c)
+}
+
+func assertNopStripedCounter(t testing.TB, c *StripedCounter) {
+	assert.NotPanics(t, func() {
+		c.Add(42)
+		c.Inc()
+	}, "Unexpected panic using no-op StripedCounter.")
+	assert.Equal(t, int64(0), c.Load(), "Unexpected result from no-op Load.")
+	assert.Equal(t, int64(0), c.Reset(), "Unexpected result from no-op Reset.")
+}
+
+func assertNopStripedCounterVector(t *testing.T, vec *StripedCounterVector) {
+	c, err := vec.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op StripedCounterVector.")
+	assertNopStripedCounter(t, c)
+	c, err = vec.Lookup(NewVectorKey("foo", "bar"))
+	require.NoError(t, err, "Failed Lookup from no-op StripedCounterVector.")
+	assertNopStripedCounter(t, c)
+	assert.NotPanics(t, func() {
+		vec.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op StripedCounterVector.")
+	assert.NotPanics(t, vec.Reset, "Failed Reset on no-op StripedCounterVector.")
+
+	vec.Range(func(Tags, *StripedCounter) bool {
+		t.Error("Unexpected call to Range callback on no-op StripedCounterVector.")
+		return true
+	})
+
+	curried, err := vec.With("foo", "bar")
+	require.NoError(t, err, "Failed With from no-op StripedCounterVector.")
+	curried, err = curried.With("baz", "quux")
+	require.NoError(t, err, "Failed With from no-op CurriedStripedCounterVector.")
+	c, err = curried.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op CurriedStripedCounterVector.")
+	assert.NotPanics(t, func() {
+		curried.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op CurriedStripedCounterVector.")
+	assertNopStripedCounter(t, c)
 }
 
 func assertNopGauge(t testing.TB, g *Gauge) {
@@ -112,6 +202,23 @@ func assertNopGaugeVector(t testing.TB, vec *GaugeVector) {
 	assert.NotPanics(t, func() {
 		vec.MustGet("foo", "bar")
 	}, "Failed MustGet from no-op GaugeVector.")
+	assert.NotPanics(t, vec.Reset, "Failed Reset on no-op GaugeVector.")
+	assertNopGauge(t, g)
+
+	vec.Range(func(Tags, *Gauge) bool {
+		t.Error("Unexpected call to Range callback on no-op GaugeVector.")
+		return true
+	})
+
+	curried, err := vec.With("foo", "bar")
+	require.NoError(t, err, "Failed With from no-op GaugeVector.")
+	curried, err = curried.With("baz", "quux")
+	require.NoError(t, err, "Failed With from no-op CurriedGaugeVector.")
+	g, err = curried.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op CurriedGaugeVector.")
+	assert.NotPanics(t, func() {
+		curried.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op CurriedGaugeVector.")
 	assertNopGauge(t, g)
 }
 
@@ -119,7 +226,33 @@ func assertNopHistogram(t testing.TB, h *Histogram) {
 	assert.NotPanics(t, func() {
 		h.Observe(time.Second)
 		h.IncBucket(42)
+		h.IncBucketN(42, 2)
+		h.ObserveN(time.Second, 2)
+		h.ObserveMany([]time.Duration{time.Second})
+		h.Reset()
 	}, "Unexpected panic using no-op histgram.")
+	assert.NoError(t, h.Merge(h), "Unexpected error merging no-op histogram.")
+	assert.Zero(t, h.Count(), "Unexpected count from no-op histogram.")
+	assert.Zero(t, h.Sum(), "Unexpected sum from no-op histogram.")
+	assert.True(t, math.IsNaN(h.Quantile(0.5)), "Expected NaN quantile from no-op histogram.")
+	assert.True(t, math.IsNaN(h.Mean()), "Expected NaN mean from no-op histogram.")
+}
+
+func TestNopWindowedHistogram(t *testing.T) {
+	var w *WindowedHistogram
+	assert.NotPanics(t, func() {
+		w.Observe(time.Second)
+		w.IncBucket(42)
+		w.IncBucketN(42, 2)
+		w.ObserveN(time.Second, 2)
+		w.ObserveMany([]time.Duration{time.Second})
+		w.Reset()
+	}, "Unexpected panic using no-op windowed histogram.")
+	assert.Nil(t, w.Cumulative(), "Unexpected cumulative histogram from no-op windowed histogram.")
+	assert.Zero(t, w.Count(), "Unexpected count from no-op windowed histogram.")
+	assert.Zero(t, w.Sum(), "Unexpected sum from no-op windowed histogram.")
+	assert.True(t, math.IsNaN(w.Quantile(0.5)), "Expected NaN quantile from no-op windowed histogram.")
+	assert.True(t, math.IsNaN(w.Mean()), "Expected NaN mean from no-op windowed histogram.")
 }
 
 func assertNopHistogramVector(t testing.TB, vec *HistogramVector) {
@@ -128,5 +261,59 @@ func assertNopHistogramVector(t testing.TB, vec *HistogramVector) {
 	assert.NotPanics(t, func() {
 		vec.MustGet("foo", "bar")
 	}, "Failed MustGet from no-op HistogramVector.")
+	assert.NotPanics(t, vec.Reset, "Failed Reset on no-op HistogramVector.")
+	assertNopHistogram(t, h)
+
+	vec.Range(func(Tags, *Histogram) bool {
+		t.Error("Unexpected call to Range callback on no-op HistogramVector.")
+		return true
+	})
+
+	curried, err := vec.With("foo", "bar")
+	require.NoError(t, err, "Failed With from no-op HistogramVector.")
+	curried, err = curried.With("baz", "quux")
+	require.NoError(t, err, "Failed With from no-op CurriedHistogramVector.")
+	h, err = curried.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op CurriedHistogramVector.")
+	assert.NotPanics(t, func() {
+		curried.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op CurriedHistogramVector.")
 	assertNopHistogram(t, h)
 }
+
+func assertNopFloatHistogram(t testing.TB, h *FloatHistogram) {
+	assert.NotPanics(t, func() {
+		h.Observe(4.2)
+		h.Reset()
+	}, "Unexpected panic using no-op float histogram.")
+	assert.Zero(t, h.Count(), "Unexpected count from no-op float histogram.")
+	assert.Zero(t, h.Sum(), "Unexpected sum from no-op float histogram.")
+	assert.True(t, math.IsNaN(h.Quantile(0.5)), "Expected NaN quantile from no-op float histogram.")
+	assert.True(t, math.IsNaN(h.Mean()), "Expected NaN mean from no-op float histogram.")
+}
+
+func assertNopFloatHistogramVector(t testing.TB, vec *FloatHistogramVector) {
+	h, err := vec.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op FloatHistogramVector.")
+	assert.NotPanics(t, func() {
+		vec.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op FloatHistogramVector.")
+	assert.NotPanics(t, vec.Reset, "Failed Reset on no-op FloatHistogramVector.")
+	assertNopFloatHistogram(t, h)
+
+	vec.Range(func(Tags, *FloatHistogram) bool {
+		t.Error("Unexpected call to Range callback on no-op FloatHistogramVector.")
+		return true
+	})
+
+	curried, err := vec.With("foo", "bar")
+	require.NoError(t, err, "Failed With from no-op FloatHistogramVector.")
+	curried, err = curried.With("baz", "quux")
+	require.NoError(t, err, "Failed With from no-op CurriedFloatHistogramVector.")
+	h, err = curried.Get("foo", "bar")
+	require.NoError(t, err, "Failed Get from no-op CurriedFloatHistogramVector.")
+	assert.NotPanics(t, func() {
+		curried.MustGet("foo", "bar")
+	}, "Failed MustGet from no-op CurriedFloatHistogramVector.")
+	assertNopFloatHistogram(t, h)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	promproto "github.com/prometheus/client_model/go"
+)
+
+// An Option configures a root.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) { f(opts) }
+
+type options struct {
+	gatherers   []prometheus.Gatherer
+	collectors  []prometheus.Collector
+	clock       Clock
+	policy      ScrubPolicy
+	scrubHook   func(original, scrubbed string)
+	countScrub  bool
+	openMetrics bool
+}
+
+// external merges all the user-supplied gatherers and collectors into a
+// single Gatherer. It returns nil if there's nothing to merge.
+func (opts options) external() prometheus.Gatherer {
+	if len(opts.gatherers) == 0 && len(opts.collectors) == 0 {
+		return nil
+	}
+	gatherers := make(prometheus.Gatherers, 0, len(opts.gatherers)+1)
+	gatherers = append(gatherers, opts.gatherers...)
+	if len(opts.collectors) > 0 {
+		registry := prometheus.NewRegistry()
+		for _, c := range opts.collectors {
+			if err := registry.Register(c); err != nil {
+				// Since New can't return an error, report the problem on every
+				// scrape instead.
+				gatherers = append(gatherers, errGatherer{err})
+			}
+		}
+		gatherers = append(gatherers, registry)
+	}
+	return gatherers
+}
+
+// WithGatherers merges metrics from the supplied Prometheus Gatherers (for
+// example, an existing prometheus.Registry) into the root's HTTP handler.
+//
+// External metrics must obey the same uniqueness rules as the root's own
+// metrics. Since Gatherers don't distinguish between constant and variable
+// tags, all their tags are treated as variable. In practice, this means that
+// an external metric may not share a name with any of the root's metrics.
+// Collisions are detected on each scrape and reported as errors.
+//
+// External metrics are only exposed via ServeHTTP; they're not included in
+// snapshots, pushed to push.Targets, or re-exported by Collector. In
+// particular, don't merge a Gatherer that already includes the root's own
+// Collector.
+func WithGatherers(gs ...prometheus.Gatherer) Option {
+	return optionFunc(func(opts *options) {
+		opts.gatherers = append(opts.gatherers, gs...)
+	})
+}
+
+// WithCollectors registers the supplied Prometheus Collectors (for example,
+// the Go runtime and process collectors) with a private registry and merges
+// their metrics into the root's HTTP handler. If any of the collectors can't
+// be registered, every scrape fails with the registration error.
+//
+// The uniqueness rules and limitations documented on WithGatherers also apply
+// to Collectors.
+func WithCollectors(cs ...prometheus.Collector) Option {
+	return optionFunc(func(opts *options) {
+		opts.collectors = append(opts.collectors, cs...)
+	})
+}
+
+// WithClock replaces the system clock used by Stopwatches and
+// WindowedHistograms. It's useful in tests.
+func WithClock(c Clock) Option {
+	return optionFunc(func(opts *options) {
+		opts.clock = c
+	})
+}
+
+// WithScrubPolicy controls how the root handles invalid metric names, tag
+// names, and tag values. The policy applies to metric specs, to tags added
+// with Scope.Tagged, and to the variable tags supplied to vectors. By
+// default, roots use StrictScrubPolicy.
+func WithScrubPolicy(p ScrubPolicy) Option {
+	return optionFunc(func(opts *options) {
+		opts.policy = p
+	})
+}
+
+// WithScrubHook reports each metric name, tag name, and tag value that the
+// root's ScrubPolicy rewrites, so that bad instrumentation is caught before
+// anyone queries a scrubbed name. The root counts rewritten strings in a
+// counter named "metrics_scrubbed_strings" and calls f, if it's not nil,
+// with the original and scrubbed strings. That name is reserved: creating
+// another metric with it fails. The counter is exported like any other
+// metric, but Scope.Reset doesn't reset it and Root.Describe omits it.
+// Strings that the policy rejects aren't reported, since the caller already
+// receives an error; to make all scrubbing an error, use RejectingScrubPolicy
+// instead.
+//
+// Names and constant tags are reported once, when metrics are constructed,
+// but invalid variable tag values are reported each time they're passed to a
+// vector, so f must be fast and safe for concurrent use. In tests, it's
+// usually simplest to fail the test from f.
+func WithScrubHook(f func(original, scrubbed string)) Option {
+	return optionFunc(func(opts *options) {
+		opts.scrubHook = f
+		opts.countScrub = true
+	})
+}
+
+// WithOpenMetrics lets the root's HTTP handler serve the OpenMetrics text
+// format to clients that prefer it. It's off by default, since OpenMetrics
+// requires counter samples to end in "_total": Prometheus servers that
+// negotiate it store a counter named "requests" as "requests_total".
+func WithOpenMetrics() Option {
+	return optionFunc(func(opts *options) {
+		opts.openMetrics = true
+	})
+}
+
+// An errGatherer reports an error on every call to Gather.
+type errGatherer struct {
+	err error
+}
+
+func (g errGatherer) Gather() ([]*promproto.MetricFamily, error) {
+	return nil, g.err
+}
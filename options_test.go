@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "go.uber.org/net/metrics"
+)
+
+func newOfficialGauge(name string, tags ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: "Some help.",
+	}, tags)
+}
+
+func TestWithGatherers(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	official := newOfficialGauge("official_gauge", "var")
+	official.WithLabelValues("x").Set(2)
+	registry.MustRegister(official)
+
+	root := New(WithGatherers(registry))
+	c, err := root.Scope().Counter(Spec{
+		Name: "test_counter",
+		Help: "Some help.",
+	})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Inc()
+
+	assertPrometheus(t, root, "# HELP test_counter Some help.\n"+
+		"# TYPE test_counter counter\n"+
+		"test_counter 1\n"+
+		"# HELP official_gauge Some help.\n"+
+		"# TYPE official_gauge gauge\n"+
+		`official_gauge{var="x"} 2`)
+
+	// External metrics aren't part of snapshots.
+	snap := root.Snapshot()
+	assert.Equal(t, 1, len(snap.Counters), "Unexpected number of counters.")
+	assert.Equal(t, 0, len(snap.Gauges), "Unexpected number of gauges.")
+}
+
+func TestWithCollectors(t *testing.T) {
+	official := newOfficialGauge("official_gauge", "var")
+	official.WithLabelValues("x").Set(2)
+
+	t.Run("valid", func(t *testing.T) {
+		root := New(WithCollectors(official))
+		assertPrometheus(t, root, "# HELP official_gauge Some help.\n"+
+			"# TYPE official_gauge gauge\n"+
+			`official_gauge{var="x"} 2`)
+	})
+
+	t.Run("registration error", func(t *testing.T) {
+		root := New(WithCollectors(official, official))
+		code, _ := scrape(t, root)
+		assert.Equal(t, http.StatusInternalServerError, code, "Expected scrape to fail.")
+	})
+}
+
+func TestExternalMetricDuplicates(t *testing.T) {
+	tests := []struct {
+		desc     string
+		register func(testing.TB, *Scope)
+		tags     []string
+	}{
+		{
+			desc: "same name, different tag names",
+			register: func(t testing.TB, s *Scope) {
+				_, err := s.Gauge(Spec{
+					Name:      "test_gauge",
+					Help:      "Some help.",
+					ConstTags: Tags{"foo": "bar"},
+				})
+				require.NoError(t, err, "Unexpected error constructing gauge.")
+			},
+			tags: []string{"var"},
+		},
+		{
+			desc: "same name and variable tag names",
+			register: func(t testing.TB, s *Scope) {
+				_, err := s.GaugeVector(Spec{
+					Name:    "test_gauge",
+					Help:    "Some help.",
+					VarTags: []string{"var"},
+				})
+				require.NoError(t, err, "Unexpected error constructing gauge vector.")
+			},
+			tags: []string{"var"},
+		},
+		{
+			desc: "same name, no tags",
+			register: func(t testing.TB, s *Scope) {
+				_, err := s.Gauge(Spec{
+					Name: "test_gauge",
+					Help: "Some help.",
+				})
+				require.NoError(t, err, "Unexpected error constructing gauge.")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			official := newOfficialGauge("test_gauge", tt.tags...)
+			official.WithLabelValues(make([]string, len(tt.tags))...).Set(1)
+			root := New(WithCollectors(official))
+			tt.register(t, root.Scope())
+			code, _ := scrape(t, root)
+			assert.Equal(t, http.StatusInternalServerError, code, "Expected scrape to fail.")
+		})
+	}
+}
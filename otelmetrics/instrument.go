@@ -0,0 +1,308 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otelmetrics
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.uber.org/net/metrics"
+)
+
+// The OpenTelemetry SDK's default histogram bucket boundaries.
+var _defaultBuckets = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// A vector is any of the metrics package's vector types.
+type vector[T any] interface {
+	Get(variableTagPairs ...string) (T, error)
+}
+
+// A lazy creates its underlying metric on first use, since OpenTelemetry
+// instruments don't declare their attribute keys up front. Instruments used
+// without attributes are backed by a scalar metric, and all others are backed
+// by a vector.
+type lazy[T any] struct {
+	create func(varTags []string) (T, vector[T], error)
+
+	once   sync.Once
+	keys   []attribute.Key
+	scalar T
+	vector vector[T]
+}
+
+func (l *lazy[T]) get(attrs attribute.Set) T {
+	l.once.Do(func() {
+		names := make([]string, 0, attrs.Len())
+		for iter := attrs.Iter(); iter.Next(); {
+			key := iter.Attribute().Key
+			l.keys = append(l.keys, key)
+			names = append(names, string(key))
+		}
+		var err error
+		if l.scalar, l.vector, err = l.create(names); err != nil {
+			otel.Handle(err)
+		}
+	})
+	if l.vector == nil {
+		// Either a scalar or a nil (no-op) metric.
+		return l.scalar
+	}
+	pairs := make([]string, 0, 2*len(l.keys))
+	for _, k := range l.keys {
+		var val string // scrubbed to the default tag value
+		if v, ok := attrs.Value(k); ok {
+			val = v.Emit()
+		}
+		pairs = append(pairs, string(k), val)
+	}
+	m, err := l.vector.Get(pairs...)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+func newSpec(name, help string, varTags []string) metrics.Spec {
+	if help == "" {
+		help = name
+	}
+	return metrics.Spec{
+		Name:    name,
+		Help:    help,
+		VarTags: varTags,
+	}
+}
+
+func newCounter(scope *metrics.Scope, name, help string) *lazy[*metrics.Counter] {
+	return &lazy[*metrics.Counter]{
+		create: func(varTags []string) (*metrics.Counter, vector[*metrics.Counter], error) {
+			spec := newSpec(name, help, varTags)
+			if len(varTags) == 0 {
+				c, err := scope.Counter(spec)
+				return c, nil, err
+			}
+			cv, err := scope.CounterVector(spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, cv, nil
+		},
+	}
+}
+
+func newGauge(scope *metrics.Scope, name, help string) *lazy[*metrics.Gauge] {
+	return &lazy[*metrics.Gauge]{
+		create: func(varTags []string) (*metrics.Gauge, vector[*metrics.Gauge], error) {
+			spec := newSpec(name, help, varTags)
+			if len(varTags) == 0 {
+				g, err := scope.Gauge(spec)
+				return g, nil, err
+			}
+			gv, err := scope.GaugeVector(spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, gv, nil
+		},
+	}
+}
+
+func newHistogram(scope *metrics.Scope, name, help string, bounds []float64) *lazy[*metrics.Histogram] {
+	if len(bounds) == 0 {
+		bounds = _defaultBuckets
+	}
+	// Our histograms have integer bucket boundaries. Round up, and drop any
+	// buckets that become duplicates.
+	buckets := make([]int64, 0, len(bounds))
+	for _, b := range bounds {
+		upper := int64(math.Ceil(b))
+		if len(buckets) > 0 && upper <= buckets[len(buckets)-1] {
+			continue
+		}
+		buckets = append(buckets, upper)
+	}
+	return &lazy[*metrics.Histogram]{
+		create: func(varTags []string) (*metrics.Histogram, vector[*metrics.Histogram], error) {
+			spec := metrics.HistogramSpec{
+				Spec: newSpec(name, help, varTags),
+				// Record values directly, without any unit conversion.
+				Unit:    time.Nanosecond,
+				Buckets: buckets,
+			}
+			if len(varTags) == 0 {
+				h, err := scope.Histogram(spec)
+				return h, nil, err
+			}
+			hv, err := scope.HistogramVector(spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, hv, nil
+		},
+	}
+}
+
+func newFloatHistogram(scope *metrics.Scope, name, help string, bounds []float64) *lazy[*metrics.FloatHistogram] {
+	if len(bounds) == 0 {
+		bounds = _defaultBuckets
+	}
+	bounds = append([]float64(nil), bounds...)
+	return &lazy[*metrics.FloatHistogram]{
+		create: func(varTags []string) (*metrics.FloatHistogram, vector[*metrics.FloatHistogram], error) {
+			spec := metrics.FloatHistogramSpec{
+				Spec:    newSpec(name, help, varTags),
+				Buckets: bounds,
+			}
+			if len(varTags) == 0 {
+				h, err := scope.FloatHistogram(spec)
+				return h, nil, err
+			}
+			hv, err := scope.FloatHistogramVector(spec)
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, hv, nil
+		},
+	}
+}
+
+type int64Counter struct {
+	embedded.Int64Counter
+
+	lazy *lazy[*metrics.Counter]
+}
+
+func (c *int64Counter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	c.lazy.get(metric.NewAddConfig(opts).Attributes()).Add(incr)
+}
+
+type int64UpDownCounter struct {
+	embedded.Int64UpDownCounter
+
+	lazy *lazy[*metrics.Gauge]
+}
+
+func (c *int64UpDownCounter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	c.lazy.get(metric.NewAddConfig(opts).Attributes()).Add(incr)
+}
+
+type int64Gauge struct {
+	embedded.Int64Gauge
+
+	lazy *lazy[*metrics.Gauge]
+}
+
+func (g *int64Gauge) Record(_ context.Context, value int64, opts ...metric.RecordOption) {
+	g.lazy.get(metric.NewRecordConfig(opts).Attributes()).Store(value)
+}
+
+type int64Histogram struct {
+	embedded.Int64Histogram
+
+	lazy *lazy[*metrics.Histogram]
+}
+
+func (h *int64Histogram) Record(_ context.Context, value int64, opts ...metric.RecordOption) {
+	h.lazy.get(metric.NewRecordConfig(opts).Attributes()).IncBucket(value)
+}
+
+type float64Histogram struct {
+	embedded.Float64Histogram
+
+	lazy *lazy[*metrics.FloatHistogram]
+}
+
+func (h *float64Histogram) Record(_ context.Context, value float64, opts ...metric.RecordOption) {
+	h.lazy.get(metric.NewRecordConfig(opts).Attributes()).Observe(value)
+}
+
+// An int64Observable is an observable instrument created by this package.
+type int64Observable interface {
+	metric.Int64Observable
+
+	observe(value int64, attrs attribute.Set)
+}
+
+type int64ObservableCounter struct {
+	metric.Int64Observable
+	embedded.Int64ObservableCounter
+
+	lazy *lazy[*metrics.Counter]
+}
+
+func (c *int64ObservableCounter) observe(value int64, attrs attribute.Set) {
+	counter := c.lazy.get(attrs)
+	// Observable counters report cumulative totals, and we're the only writer.
+	counter.Add(value - counter.Load())
+}
+
+type int64ObservableUpDownCounter struct {
+	metric.Int64Observable
+	embedded.Int64ObservableUpDownCounter
+
+	lazy *lazy[*metrics.Gauge]
+}
+
+func (c *int64ObservableUpDownCounter) observe(value int64, attrs attribute.Set) {
+	c.lazy.get(attrs).Store(value)
+}
+
+type int64ObservableGauge struct {
+	metric.Int64Observable
+	embedded.Int64ObservableGauge
+
+	lazy *lazy[*metrics.Gauge]
+}
+
+func (g *int64ObservableGauge) observe(value int64, attrs attribute.Set) {
+	g.lazy.get(attrs).Store(value)
+}
+
+// An int64Observer is passed to callbacks registered with a single
+// instrument.
+type int64Observer struct {
+	embedded.Int64Observer
+
+	observable int64Observable
+}
+
+func (o *int64Observer) Observe(value int64, opts ...metric.ObserveOption) {
+	o.observable.observe(value, metric.NewObserveConfig(opts).Attributes())
+}
+
+// An observer is passed to callbacks registered with Meter.RegisterCallback.
+type observer struct {
+	embedded.Observer
+}
+
+func (*observer) ObserveInt64(obsrv metric.Int64Observable, value int64, opts ...metric.ObserveOption) {
+	if o, ok := obsrv.(int64Observable); ok {
+		o.observe(value, metric.NewObserveConfig(opts).Attributes())
+	}
+}
+
+func (*observer) ObserveFloat64(metric.Float64Observable, float64, ...metric.ObserveOption) {}
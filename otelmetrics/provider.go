@@ -0,0 +1,313 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package otelmetrics implements the OpenTelemetry metrics API using
+// go.uber.org/net/metrics. It lets libraries instrumented with OpenTelemetry
+// export their telemetry through a Root's existing HTTP handler and push
+// integrations.
+//
+// Integer instruments are mapped onto this package's metric types:
+// counters become Counters, up-down counters and gauges become Gauges, and
+// histograms become Histograms. Floating-point histograms become
+// FloatHistograms. Observable instruments are updated lazily, each time the
+// root is exported. Since this package's counters and gauges are integral,
+// the other floating-point instruments aren't supported: creating one returns
+// a no-op instrument and an error.
+//
+// Instrument attributes become variable tags. Since OpenTelemetry doesn't
+// require instruments to declare their attribute keys, the keys used in the
+// first measurement become the instrument's tag names; subsequent
+// measurements with additional attributes drop them, and measurements
+// missing some attributes use the default tag value.
+//
+// Unlike go.uber.org/net/metrics, which supports Go 1.18, this module
+// requires the newer Go release that the OpenTelemetry API supports.
+package otelmetrics // import "go.uber.org/net/metrics/otelmetrics"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/net/metrics"
+)
+
+// NewMeterProvider constructs an OpenTelemetry MeterProvider that creates
+// metrics in the supplied scope. All the provider's Meters share a single
+// namespace: the instrumentation scope name isn't added to metric names or
+// tags.
+//
+// Errors creating metrics (for example, because an instrument's name collides
+// with an existing metric) are reported to the global OpenTelemetry error
+// handler, and the affected measurements are dropped.
+func NewMeterProvider(scope *metrics.Scope) metric.MeterProvider {
+	p := &provider{
+		scope:       scope,
+		instruments: make(map[string]interface{}),
+		callbacks:   make(map[int]func(context.Context)),
+	}
+	scope.BeforeExport(p.observe)
+	return p
+}
+
+type provider struct {
+	embedded.MeterProvider
+
+	scope *metrics.Scope
+
+	mu          sync.Mutex
+	instruments map[string]interface{} // by name
+	callbacks   map[int]func(context.Context)
+	nextID      int
+}
+
+func (p *provider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return &meter{provider: p}
+}
+
+// instrument returns the existing instrument with the supplied name, creating
+// one if necessary. Like the OpenTelemetry SDK, we return the same instrument
+// if it's requested more than once.
+func (p *provider) instrument(name string, create func() interface{}) interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if i, ok := p.instruments[name]; ok {
+		return i
+	}
+	i := create()
+	p.instruments[name] = i
+	return i
+}
+
+func (p *provider) register(f func(context.Context)) metric.Registration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID
+	p.nextID++
+	p.callbacks[id] = f
+	return &registration{provider: p, id: id}
+}
+
+func (p *provider) unregister(id int) {
+	p.mu.Lock()
+	delete(p.callbacks, id)
+	p.mu.Unlock()
+}
+
+// observe runs all registered callbacks. It's called each time the root is
+// exported.
+func (p *provider) observe() {
+	p.mu.Lock()
+	callbacks := make([]func(context.Context), 0, len(p.callbacks))
+	for _, f := range p.callbacks {
+		callbacks = append(callbacks, f)
+	}
+	p.mu.Unlock()
+	ctx := context.Background()
+	for _, f := range callbacks {
+		f(ctx)
+	}
+}
+
+type registration struct {
+	embedded.Registration
+
+	provider *provider
+	id       int
+}
+
+func (r *registration) Unregister() error {
+	r.provider.unregister(r.id)
+	return nil
+}
+
+type meter struct {
+	embedded.Meter
+
+	provider *provider
+}
+
+func (m *meter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	cfg := metric.NewInt64CounterConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64Counter{lazy: newCounter(m.provider.scope, name, cfg.Description())}
+	})
+	if c, ok := i.(*int64Counter); ok {
+		return c, nil
+	}
+	return noop.Int64Counter{}, errKind(name)
+}
+
+func (m *meter) Int64UpDownCounter(name string, opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	cfg := metric.NewInt64UpDownCounterConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64UpDownCounter{lazy: newGauge(m.provider.scope, name, cfg.Description())}
+	})
+	if c, ok := i.(*int64UpDownCounter); ok {
+		return c, nil
+	}
+	return noop.Int64UpDownCounter{}, errKind(name)
+}
+
+func (m *meter) Int64Gauge(name string, opts ...metric.Int64GaugeOption) (metric.Int64Gauge, error) {
+	cfg := metric.NewInt64GaugeConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64Gauge{lazy: newGauge(m.provider.scope, name, cfg.Description())}
+	})
+	if g, ok := i.(*int64Gauge); ok {
+		return g, nil
+	}
+	return noop.Int64Gauge{}, errKind(name)
+}
+
+func (m *meter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	cfg := metric.NewInt64HistogramConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64Histogram{lazy: newHistogram(
+			m.provider.scope,
+			name,
+			cfg.Description(),
+			cfg.ExplicitBucketBoundaries(),
+		)}
+	})
+	if h, ok := i.(*int64Histogram); ok {
+		return h, nil
+	}
+	return noop.Int64Histogram{}, errKind(name)
+}
+
+func (m *meter) Int64ObservableCounter(name string, opts ...metric.Int64ObservableCounterOption) (metric.Int64ObservableCounter, error) {
+	cfg := metric.NewInt64ObservableCounterConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64ObservableCounter{lazy: newCounter(m.provider.scope, name, cfg.Description())}
+	})
+	c, ok := i.(*int64ObservableCounter)
+	if !ok {
+		return noop.Int64ObservableCounter{}, errKind(name)
+	}
+	m.registerInt64Callbacks(c, cfg.Callbacks())
+	return c, nil
+}
+
+func (m *meter) Int64ObservableUpDownCounter(name string, opts ...metric.Int64ObservableUpDownCounterOption) (metric.Int64ObservableUpDownCounter, error) {
+	cfg := metric.NewInt64ObservableUpDownCounterConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64ObservableUpDownCounter{lazy: newGauge(m.provider.scope, name, cfg.Description())}
+	})
+	c, ok := i.(*int64ObservableUpDownCounter)
+	if !ok {
+		return noop.Int64ObservableUpDownCounter{}, errKind(name)
+	}
+	m.registerInt64Callbacks(c, cfg.Callbacks())
+	return c, nil
+}
+
+func (m *meter) Int64ObservableGauge(name string, opts ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	cfg := metric.NewInt64ObservableGaugeConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &int64ObservableGauge{lazy: newGauge(m.provider.scope, name, cfg.Description())}
+	})
+	g, ok := i.(*int64ObservableGauge)
+	if !ok {
+		return noop.Int64ObservableGauge{}, errKind(name)
+	}
+	m.registerInt64Callbacks(g, cfg.Callbacks())
+	return g, nil
+}
+
+func (m *meter) Float64Counter(name string, _ ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return noop.Float64Counter{}, errFloat(name, "counters")
+}
+
+func (m *meter) Float64UpDownCounter(name string, _ ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	return noop.Float64UpDownCounter{}, errFloat(name, "up-down counters")
+}
+
+func (m *meter) Float64Gauge(name string, _ ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	return noop.Float64Gauge{}, errFloat(name, "gauges")
+}
+
+func (m *meter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	cfg := metric.NewFloat64HistogramConfig(opts...)
+	i := m.provider.instrument(name, func() interface{} {
+		return &float64Histogram{lazy: newFloatHistogram(
+			m.provider.scope,
+			name,
+			cfg.Description(),
+			cfg.ExplicitBucketBoundaries(),
+		)}
+	})
+	if h, ok := i.(*float64Histogram); ok {
+		return h, nil
+	}
+	return noop.Float64Histogram{}, errKind(name)
+}
+
+func (m *meter) Float64ObservableCounter(name string, _ ...metric.Float64ObservableCounterOption) (metric.Float64ObservableCounter, error) {
+	return noop.Float64ObservableCounter{}, errFloat(name, "observable counters")
+}
+
+func (m *meter) Float64ObservableUpDownCounter(name string, _ ...metric.Float64ObservableUpDownCounterOption) (metric.Float64ObservableUpDownCounter, error) {
+	return noop.Float64ObservableUpDownCounter{}, errFloat(name, "observable up-down counters")
+}
+
+func (m *meter) Float64ObservableGauge(name string, _ ...metric.Float64ObservableGaugeOption) (metric.Float64ObservableGauge, error) {
+	return noop.Float64ObservableGauge{}, errFloat(name, "observable gauges")
+}
+
+func (m *meter) registerInt64Callbacks(o int64Observable, callbacks []metric.Int64Callback) {
+	for _, f := range callbacks {
+		f := f
+		m.provider.register(func(ctx context.Context) {
+			if err := f(ctx, &int64Observer{observable: o}); err != nil {
+				otel.Handle(err)
+			}
+		})
+	}
+}
+
+func (m *meter) RegisterCallback(f metric.Callback, instruments ...metric.Observable) (metric.Registration, error) {
+	for _, i := range instruments {
+		if _, ok := i.(int64Observable); !ok {
+			// Floating-point observables are no-ops, so it's safe to observe
+			// them. Anything else didn't come from this package.
+			if _, isNop := i.(metric.Float64Observable); !isNop {
+				return nil, fmt.Errorf("instrument %v wasn't created by this MeterProvider", i)
+			}
+		}
+	}
+	return m.provider.register(func(ctx context.Context) {
+		if err := f(ctx, &observer{}); err != nil {
+			otel.Handle(err)
+		}
+	}), nil
+}
+
+func errKind(name string) error {
+	return fmt.Errorf("an instrument named %q of a different kind already exists", name)
+}
+
+func errFloat(name, kind string) error {
+	return fmt.Errorf("can't create instrument %q: floating-point %s aren't supported", name, kind)
+}
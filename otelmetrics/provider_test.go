@@ -0,0 +1,235 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package otelmetrics
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/net/metrics"
+)
+
+func newTestMeter(t testing.TB) (metric.Meter, *metrics.Root) {
+	root := metrics.New()
+	return NewMeterProvider(root.Scope()).Meter("test"), root
+}
+
+func TestCounter(t *testing.T) {
+	m, root := newTestMeter(t)
+	c, err := m.Int64Counter("test.requests", metric.WithDescription("Some help."))
+	require.NoError(t, err, "Unexpected error creating counter.")
+
+	ctx := context.Background()
+	ok := metric.WithAttributes(attribute.String("outcome", "ok"), attribute.String("procedure", "get"))
+	c.Add(ctx, 2, ok)
+	c.Add(ctx, 1, ok)
+	c.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "error")))
+	c.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("outcome", "error"),
+		attribute.String("procedure", "get"),
+		attribute.String("extra", "dropped"),
+	))
+
+	snap := root.Snapshot()
+	assert.Equal(t, []metrics.Snapshot{
+		{
+			Name:  "test_requests",
+			Tags:  metrics.Tags{"outcome": "error", "procedure": "default"},
+			Value: 1,
+		},
+		{
+			Name:  "test_requests",
+			Tags:  metrics.Tags{"outcome": "error", "procedure": "get"},
+			Value: 1,
+		},
+		{
+			Name:  "test_requests",
+			Tags:  metrics.Tags{"outcome": "ok", "procedure": "get"},
+			Value: 3,
+		},
+	}, snap.Counters, "Unexpected counters.")
+
+	again, err := m.Int64Counter("test.requests")
+	require.NoError(t, err, "Unexpected error re-creating counter.")
+	assert.Equal(t, c, again, "Expected to get the same instrument.")
+
+	_, err = m.Int64Gauge("test.requests")
+	assert.Error(t, err, "Expected an error re-using a name for a different kind of instrument.")
+}
+
+func TestUpDownCounterAndGauge(t *testing.T) {
+	m, root := newTestMeter(t)
+	ctx := context.Background()
+
+	c, err := m.Int64UpDownCounter("test_in_flight", metric.WithDescription("Some help."))
+	require.NoError(t, err, "Unexpected error creating up-down counter.")
+	c.Add(ctx, 3)
+	c.Add(ctx, -1)
+
+	g, err := m.Int64Gauge("test_temperature", metric.WithDescription("Some help."))
+	require.NoError(t, err, "Unexpected error creating gauge.")
+	g.Record(ctx, 10, metric.WithAttributes(attribute.String("room", "kitchen")))
+	g.Record(ctx, 5, metric.WithAttributes(attribute.String("room", "kitchen")))
+
+	assert.Equal(t, []metrics.Snapshot{
+		{Name: "test_in_flight", Tags: metrics.Tags{}, Value: 2},
+		{Name: "test_temperature", Tags: metrics.Tags{"room": "kitchen"}, Value: 5},
+	}, root.Snapshot().Gauges, "Unexpected gauges.")
+}
+
+func TestHistogram(t *testing.T) {
+	m, root := newTestMeter(t)
+	h, err := m.Int64Histogram(
+		"test_latency_ms",
+		metric.WithDescription("Some help."),
+		metric.WithExplicitBucketBoundaries(0.5, 1, 10),
+	)
+	require.NoError(t, err, "Unexpected error creating histogram.")
+	ctx := context.Background()
+	h.Record(ctx, 1)
+	h.Record(ctx, 7)
+	h.Record(ctx, 100)
+
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.Histograms), "Unexpected number of histograms.")
+	assert.Equal(t, []int64{1, 10, 9223372036854775807}, snap.Histograms[0].Values, "Unexpected observations.")
+}
+
+func TestFloatHistogram(t *testing.T) {
+	m, root := newTestMeter(t)
+	h, err := m.Float64Histogram(
+		"http.server.request.duration",
+		metric.WithDescription("Some help."),
+		metric.WithExplicitBucketBoundaries(0.005, 0.1, 1),
+	)
+	require.NoError(t, err, "Unexpected error creating histogram.")
+	ctx := context.Background()
+	route := metric.WithAttributes(attribute.String("http.route", "users"))
+	h.Record(ctx, 0.002, route)
+	h.Record(ctx, 0.05, route)
+	h.Record(ctx, 0.25, route)
+	h.Record(ctx, 3, route)
+
+	again, err := m.Float64Histogram("http.server.request.duration")
+	require.NoError(t, err, "Unexpected error re-creating histogram.")
+	assert.Equal(t, h, again, "Expected to get the same instrument.")
+
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.FloatHistograms), "Unexpected number of float histograms.")
+	assert.Equal(t, metrics.FloatHistogramSnapshot{
+		Name: "http_server_request_duration",
+		Tags: metrics.Tags{"http_route": "users"},
+		Buckets: []metrics.FloatBucketSnapshot{
+			{Upper: 0.005, Count: 1},
+			{Upper: 0.1, Count: 1},
+			{Upper: 1, Count: 1},
+			{Upper: math.Inf(1), Count: 1},
+		},
+		Count: 4,
+		Sum:   3.302,
+	}, snap.FloatHistograms[0], "Unexpected float histogram.")
+}
+
+func TestUnsupportedFloatInstruments(t *testing.T) {
+	m, root := newTestMeter(t)
+	ctx := context.Background()
+
+	c, err := m.Float64Counter("test_float_counter")
+	assert.Error(t, err, "Expected an error creating a float counter.")
+	c.Add(ctx, 1)
+	udc, err := m.Float64UpDownCounter("test_float_up_down_counter")
+	assert.Error(t, err, "Expected an error creating a float up-down counter.")
+	udc.Add(ctx, 1)
+	g, err := m.Float64Gauge("test_float_gauge")
+	assert.Error(t, err, "Expected an error creating a float gauge.")
+	g.Record(ctx, 1)
+
+	oc, err := m.Float64ObservableCounter("test_float_observable_counter")
+	assert.Error(t, err, "Expected an error creating a float observable counter.")
+	oudc, err := m.Float64ObservableUpDownCounter("test_float_observable_up_down_counter")
+	assert.Error(t, err, "Expected an error creating a float observable up-down counter.")
+	og, err := m.Float64ObservableGauge("test_float_observable_gauge")
+	assert.Error(t, err, "Expected an error creating a float observable gauge.")
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(oc, 1)
+		return nil
+	}, oc, oudc, og)
+	assert.NoError(t, err, "Unexpected error registering a callback for no-op instruments.")
+
+	assert.Equal(t, &metrics.RootSnapshot{}, root.Snapshot(), "Expected unsupported instruments to be no-ops.")
+}
+
+func TestObservables(t *testing.T) {
+	m, root := newTestMeter(t)
+
+	var total int64
+	_, err := m.Int64ObservableCounter(
+		"test_bytes",
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			total += 10
+			o.Observe(total, metric.WithAttributes(attribute.String("dir", "in")))
+			return nil
+		}),
+	)
+	require.NoError(t, err, "Unexpected error creating observable counter.")
+
+	queue, err := m.Int64ObservableGauge("test_queue_depth")
+	require.NoError(t, err, "Unexpected error creating observable gauge.")
+	conns, err := m.Int64ObservableUpDownCounter("test_connections")
+	require.NoError(t, err, "Unexpected error creating observable up-down counter.")
+	reg, err := m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(queue, 7)
+		o.ObserveInt64(conns, 3)
+		return nil
+	}, queue, conns)
+	require.NoError(t, err, "Unexpected error registering callback.")
+
+	root.Snapshot() // first export
+	snap := root.Snapshot()
+	assert.Equal(t, []metrics.Snapshot{
+		{Name: "test_bytes", Tags: metrics.Tags{"dir": "in"}, Value: 20},
+	}, snap.Counters, "Unexpected counters.")
+	assert.Equal(t, []metrics.Snapshot{
+		{Name: "test_connections", Tags: metrics.Tags{}, Value: 3},
+		{Name: "test_queue_depth", Tags: metrics.Tags{}, Value: 7},
+	}, snap.Gauges, "Unexpected gauges.")
+
+	require.NoError(t, reg.Unregister(), "Unexpected error unregistering callback.")
+	root.Snapshot()
+	assert.Equal(t, int64(30), total, "Expected callbacks to run on each export.")
+}
+
+func TestNameCollision(t *testing.T) {
+	m, root := newTestMeter(t)
+	_, err := root.Scope().Counter(metrics.Spec{Name: "test_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error creating counter.")
+
+	c, err := m.Int64Counter("test_counter")
+	require.NoError(t, err, "Metrics are created lazily, so errors are reported later.")
+	assert.NotPanics(t, func() {
+		c.Add(context.Background(), 1)
+	}, "Expected colliding instrument to be a no-op.")
+}
@@ -39,22 +39,33 @@ type Target interface {
 	NewHistogram(HistogramSpec) Histogram
 }
 
+// A Flusher is a Target that needs to know when each push is complete,
+// perhaps to batch the values it receives. If a Target also implements
+// Flusher, the metrics.Root struct's Push method calls Flush after pushing
+// the current values of all metrics.
+type Flusher interface {
+	Flush()
+}
+
 // A Spec configures counters and gauges.
 type Spec struct {
 	Name string
 	Tags map[string]string
 }
 
-// A HistogramSpec configures histograms.
+// A HistogramSpec configures histograms. Float-valued histograms set
+// FloatBuckets instead of Buckets.
 type HistogramSpec struct {
 	Spec
 
-	Buckets []int64 // upper bounds, inclusive
+	Buckets      []int64   // upper bounds, inclusive
+	FloatBuckets []float64 // upper bounds, inclusive
 }
 
 // A Counter models monotonically increasing values, like a car's odometer.
 // Implementations should expect to be called with the total accumulated value
-// of the counter.
+// of the counter. The metrics package adds back any values removed by
+// resetting the counter, so the total never decreases.
 //
 // Implementations do not need to be safe for concurrent use.
 type Counter interface {
@@ -72,10 +83,22 @@ type Gauge interface {
 
 // A Histogram approximates a distribution of values. Implementations should
 // expect to be called with the upper bound of a bucket and the total
-// accumulated number of observations in that bucket.
+// accumulated number of observations in that bucket. As with counters,
+// resetting a histogram doesn't decrease the totals.
 //
 // Implementations do not need to be safe for concurrent use.
 type Histogram interface {
 	Set(bucket int64, total int64)
 	SetIndex(bucketIndex int, bucket int64, total int64)
 }
+
+// A FloatHistogram is a Histogram with floating-point bucket upper bounds.
+// When pushing a float-valued histogram (one whose HistogramSpec has
+// FloatBuckets), the metrics package calls SetFloatIndex if the Histogram
+// returned by the Target implements this interface. Otherwise, it falls back
+// to SetIndex, rounding each upper bound up to the nearest integer.
+//
+// Implementations do not need to be safe for concurrent use.
+type FloatHistogram interface {
+	SetFloatIndex(bucketIndex int, bucket float64, total int64)
+}
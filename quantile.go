@@ -0,0 +1,92 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import "math"
+
+// quantile estimates the qth quantile of a histogram with n buckets by
+// assuming that observations are distributed linearly within each bucket,
+// just like Prometheus's histogram_quantile function. The bucket function
+// returns each bucket's upper bound and the cumulative number of
+// observations up to and including that bucket; it's called at most once per
+// bucket, in order, so callers may accumulate counts as they go.
+//
+// The lower bound of the first bucket is assumed to be zero (unless its
+// upper bound is negative). If the quantile falls in the catch-all bucket,
+// quantile returns +Inf; if the histogram is empty, it returns NaN. Like
+// Prometheus, it returns -Inf for q < 0 and +Inf for q > 1.
+func quantile(q float64, count uint64, n int, bucket func(int) (float64, uint64)) float64 {
+	switch {
+	case count == 0 || math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+	rank := q * float64(count)
+	var lower, prev float64
+	for i := 0; i < n; i++ {
+		upper, c := bucket(i)
+		cumulative := float64(c)
+		if cumulative < rank {
+			lower, prev = upper, cumulative
+			continue
+		}
+		if math.IsInf(upper, 1) {
+			break
+		}
+		if i == 0 && upper <= 0 {
+			return upper
+		}
+		if cumulative == prev {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-prev)/(cumulative-prev)
+	}
+	return math.Inf(1)
+}
+
+// mean divides a histogram's sum by its count, returning NaN if the
+// histogram is empty.
+func mean(sum, count int64) float64 {
+	if count == 0 {
+		return math.NaN()
+	}
+	return float64(sum) / float64(count)
+}
+
+// floatMean is the floating-point equivalent of mean.
+func floatMean(sum float64, count int64) float64 {
+	if count == 0 {
+		return math.NaN()
+	}
+	return sum / float64(count)
+}
+
+// upperBound converts an inclusive bucket bound to a float, representing the
+// catch-all bucket's bound as +Inf.
+func upperBound(upper int64) float64 {
+	if upper == math.MaxInt64 {
+		return math.Inf(1)
+	}
+	return float64(upper)
+}
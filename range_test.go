@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRangeSpec(name string) Spec {
+	return Spec{
+		Name:      name,
+		Help:      "Some help.",
+		ConstTags: Tags{"host": "db01"},
+		VarTags:   []string{"peer"},
+	}
+}
+
+func TestCounterVectorRange(t *testing.T) {
+	cv, err := New().Scope().CounterVector(newRangeSpec("test"))
+	require.NoError(t, err, "Unexpected error constructing vector.")
+	cv.MustGet("peer", "c").Add(3)
+	cv.MustGet("peer", "a").Add(1)
+	cv.MustGet("peer", "b").Add(2)
+
+	t.Run("all", func(t *testing.T) {
+		var (
+			peers []string
+			total int64
+		)
+		cv.Range(func(tags Tags, c *Counter) bool {
+			assert.Equal(t, "db01", tags["host"], "Expected tags to include constant tags.")
+			peers = append(peers, tags["peer"])
+			total += c.Load()
+			return true
+		})
+		assert.Equal(t, []string{"a", "b", "c"}, peers, "Expected to visit counters in order.")
+		assert.Equal(t, int64(6), total, "Unexpected sum of counters.")
+	})
+
+	t.Run("stop early", func(t *testing.T) {
+		var visited int
+		cv.Range(func(Tags, *Counter) bool {
+			visited++
+			return false
+		})
+		assert.Equal(t, 1, visited, "Expected Range to stop when f returns false.")
+	})
+
+	t.Run("reentrant", func(t *testing.T) {
+		vec, err := New().Scope().CounterVector(newRangeSpec("test_reentrant"))
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		vec.MustGet("peer", "a")
+		var visited int
+		vec.Range(func(tags Tags, _ *Counter) bool {
+			visited++
+			// Creating new counters during iteration must not deadlock.
+			vec.MustGet("peer", tags["peer"]+"_copy").Inc()
+			return true
+		})
+		assert.Equal(t, 1, visited, "Expected Range to skip counters created during iteration.")
+		assert.Equal(t, 2, len(vec.snapshot()), "Expected new counter to be created.")
+	})
+}
+
+func TestVectorRange(t *testing.T) {
+	scope := New().Scope()
+
+	t.Run("gauge", func(t *testing.T) {
+		gv, err := scope.GaugeVector(newRangeSpec("test_gauge"))
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		gv.MustGet("peer", "b").Store(2)
+		gv.MustGet("peer", "a").Store(1)
+		got := make(map[string]int64)
+		gv.Range(func(tags Tags, g *Gauge) bool {
+			got[tags["peer"]] = g.Load()
+			return true
+		})
+		assert.Equal(t, map[string]int64{"a": 1, "b": 2}, got, "Unexpected gauges.")
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		hv, err := scope.HistogramVector(HistogramSpec{
+			Spec:    newRangeSpec("test_histogram"),
+			Unit:    time.Millisecond,
+			Buckets: []int64{10},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		hv.MustGet("peer", "b").IncBucket(1)
+		hv.MustGet("peer", "a").IncBucketN(1, 2)
+		var peers []string
+		var total int64
+		hv.Range(func(tags Tags, h *Histogram) bool {
+			peers = append(peers, tags["peer"])
+			total += h.Count()
+			return true
+		})
+		assert.Equal(t, []string{"a", "b"}, peers, "Expected to visit histograms in order.")
+		assert.Equal(t, int64(3), total, "Unexpected total count.")
+	})
+
+	t.Run("float histogram", func(t *testing.T) {
+		hv, err := scope.FloatHistogramVector(FloatHistogramSpec{
+			Spec:    newRangeSpec("test_float_histogram"),
+			Buckets: []float64{0.5},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		hv.MustGet("peer", "b").Observe(0.25)
+		hv.MustGet("peer", "a").Observe(0.75)
+		var peers []string
+		hv.Range(func(tags Tags, h *FloatHistogram) bool {
+			peers = append(peers, tags["peer"])
+			return len(peers) < 1
+		})
+		assert.Equal(t, []string{"a"}, peers, "Expected Range to stop when f returns false.")
+	})
+}
+
+func TestVectorSortsNewChildren(t *testing.T) {
+	scope := New().Scope()
+	cv, err := scope.CounterVector(newRangeSpec("test_counter"))
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	hv, err := scope.HistogramVector(HistogramSpec{
+		Spec:    newRangeSpec("test_histogram"),
+		Unit:    time.Millisecond,
+		Buckets: []int64{10},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+
+	peers := func() ([]string, []string) {
+		var counters, histograms []string
+		cv.Range(func(tags Tags, _ *Counter) bool {
+			counters = append(counters, tags["peer"])
+			return true
+		})
+		hv.Range(func(tags Tags, _ *Histogram) bool {
+			histograms = append(histograms, tags["peer"])
+			return true
+		})
+		return counters, histograms
+	}
+
+	for _, peer := range []string{"d", "b"} {
+		cv.MustGet("peer", peer)
+		hv.MustGet("peer", peer)
+	}
+	counters, histograms := peers()
+	assert.Equal(t, []string{"b", "d"}, counters, "Unexpected counter order.")
+	assert.Equal(t, []string{"b", "d"}, histograms, "Unexpected histogram order.")
+
+	// Metrics created after an export are sorted into place before the next.
+	for _, peer := range []string{"c", "e", "a"} {
+		cv.MustGet("peer", peer)
+		hv.MustGet("peer", peer)
+	}
+	counters, histograms = peers()
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, counters, "Unexpected counter order.")
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, histograms, "Unexpected histogram order.")
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/net/metrics/tallypush"
+)
+
+func TestCounterReset(t *testing.T) {
+	scope := New().Scope()
+	c, err := scope.Counter(Spec{Name: "test", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Add(3)
+	assert.Equal(t, int64(3), c.Reset(), "Expected Reset to return the previous value.")
+	assert.Equal(t, int64(0), c.Load(), "Expected counter to be zero after reset.")
+	c.Inc()
+	assert.Equal(t, int64(1), c.Load(), "Expected counter to be usable after reset.")
+
+	t.Run("striped", func(t *testing.T) {
+		c, err := scope.StripedCounter(Spec{Name: "test_striped", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		c.Add(3)
+		assert.Equal(t, int64(3), c.Reset(), "Expected Reset to return the previous value.")
+		assert.Equal(t, int64(0), c.Load(), "Expected counter to be zero after reset.")
+		c.Inc()
+		assert.Equal(t, int64(1), c.Load(), "Expected counter to be usable after reset.")
+	})
+}
+
+func TestHistogramReset(t *testing.T) {
+	for _, striped := range []bool{false, true} {
+		h, err := New().Scope().Histogram(HistogramSpec{
+			Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+			Unit:    time.Millisecond,
+			Buckets: []int64{10, 50},
+			Striped: striped,
+		})
+		require.NoError(t, err, "Unexpected error constructing histogram.")
+		h.IncBucketN(20, 3)
+		h.IncBucket(100)
+		h.Reset()
+		assert.Zero(t, h.Count(), "Expected no observations after reset (striped: %v).", striped)
+		assert.Zero(t, h.Sum(), "Expected zero sum after reset (striped: %v).", striped)
+		for _, b := range h.snapshot().Buckets {
+			assert.Zero(t, b.Count, "Expected empty bucket %v after reset (striped: %v).", b.Upper, striped)
+		}
+	}
+
+	t.Run("float", func(t *testing.T) {
+		h, err := New().Scope().FloatHistogram(FloatHistogramSpec{
+			Spec:    Spec{Name: "test_ratio", Help: "Some help."},
+			Buckets: []float64{0.5},
+		})
+		require.NoError(t, err, "Unexpected error constructing histogram.")
+		h.Observe(0.25)
+		h.Observe(0.75)
+		h.Reset()
+		assert.Zero(t, h.Count(), "Expected no observations after reset.")
+		assert.Zero(t, h.Sum(), "Expected zero sum after reset.")
+	})
+
+	t.Run("windowed", func(t *testing.T) {
+		clock := newFakeClock()
+		w, err := New(WithClock(clock)).Scope().WindowedHistogram(newWindowedSpec())
+		require.NoError(t, err, "Unexpected error constructing histogram.")
+		w.IncBucket(5)
+		clock.Add(15 * time.Second)
+		w.IncBucket(15)
+		w.Reset()
+		assert.Zero(t, w.Count(), "Expected no windowed observations after reset.")
+		assert.Zero(t, w.Cumulative().Count(), "Expected no cumulative observations after reset.")
+		w.IncBucket(15)
+		assert.Equal(t, int64(1), w.Count(), "Expected windowed histogram to be usable after reset.")
+	})
+}
+
+func TestResetPush(t *testing.T) {
+	// Each metric is pushed, incremented, reset, and then incremented past
+	// its last pushed value before the next push. Push targets should see
+	// every increment.
+	root := New()
+	scope := root.Scope()
+	c, err := scope.Counter(Spec{Name: "test_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	sc, err := scope.StripedCounter(Spec{Name: "test_striped_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing striped counter.")
+	h, err := scope.Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_histogram", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	fh, err := scope.FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_float_histogram", Help: "Some help."},
+		Buckets: []float64{10},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+
+	add := func(n int64) {
+		c.Add(n)
+		sc.Add(n)
+		h.IncBucketN(5, n)
+		for i := int64(0); i < n; i++ {
+			fh.Observe(5)
+		}
+	}
+
+	ts := tally.NewTestScope("" /* prefix */, nil /* tags */)
+	target := tallypush.New(ts)
+	add(10)
+	root.core.push(target)
+	add(5)
+	scope.Reset()
+	add(20)
+	root.core.push(target)
+
+	snap := ts.Snapshot()
+	assert.Equal(t, int64(35), snap.Counters()["test_counter+"].Value(), "Unexpected pushed counter.")
+	assert.Equal(t, int64(35), snap.Counters()["test_striped_counter+"].Value(), "Unexpected pushed striped counter.")
+	assert.Equal(t, int64(35), snap.Histograms()["test_histogram+"].Values()[10], "Unexpected pushed histogram bucket.")
+	assert.Equal(t, int64(35), snap.Histograms()["test_float_histogram+"].Values()[10], "Unexpected pushed float histogram bucket.")
+	assert.Equal(t, int64(20), c.Load(), "Reset shouldn't affect the counter's local value.")
+}
+
+func TestVectorReset(t *testing.T) {
+	spec := Spec{Name: "test_members", Help: "Some help.", VarTags: []string{"member"}}
+
+	t.Run("gauge", func(t *testing.T) {
+		gv, err := New().Scope().GaugeVector(spec)
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		old := gv.MustGet("member", "a")
+		old.Store(1)
+		gv.MustGet("member", "b").Store(1)
+
+		gv.Reset()
+		assert.Empty(t, gv.snapshot(), "Expected reset to drop all gauges.")
+		old.Inc() // still usable, but no longer exported
+		assert.Empty(t, gv.snapshot(), "Expected dropped gauges to stay dropped.")
+
+		gv.MustGet("member", "b").Store(1)
+		assert.Equal(t, []Snapshot{{Name: "test_members", Tags: Tags{"member": "b"}, Value: 1}}, gv.snapshot(),
+			"Unexpected gauges after reset.")
+		g, err := gv.Lookup(NewVectorKey("member", "a"))
+		require.NoError(t, err, "Unexpected error looking up gauge.")
+		assert.False(t, g == old, "Expected a new gauge after reset.")
+		assert.Zero(t, g.Load(), "Expected new gauge to start at zero.")
+	})
+
+	t.Run("counter", func(t *testing.T) {
+		cv, err := New().Scope().CounterVector(spec)
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		cv.MustGet("member", "a").Inc()
+		cv.Reset()
+		var visited int
+		cv.Range(func(Tags, *Counter) bool {
+			visited++
+			return true
+		})
+		assert.Zero(t, visited, "Expected reset to drop all counters.")
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		hv, err := New().Scope().HistogramVector(HistogramSpec{Spec: spec, Unit: time.Millisecond, Buckets: []int64{10}})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		h := hv.MustGet("member", "a")
+		h.IncBucket(1)
+		hv.Reset()
+		assert.True(t, h == hv.MustGet("member", "a"), "Expected histogram vectors to keep their histograms.")
+		assert.Zero(t, h.Count(), "Expected reset to clear histograms.")
+	})
+
+	t.Run("float histogram", func(t *testing.T) {
+		hv, err := New().Scope().FloatHistogramVector(FloatHistogramSpec{Spec: spec, Buckets: []float64{1}})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		h := hv.MustGet("member", "a")
+		h.Observe(0.5)
+		hv.Reset()
+		assert.True(t, h == hv.MustGet("member", "a"), "Expected histogram vectors to keep their histograms.")
+		assert.Zero(t, h.Count(), "Expected reset to clear histograms.")
+	})
+}
+
+func TestScopeReset(t *testing.T) {
+	root := New()
+	parent := root.Scope()
+	child := parent.Tagged(Tags{"service": "users"})
+
+	parentCounter, err := parent.Counter(Spec{Name: "parent_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	childCounter, err := child.Counter(Spec{Name: "child_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	childGauge, err := child.Gauge(Spec{Name: "child_gauge", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+	childVector, err := child.GaugeVector(Spec{Name: "child_vector", Help: "Some help.", VarTags: []string{"member"}})
+	require.NoError(t, err, "Unexpected error constructing vector.")
+
+	update := func() {
+		parentCounter.Inc()
+		childCounter.Inc()
+		childGauge.Store(5)
+		childVector.MustGet("member", "a").Store(1)
+	}
+
+	update()
+	child.Reset()
+	assert.Equal(t, int64(1), parentCounter.Load(), "Resetting a child scope shouldn't affect its parent's metrics.")
+	assert.Zero(t, childCounter.Load(), "Expected child scope's counter to be reset.")
+	assert.Zero(t, childGauge.Load(), "Expected child scope's gauge to be reset.")
+	assert.Empty(t, childVector.snapshot(), "Expected child scope's vector to be reset.")
+
+	update()
+	parent.Reset()
+	assert.Zero(t, parentCounter.Load(), "Expected parent scope's counter to be reset.")
+	assert.Zero(t, childCounter.Load(), "Expected parent scope reset to include derived scopes.")
+	assert.Zero(t, childGauge.Load(), "Expected parent scope reset to include derived scopes.")
+	assert.Empty(t, childVector.snapshot(), "Expected parent scope reset to include derived scopes.")
+}
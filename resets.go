@@ -0,0 +1,64 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import "sync"
+
+// resetTotals remembers the counts that Reset removed from a counter or
+// histogram, so that the totals sent to push targets never decrease. Targets
+// compute deltas between successive totals, so without this they'd lose any
+// increments made between the last push and a reset, and they couldn't
+// notice a reset at all if the metric grew past its last pushed total before
+// the next push.
+//
+// Resets and pushes both hold the lock, so a push never sees a count that's
+// been zeroed but not yet added to the totals.
+type resetTotals struct {
+	mu     sync.Mutex
+	totals []int64 // one per count, allocated on the first reset
+}
+
+// reset zeroes n counts using swap, which must return each count's previous
+// value, and adds the previous values to the totals.
+func (r *resetTotals) reset(n int, swap func(int) int64) {
+	r.mu.Lock()
+	if r.totals == nil {
+		r.totals = make([]int64, n)
+	}
+	for i := range r.totals {
+		r.totals[i] += swap(i)
+	}
+	r.mu.Unlock()
+}
+
+// push calls f with the cumulative total of each of n counts, including
+// everything removed by previous resets.
+func (r *resetTotals) push(n int, load func(int) int64, f func(int, int64)) {
+	r.mu.Lock()
+	for i := 0; i < n; i++ {
+		total := load(i)
+		if r.totals != nil {
+			total += r.totals[i]
+		}
+		f(i, total)
+	}
+	r.mu.Unlock()
+}
@@ -26,17 +26,14 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	promproto "github.com/prometheus/client_model/go"
 	"go.uber.org/net/metrics/push"
 
 	"go.uber.org/atomic"
 )
 
-// An Option configures a root. Currently, there are no exported options.
-type Option interface {
-	unimplemented()
-}
-
 // A Root is a collection of tagged metrics that can be exposed via in-memory
 // snapshots, push-based telemetry systems, or a Prometheus-compatible HTTP
 // handler.
@@ -51,21 +48,41 @@ type Option interface {
 type Root struct {
 	*core
 
-	scope   *Scope
-	pushing atomic.Bool // can only push to one target
-	handler http.Handler
+	scope       *Scope
+	pushing     atomic.Bool // can only push to one target
+	handler     http.Handler
+	openMetrics bool
 }
 
 // New constructs a root.
 func New(opts ...Option) *Root {
-	core := newCore()
-	return &Root{
-		core:  core,
-		scope: newScope(core, Tags{}),
-		handler: promhttp.HandlerFor(core.gatherer, promhttp.HandlerOpts{
-			ErrorHandling: promhttp.HTTPErrorOnError, // 500 on errors
-		}),
+	var o options
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	clock := o.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	policy := o.policy
+	if policy == nil {
+		policy = StrictScrubPolicy
+	}
+	core := newCore(o.external(), clock, policy)
+	r := &Root{
+		core:        core,
+		scope:       newScope(core, Tags{}, nil /* parent registry */),
+		handler:     promhttp.HandlerFor(core.gatherer, _handlerOpts),
+		openMetrics: o.openMetrics,
+	}
+	if o.countScrub {
+		core.scrubber.report = newScrubReporter(core, o.scrubHook)
 	}
+	return r
+}
+
+var _handlerOpts = promhttp.HandlerOpts{
+	ErrorHandling: promhttp.HTTPErrorOnError, // 500 on errors
 }
 
 // Scope exposes the root's top-level metrics collection. Tagged sub-scopes
@@ -77,21 +94,92 @@ func (r *Root) Scope() *Scope {
 
 // ServeHTTP implements a Prometheus-compatible http.Handler that exposes the
 // current value of all the metrics created with this Root (including all
-// tagged sub-scopes). Like the HTTP handler included in the Prometheus
-// client, it uses content-type negotiation to determine whether to use a
-// text or protocol buffer encoding.
+// tagged sub-scopes), along with any metrics merged in using WithGatherers
+// or WithCollectors. Like the HTTP handler included in the Prometheus
+// client, it uses content-type negotiation to determine whether to use the
+// Prometheus text format, OpenMetrics, or a protocol buffer encoding. Text
+// formats are streamed directly to the client, which is much cheaper than
+// gathering protocol buffers for roots with many metrics. OpenMetrics is only
+// served to roots constructed with WithOpenMetrics.
 //
 // In particular, it's compatible with the standard Prometheus server's
 // scraping logic.
+//
+// Clients may request a subset of the metrics using query parameters. Like
+// Prometheus federation, each name[] parameter adds a metric name to expose;
+// each tag[] parameter, of the form name=value, requires the exposed metrics
+// to have a tag with the specified value. For example, the following request
+// exposes the "requests" and "errors" metrics with the "service" tag set to
+// "users":
+//
+//	/metrics?name[]=requests&name[]=errors&tag[]=service=users
+//
+// As with Prometheus label matchers, a missing tag is equivalent to an empty
+// value. Filtering happens before any metrics are gathered, so scraping a
+// small subset of metrics is correspondingly cheap.
 func (r *Root) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.handler.ServeHTTP(w, req)
+	var f *filter
+	if req.URL.RawQuery != "" {
+		var err error
+		if f, err = newFilter(req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	openMetrics, protobuf := negotiate(req.Header, r.openMetrics)
+	if !protobuf {
+		r.core.serveText(w, req, f, openMetrics)
+		return
+	}
+	if f == nil {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+	gatherer := prometheus.GathererFunc(func() ([]*promproto.MetricFamily, error) {
+		return r.core.gatherMatching(f)
+	})
+	promhttp.HandlerFor(gatherer, _handlerOpts).ServeHTTP(w, req)
+}
+
+// Collector adapts the root to the official Prometheus client's Collector
+// interface, which lets the root's metrics share an HTTP endpoint with
+// metrics from other Prometheus-instrumented libraries:
+//
+//	prometheus.MustRegister(root.Collector())
+//	http.Handle("/metrics", promhttp.Handler())
+//
+// Each metric is described using its name, help, and constant and variable
+// tags. Since the official client has different uniqueness rules, metrics that
+// share a name must also share their help text. The collector describes the
+// metrics that exist when it's registered, so conflicts with them are
+// reported by Register. Metrics may be created at any time, though, so
+// conflicts involving metrics created after registration are reported by
+// Gather instead. Pedantic registries reject those undescribed metrics
+// unless the collector described nothing (that is, unless the root was
+// empty) when it was registered.
+func (r *Root) Collector() prometheus.Collector {
+	return newCollector(r.core)
 }
 
 // Snapshot returns a point-in-time view of all the metrics contained in the
 // root (and all its scopes). It's safe to use concurrently, but is relatively
 // expensive and designed for use in unit tests.
 func (r *Root) Snapshot() *RootSnapshot {
-	return r.snapshot()
+	s := r.snapshot()
+	for i := range s.Histograms {
+		s.Histograms[i].Values = s.Histograms[i].values()
+	}
+	return s
+}
+
+// Describe returns descriptors for all the metrics contained in the root
+// (and all its scopes), sorted by name and constant tags. It doesn't read
+// any metric values, so it's useful for generating catalogs and
+// documentation from running processes. Metrics merged in using
+// WithGatherers or WithCollectors aren't included, and neither is the
+// counter created by WithScrubHook.
+func (r *Root) Describe() []Descriptor {
+	return r.core.describeAll()
 }
 
 // Push starts a goroutine that periodically exports all registered metrics to
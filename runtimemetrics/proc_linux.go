@@ -0,0 +1,129 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.16
+// +build go1.16
+
+package runtimemetrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"go.uber.org/net/metrics"
+)
+
+// Like the Prometheus client, assume that the kernel reports CPU time in
+// units of 1/100th of a second.
+const _userHZ = 100
+
+type procStats struct {
+	rss      *metrics.Gauge
+	fds      *metrics.Gauge
+	cpu      *metrics.Counter
+	pageSize int64
+}
+
+func newProcStats(r *registrar) *procStats {
+	return &procStats{
+		rss:      r.gauge("process_resident_memory_bytes", "Resident memory size of the process."),
+		fds:      r.gauge("process_open_fds", "Number of open file descriptors."),
+		cpu:      r.counter("process_cpu_seconds_total", "Total user and system CPU time spent in seconds."),
+		pageSize: int64(os.Getpagesize()),
+	}
+}
+
+// update reads the current process's statistics. Since /proc may not be
+// mounted (or readable) in some containers, it silently skips any
+// statistics it can't read.
+func (p *procStats) update() {
+	if p == nil {
+		return
+	}
+	if pages, ok := readStatm(); ok {
+		p.rss.Store(pages * p.pageSize)
+	}
+	if n, ok := countFDs(); ok {
+		p.fds.Store(n)
+	}
+	if ticks, ok := readCPUTicks(); ok {
+		// Counters are integral, so this truncates to whole seconds.
+		p.cpu.Add(ticks/_userHZ - p.cpu.Load())
+	}
+}
+
+// readStatm returns the process's resident set size, in pages.
+func readStatm() (int64, bool) {
+	bs, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := bytes.Fields(bs)
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	return pages, err == nil
+}
+
+func countFDs() (int64, bool) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+	return int64(len(names)), true
+}
+
+// readCPUTicks returns the sum of the process's user and system CPU time, in
+// clock ticks. See proc(5) for a description of the file format.
+func readCPUTicks() (int64, bool) {
+	bs, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, false
+	}
+	// The second field is the executable name in parentheses, which may
+	// contain spaces. Skip past it.
+	end := bytes.LastIndexByte(bs, ')')
+	if end < 0 {
+		return 0, false
+	}
+	fields := bytes.Fields(bs[end+1:])
+	// Fields 14 and 15 (1-indexed) are utime and stime. We've skipped the
+	// first two.
+	if len(fields) < 13 {
+		return 0, false
+	}
+	utime, err := strconv.ParseInt(string(fields[11]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	stime, err := strconv.ParseInt(string(fields[12]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return utime + stime, true
+}
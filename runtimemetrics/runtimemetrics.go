@@ -0,0 +1,255 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.16
+// +build go1.16
+
+// Package runtimemetrics exposes statistics about the Go runtime and the
+// current process using go.uber.org/net/metrics. Runtime statistics come
+// from the standard library's runtime/metrics package, and process
+// statistics come from the /proc filesystem (on Linux only).
+//
+// All values are read lazily, each time the root is scraped, pushed, or
+// snapshotted, so there's no need to run a background goroutine.
+//
+// It relies on runtime/metrics, which was added in Go 1.16.
+package runtimemetrics // import "go.uber.org/net/metrics/runtimemetrics"
+
+import (
+	"fmt"
+	"math"
+	rtmetrics "runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/net/metrics/bucket"
+)
+
+type runtimeSpec struct {
+	name, help string
+	// Since runtime statistics are occasionally renamed, we use the first of
+	// these samples that's supported by the current Go version.
+	samples []string
+}
+
+var (
+	_gauges = []runtimeSpec{
+		{"go_goroutines", "Number of live goroutines.", []string{"/sched/goroutines:goroutines"}},
+		{"go_gomaxprocs", "Current GOMAXPROCS setting.", []string{"/sched/gomaxprocs:threads"}},
+		{"go_heap_objects_bytes", "Memory occupied by live and unswept heap objects.", []string{"/memory/classes/heap/objects:bytes"}},
+		{"go_heap_free_bytes", "Free heap memory that could be returned to the OS.", []string{"/memory/classes/heap/free:bytes"}},
+		{"go_heap_released_bytes", "Free heap memory that has been returned to the OS.", []string{"/memory/classes/heap/released:bytes"}},
+		{"go_heap_unused_bytes", "Heap memory reserved for, but not used by, heap objects.", []string{"/memory/classes/heap/unused:bytes"}},
+		{"go_heap_goal_bytes", "Heap size target for the end of the GC cycle.", []string{"/gc/heap/goal:bytes"}},
+		{"go_memory_total_bytes", "All memory mapped by the Go runtime.", []string{"/memory/classes/total:bytes"}},
+	}
+	_counters = []runtimeSpec{
+		{"go_gc_cycles", "Number of completed GC cycles.", []string{"/gc/cycles/total:gc-cycles"}},
+		{"go_heap_allocs_bytes", "Cumulative bytes allocated on the heap.", []string{"/gc/heap/allocs:bytes"}},
+		{"go_heap_allocs_objects", "Cumulative count of heap allocations.", []string{"/gc/heap/allocs:objects"}},
+	}
+	_histograms = []runtimeSpec{
+		{"go_gc_pauses_us", "Distribution of stop-the-world GC pause latencies.", []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"}},
+		{"go_sched_latencies_us", "Distribution of time goroutines spend runnable before running.", []string{"/sched/latencies:seconds"}},
+	}
+)
+
+// Register adds Go runtime and process metrics to the supplied scope.
+// Statistics that aren't supported by the current Go version or operating
+// system are skipped.
+//
+// Register returns an error if any of the metrics can't be created, usually
+// because the root already contains metrics with the same names. Since
+// metrics can't be removed from a root, Register doesn't stop at the first
+// failure: the metrics it did create are still kept up to date, and the
+// error lists the ones it couldn't create.
+func Register(scope *metrics.Scope) error {
+	if scope == nil {
+		return nil
+	}
+	r := &registrar{scope: scope}
+	c := newCollector(r)
+	if r.created > 0 {
+		scope.BeforeExport(c.update)
+	}
+	return r.err()
+}
+
+// A registrar creates metrics, recording failures instead of stopping at the
+// first one. Metrics it can't create are nil, which makes them no-ops.
+type registrar struct {
+	scope   *metrics.Scope
+	created int
+	errs    []string
+}
+
+func (r *registrar) gauge(name, help string) *metrics.Gauge {
+	g, err := r.scope.Gauge(metrics.Spec{Name: name, Help: help})
+	r.record(err)
+	return g
+}
+
+func (r *registrar) counter(name, help string) *metrics.Counter {
+	c, err := r.scope.Counter(metrics.Spec{Name: name, Help: help})
+	r.record(err)
+	return c
+}
+
+func (r *registrar) histogram(spec metrics.HistogramSpec) *metrics.Histogram {
+	h, err := r.scope.Histogram(spec)
+	r.record(err)
+	return h
+}
+
+func (r *registrar) record(err error) {
+	if err != nil {
+		r.errs = append(r.errs, err.Error())
+		return
+	}
+	r.created++
+}
+
+func (r *registrar) err() error {
+	if len(r.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to create %d runtime metrics: %s", len(r.errs), strings.Join(r.errs, "; "))
+}
+
+type collector struct {
+	mu      sync.Mutex
+	samples []rtmetrics.Sample
+	updates []func(rtmetrics.Value) // one per sample
+	proc    *procStats
+}
+
+func newCollector(r *registrar) *collector {
+	supported := make(map[string]struct{})
+	for _, d := range rtmetrics.All() {
+		supported[d.Name] = struct{}{}
+	}
+	resolve := func(candidates []string) (string, bool) {
+		for _, name := range candidates {
+			if _, ok := supported[name]; ok {
+				return name, true
+			}
+		}
+		return "", false
+	}
+
+	c := &collector{}
+	for _, spec := range _gauges {
+		sample, ok := resolve(spec.samples)
+		if !ok {
+			continue
+		}
+		g := r.gauge(spec.name, spec.help)
+		if g == nil {
+			continue
+		}
+		c.add(sample, func(v rtmetrics.Value) {
+			if v.Kind() == rtmetrics.KindUint64 {
+				g.Store(int64(v.Uint64()))
+			}
+		})
+	}
+	for _, spec := range _counters {
+		sample, ok := resolve(spec.samples)
+		if !ok {
+			continue
+		}
+		counter := r.counter(spec.name, spec.help)
+		if counter == nil {
+			continue
+		}
+		c.add(sample, func(v rtmetrics.Value) {
+			if v.Kind() == rtmetrics.KindUint64 {
+				// We're the only writer, so the counter's value is the total
+				// we've already recorded.
+				counter.Add(int64(v.Uint64()) - counter.Load())
+			}
+		})
+	}
+	for _, spec := range _histograms {
+		sample, ok := resolve(spec.samples)
+		if !ok {
+			continue
+		}
+		h := r.histogram(metrics.HistogramSpec{
+			Spec:    metrics.Spec{Name: spec.name, Help: spec.help},
+			Unit:    time.Microsecond,
+			Buckets: bucket.NewExponential(1, 2, 24), // 1us to ~8s
+		})
+		if h == nil {
+			continue
+		}
+		c.add(sample, newHistogramUpdate(h))
+	}
+	c.proc = newProcStats(r)
+	return c
+}
+
+func (c *collector) add(sample string, update func(rtmetrics.Value)) {
+	c.samples = append(c.samples, rtmetrics.Sample{Name: sample})
+	c.updates = append(c.updates, update)
+}
+
+func (c *collector) update() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rtmetrics.Read(c.samples)
+	for i := range c.samples {
+		c.updates[i](c.samples[i].Value)
+	}
+	c.proc.update()
+}
+
+// newHistogramUpdate folds a cumulative runtime histogram (with floating-point
+// bucket boundaries in seconds) into one of our histograms. Each time it's
+// called, it records the new observations in each runtime bucket at that
+// bucket's upper bound.
+func newHistogramUpdate(h *metrics.Histogram) func(rtmetrics.Value) {
+	var last []uint64
+	return func(v rtmetrics.Value) {
+		if v.Kind() != rtmetrics.KindFloat64Histogram {
+			return
+		}
+		hist := v.Float64Histogram()
+		if len(last) != len(hist.Counts) {
+			last = make([]uint64, len(hist.Counts))
+		}
+		for i, count := range hist.Counts {
+			delta := count - last[i]
+			last[i] = count
+			if delta == 0 {
+				continue
+			}
+			// Bucket i covers [Buckets[i], Buckets[i+1]). The outermost
+			// boundaries may be infinite.
+			upper := hist.Buckets[i+1]
+			if math.IsInf(upper, 1) {
+				upper = hist.Buckets[i]
+			}
+			h.IncBucketN(int64(math.Ceil(upper*1e6)), int64(delta))
+		}
+	}
+}
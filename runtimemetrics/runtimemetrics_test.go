@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build go1.16
+// +build go1.16
+
+package runtimemetrics
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+)
+
+func findValue(snaps []metrics.Snapshot, name string) (int64, bool) {
+	for _, s := range snaps {
+		if s.Name == name {
+			return s.Value, true
+		}
+	}
+	return 0, false
+}
+
+func findHistogram(snaps []metrics.HistogramSnapshot, name string) (metrics.HistogramSnapshot, bool) {
+	for _, s := range snaps {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return metrics.HistogramSnapshot{}, false
+}
+
+func TestRegister(t *testing.T) {
+	root := metrics.New()
+	require.NoError(t, Register(root.Scope()), "Failed to register runtime metrics.")
+	runtime.GC()
+
+	snap := root.Snapshot()
+	goroutines, ok := findValue(snap.Gauges, "go_goroutines")
+	require.True(t, ok, "Expected a goroutine count.")
+	assert.True(t, goroutines > 0, "Expected at least one goroutine.")
+
+	cycles, ok := findValue(snap.Counters, "go_gc_cycles")
+	require.True(t, ok, "Expected a GC cycle count.")
+	assert.True(t, cycles > 0, "Expected at least one GC cycle.")
+
+	pauses, ok := findHistogram(snap.Histograms, "go_gc_pauses_us")
+	require.True(t, ok, "Expected a GC pause histogram.")
+	assert.True(t, pauses.Count > 0, "Expected some GC pauses.")
+
+	// Values are re-read on each export.
+	runtime.GC()
+	later, _ := findValue(root.Snapshot().Counters, "go_gc_cycles")
+	assert.True(t, later > cycles, "Expected GC cycle count to increase.")
+
+	assert.Error(t, Register(root.Scope()), "Expected an error registering runtime metrics twice.")
+}
+
+func TestRegisterProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Process statistics are only supported on Linux.")
+	}
+	root := metrics.New()
+	require.NoError(t, Register(root.Scope()), "Failed to register runtime metrics.")
+
+	snap := root.Snapshot()
+	for _, name := range []string{"process_resident_memory_bytes", "process_open_fds"} {
+		v, ok := findValue(snap.Gauges, name)
+		require.True(t, ok, "Expected a value for %v.", name)
+		assert.True(t, v > 0, "Expected a positive value for %v.", name)
+	}
+	_, ok := findValue(snap.Counters, "process_cpu_seconds_total")
+	assert.True(t, ok, "Expected a CPU time counter.")
+}
+
+func TestRegisterPartialFailure(t *testing.T) {
+	root := metrics.New()
+	_, err := root.Scope().Counter(metrics.Spec{Name: "go_goroutines", Help: "Conflicting metric."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+
+	err = Register(root.Scope())
+	require.Error(t, err, "Expected an error registering conflicting metrics.")
+	assert.Contains(t, err.Error(), "go_goroutines", "Expected error to name the conflicting metric.")
+
+	// Everything else is still registered and kept up to date.
+	cycles, ok := findValue(root.Snapshot().Counters, "go_gc_cycles")
+	require.True(t, ok, "Expected a GC cycle count.")
+	runtime.GC()
+	later, _ := findValue(root.Snapshot().Counters, "go_gc_cycles")
+	assert.True(t, later > cycles, "Expected GC cycle count to increase.")
+}
+
+func TestRegisterNilScope(t *testing.T) {
+	assert.NoError(t, Register(nil), "Expected registering with a nil scope to no-op.")
+}
@@ -20,22 +20,57 @@
 
 package metrics
 
+import "sync"
+
 // A Scope is a collection of tagged metrics.
 type Scope struct {
 	core      *core
 	constTags Tags
+	tagNames  map[string]string // scrubbed name to key in constTags
+	registry  *registry
 }
 
-func newScope(c *core, tags Tags) *Scope {
+func newScope(c *core, tags Tags, parent *registry) *Scope {
 	return &Scope{
 		core:      c,
 		constTags: tags,
+		registry:  &registry{parent: parent},
+	}
+}
+
+// A registry tracks the metrics created by a scope and the scopes derived
+// from it, so they can be reset together. Each metric is added to its own
+// scope's registry and to all its ancestors' registries, so deriving a scope
+// doesn't retain anything.
+type registry struct {
+	parent *registry
+
+	mu      sync.Mutex
+	metrics []resetter
+}
+
+func (r *registry) add(m resetter) {
+	for ; r != nil; r = r.parent {
+		r.mu.Lock()
+		r.metrics = append(r.metrics, m)
+		r.mu.Unlock()
+	}
+}
+
+func (r *registry) reset() {
+	r.mu.Lock()
+	metrics := append([]resetter(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range metrics {
+		m.reset()
 	}
 }
 
 // Tagged creates a new scope with new constant tags merged into the existing
-// tags (if any). Tag names and values are automatically scrubbed, with
-// invalid characters replaced by underscores.
+// tags (if any). Tag names and values are automatically scrubbed according to
+// the root's ScrubPolicy; by default, invalid characters are replaced by
+// underscores. If the policy rejects a tag, constructing metrics from the new
+// scope fails.
 func (s *Scope) Tagged(tags Tags) *Scope {
 	if s == nil {
 		return nil
@@ -44,10 +79,64 @@ func (s *Scope) Tagged(tags Tags) *Scope {
 	for k, v := range s.constTags {
 		newTags[k] = v
 	}
+	names := make(map[string]string, len(s.tagNames)+len(tags))
+	for name, k := range s.tagNames {
+		names[name] = k
+	}
+	// Tags are stored unscrubbed and scrubbed once, when each metric is
+	// constructed, since not all policies are idempotent. New tags replace
+	// existing tags with the same scrubbed name.
 	for k, v := range tags {
-		newTags[scrubName(k)] = scrubTagValue(v)
+		name := s.scrubName(k)
+		if existing, ok := names[name]; ok && existing != k {
+			delete(newTags, existing)
+		}
+		names[name] = k
+		newTags[k] = v
+	}
+	scope := newScope(s.core, newTags, s.registry)
+	scope.tagNames = names
+	return scope
+}
+
+// scrubName scrubs a tag name for comparison. Names that the policy rejects
+// are returned unchanged.
+func (s *Scope) scrubName(name string) string {
+	scrubbed, err := s.core.scrubber.scrubPolicy().ScrubName(name)
+	if err != nil {
+		return name
+	}
+	return scrubbed
+}
+
+// Reset resets all the metrics created by this scope and by scopes derived
+// from it with Tagged. Counters, gauges, and histograms are set to zero,
+// counter and gauge vectors drop all their metrics, and histogram vectors
+// clear all their histograms. Metrics merged in with WithGatherers or
+// WithCollectors aren't affected.
+//
+// Resetting isn't atomic: concurrent updates and exports may see some
+// metrics reset and others not.
+func (s *Scope) Reset() {
+	if s == nil {
+		return
+	}
+	s.registry.reset()
+}
+
+// BeforeExport registers a function that's called each time the root's
+// metrics are exported: before each scrape of the root's HTTP handler, each
+// push, and each snapshot. It lets users update metrics that are expensive to
+// compute (for example, by making a system call) lazily, rather than in a
+// background goroutine.
+//
+// Since exports may run concurrently, the function must be safe for
+// concurrent use. It's called synchronously, so it should also be fast.
+func (s *Scope) BeforeExport(f func()) {
+	if s == nil {
+		return
 	}
-	return newScope(s.core, newTags)
+	s.core.addHook(f)
 }
 
 // Counter constructs a new Counter.
@@ -55,16 +144,33 @@ func (s *Scope) Counter(spec Spec) (*Counter, error) {
 	if s == nil {
 		return nil, nil
 	}
+	return s.counter(spec, false /* striped */)
+}
+
+// StripedCounter constructs a new StripedCounter.
+func (s *Scope) StripedCounter(spec Spec) (*StripedCounter, error) {
+	if s == nil {
+		return nil, nil
+	}
+	c, err := s.counter(spec, true /* striped */)
+	if err != nil {
+		return nil, err
+	}
+	return (*StripedCounter)(c), nil
+}
+
+func (s *Scope) counter(spec Spec, striped bool) (*Counter, error) {
 	spec = s.addConstTags(spec)
 	if err := spec.validateScalar(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec)
+	meta, err := newMetadata(spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
+	meta.Striped = striped
 	c := newCounter(meta)
-	if err := s.core.register(c); err != nil {
+	if err := s.register(c); err != nil {
 		return nil, err
 	}
 	return c, nil
@@ -79,12 +185,12 @@ func (s *Scope) Gauge(spec Spec) (*Gauge, error) {
 	if err := spec.validateScalar(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec)
+	meta, err := newMetadata(spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
 	g := newGauge(meta)
-	if err := s.core.register(g); err != nil {
+	if err := s.register(g); err != nil {
 		return nil, err
 	}
 	return g, nil
@@ -99,32 +205,93 @@ func (s *Scope) Histogram(spec HistogramSpec) (*Histogram, error) {
 	if err := spec.validateScalar(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec.Spec)
+	meta, err := newMetadata(spec.Spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
-	h := newHistogram(meta, spec.Unit, spec.Buckets)
-	if err := s.core.register(h); err != nil {
+	meta.Striped = spec.Striped
+	h := newHistogram(meta, spec.Unit, spec.Buckets, s.core.clock)
+	if err := s.register(h); err != nil {
 		return nil, err
 	}
 	return h, nil
 }
 
+// FloatHistogram constructs a new FloatHistogram.
+func (s *Scope) FloatHistogram(spec FloatHistogramSpec) (*FloatHistogram, error) {
+	if s == nil {
+		return nil, nil
+	}
+	spec.Spec = s.addConstTags(spec.Spec)
+	if err := spec.validateScalar(); err != nil {
+		return nil, err
+	}
+	meta, err := newMetadata(spec.Spec, s.core.scrubber)
+	if err != nil {
+		return nil, err
+	}
+	h := newFloatHistogram(meta, spec.Buckets)
+	if err := s.register(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// WindowedHistogram constructs a new WindowedHistogram.
+func (s *Scope) WindowedHistogram(spec WindowedHistogramSpec) (*WindowedHistogram, error) {
+	if s == nil {
+		return nil, nil
+	}
+	spec.Spec = s.addConstTags(spec.Spec)
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	meta, err := newMetadata(spec.Spec, s.core.scrubber)
+	if err != nil {
+		return nil, err
+	}
+	meta.Striped = spec.Striped
+	h := newHistogram(meta, spec.Unit, spec.Buckets, s.core.clock)
+	if err := s.core.register(h); err != nil {
+		return nil, err
+	}
+	w := newWindowedHistogram(h, s.core.clock, spec.Window, spec.slices())
+	s.registry.add(w)
+	return w, nil
+}
+
 // CounterVector constructs a new CounterVector.
 func (s *Scope) CounterVector(spec Spec) (*CounterVector, error) {
 	if s == nil {
 		return nil, nil
 	}
+	return s.counterVector(spec, false /* striped */)
+}
+
+// StripedCounterVector constructs a new StripedCounterVector.
+func (s *Scope) StripedCounterVector(spec Spec) (*StripedCounterVector, error) {
+	if s == nil {
+		return nil, nil
+	}
+	cv, err := s.counterVector(spec, true /* striped */)
+	if err != nil {
+		return nil, err
+	}
+	return &StripedCounterVector{vec: cv}, nil
+}
+
+func (s *Scope) counterVector(spec Spec, striped bool) (*CounterVector, error) {
 	spec = s.addConstTags(spec)
 	if err := spec.validateVector(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec)
+	meta, err := newMetadata(spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
+	meta.Striped = striped
 	cv := newCounterVector(meta)
-	if err := s.core.register(cv); err != nil {
+	if err := s.register(cv); err != nil {
 		return nil, err
 	}
 	return cv, nil
@@ -139,12 +306,12 @@ func (s *Scope) GaugeVector(spec Spec) (*GaugeVector, error) {
 	if err := spec.validateVector(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec)
+	meta, err := newMetadata(spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
 	gv := newGaugeVector(meta)
-	if err := s.core.register(gv); err != nil {
+	if err := s.register(gv); err != nil {
 		return nil, err
 	}
 	return gv, nil
@@ -159,17 +326,49 @@ func (s *Scope) HistogramVector(spec HistogramSpec) (*HistogramVector, error) {
 	if err := spec.validateVector(); err != nil {
 		return nil, err
 	}
-	meta, err := newMetadata(spec.Spec)
+	meta, err := newMetadata(spec.Spec, s.core.scrubber)
 	if err != nil {
 		return nil, err
 	}
-	hv := newHistogramVector(meta, spec.Unit, spec.Buckets)
-	if err := s.core.register(hv); err != nil {
+	meta.Striped = spec.Striped
+	hv := newHistogramVector(meta, spec.Unit, spec.Buckets, s.core.clock)
+	if err := s.register(hv); err != nil {
 		return nil, err
 	}
 	return hv, nil
 }
 
+// FloatHistogramVector constructs a new FloatHistogramVector.
+func (s *Scope) FloatHistogramVector(spec FloatHistogramSpec) (*FloatHistogramVector, error) {
+	if s == nil {
+		return nil, nil
+	}
+	spec.Spec = s.addConstTags(spec.Spec)
+	if err := spec.validateVector(); err != nil {
+		return nil, err
+	}
+	meta, err := newMetadata(spec.Spec, s.core.scrubber)
+	if err != nil {
+		return nil, err
+	}
+	hv := newFloatHistogramVector(meta, spec.Buckets)
+	if err := s.register(hv); err != nil {
+		return nil, err
+	}
+	return hv, nil
+}
+
+// register adds a metric to the root and to the scope's registry.
+func (s *Scope) register(m metric) error {
+	if err := s.core.register(m); err != nil {
+		return err
+	}
+	if r, ok := m.(resetter); ok {
+		s.registry.add(r)
+	}
+	return nil
+}
+
 func (s *Scope) addConstTags(spec Spec) Spec {
 	if len(s.constTags) == 0 {
 		return spec
@@ -178,7 +377,11 @@ func (s *Scope) addConstTags(spec Spec) Spec {
 	for k, v := range s.constTags {
 		tags[k] = v
 	}
+	// The spec's tags replace the scope's tags with the same scrubbed name.
 	for k, v := range spec.ConstTags {
+		if existing, ok := s.tagNames[s.scrubName(k)]; ok && existing != k {
+			delete(tags, existing)
+		}
 		tags[k] = v
 	}
 	spec.ConstTags = tags
@@ -26,6 +26,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/net/metrics/push"
 )
 
 func TestScalarMetricDuplicates(t *testing.T) {
@@ -358,6 +360,26 @@ func TestTaggedPrecedence(t *testing.T) {
 	}, snap.Counters[0], "Unexpected counter snapshot.")
 }
 
+func TestTaggedPrecedenceAfterScrubbing(t *testing.T) {
+	root := New()
+	scope := root.Scope().Tagged(Tags{"foo.bar": "x"})
+	_, err := scope.Counter(Spec{
+		Name:      "test_counter",
+		Help:      "help",
+		ConstTags: Tags{"foo_bar": "y"},
+	})
+	require.NoError(t, err, "Failed to create counter.")
+	_, err = scope.Tagged(Tags{"foo_bar": "z"}).Counter(Spec{
+		Name: "test_counter",
+		Help: "help",
+	})
+	require.NoError(t, err, "Failed to create counter from re-tagged scope.")
+	snap := root.Snapshot()
+	require.Equal(t, 2, len(snap.Counters), "Unexpected number of counters.")
+	assert.Equal(t, Tags{"foo_bar": "y"}, snap.Counters[0].Tags, "Expected spec's tags to win.")
+	assert.Equal(t, Tags{"foo_bar": "z"}, snap.Counters[1].Tags, "Expected newer scope tags to win.")
+}
+
 func TestTaggedAutoScrubbing(t *testing.T) {
 	root := New()
 	scope := root.Scope().Tagged(Tags{
@@ -410,3 +432,29 @@ func TestTagScrubbingUniqueness(t *testing.T) {
 		assert.Error(t, err, "Expected error when scrubbing duplicates tag names.")
 	})
 }
+
+func TestBeforeExport(t *testing.T) {
+	root := New()
+	g, err := root.Scope().Gauge(Spec{
+		Name: "test_gauge",
+		Help: "help",
+	})
+	require.NoError(t, err, "Failed to create gauge.")
+
+	var exports atomic.Int64
+	root.Scope().Tagged(Tags{"foo": "bar"}).BeforeExport(func() {
+		g.Store(exports.Inc())
+	})
+
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.Gauges), "Unexpected number of gauges.")
+	assert.Equal(t, int64(1), snap.Gauges[0].Value, "Expected hook to run before snapshot.")
+
+	root.push(push.NewNop())
+	assert.Equal(t, int64(2), g.Load(), "Expected hook to run before push.")
+
+	families, err := root.gatherer.Gather()
+	require.NoError(t, err, "Unexpected error gathering metrics.")
+	require.Equal(t, 1, len(families), "Unexpected number of metric families.")
+	assert.Equal(t, float64(3), families[0].Metric[0].Gauge.GetValue(), "Expected hook to run before scrape.")
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A ScrubPolicy controls how a root handles metric names, tag names, and tag
+// values that aren't valid in both Prometheus and Tally. Policies may
+// rewrite invalid strings or reject them by returning an error, in which
+// case the operation that supplied the string fails: constructing a metric,
+// or retrieving one from a vector.
+//
+// Policies must be deterministic and safe for concurrent use. Scrubbing
+// valid strings, or strings that have already been scrubbed, should be cheap
+// and shouldn't allocate, since vectors scrub tag values on every lookup.
+// Scrubbed strings must not contain null bytes, which vectors use internally
+// to separate tag values; the root treats them as rejected.
+type ScrubPolicy interface {
+	// ScrubName returns a valid metric or tag name.
+	ScrubName(string) (string, error)
+	// ScrubTagValue returns a valid tag value.
+	ScrubTagValue(string) (string, error)
+}
+
+var (
+	// StrictScrubPolicy replaces each invalid byte with an underscore and
+	// empty strings with DefaultTagName or DefaultTagValue. It's the default.
+	// Since it's lossy, distinct inputs may collide: for example, "foo.bar"
+	// and "foo/bar" both become "foo_bar".
+	StrictScrubPolicy ScrubPolicy = strictScrubPolicy{}
+
+	// PrometheusScrubPolicy allows any UTF-8 tag value, which Prometheus
+	// supports but Tally doesn't; null bytes and invalid UTF-8 sequences are
+	// replaced with the Unicode replacement character. Names are scrubbed
+	// like StrictScrubPolicy. Don't use this policy when pushing to Tally.
+	PrometheusScrubPolicy ScrubPolicy = prometheusScrubPolicy{}
+
+	// EscapingScrubPolicy losslessly encodes invalid strings, so distinct
+	// inputs never collide. Valid strings are left unchanged. Invalid strings
+	// are prefixed with "U__", underscores are doubled, and every other
+	// invalid byte is written as its hexadecimal value surrounded by
+	// underscores: "foo.bar" becomes "U__foo_2e_bar". Valid strings that
+	// begin with "U__" are escaped too, so they can't be mistaken for escaped
+	// strings.
+	EscapingScrubPolicy ScrubPolicy = escapingScrubPolicy{}
+
+	// RejectingScrubPolicy returns an error for every invalid string.
+	RejectingScrubPolicy ScrubPolicy = rejectingScrubPolicy{}
+)
+
+type strictScrubPolicy struct{}
+
+func (strictScrubPolicy) ScrubName(s string) (string, error)     { return scrubName(s), nil }
+func (strictScrubPolicy) ScrubTagValue(s string) (string, error) { return scrubTagValue(s), nil }
+
+type prometheusScrubPolicy struct{}
+
+func (prometheusScrubPolicy) ScrubName(s string) (string, error) { return scrubName(s), nil }
+
+func (prometheusScrubPolicy) ScrubTagValue(s string) (string, error) {
+	if len(s) == 0 {
+		return DefaultTagValue, nil
+	}
+	if utf8.ValidString(s) && strings.IndexByte(s, 0) < 0 {
+		return s, nil
+	}
+	const replacement = string(utf8.RuneError)
+	return strings.ReplaceAll(strings.ToValidUTF8(s, replacement), "\x00", replacement), nil
+}
+
+const _escapePrefix = "U__"
+
+type escapingScrubPolicy struct{}
+
+func (escapingScrubPolicy) ScrubName(s string) (string, error) {
+	if IsValidName(s) && !strings.HasPrefix(s, _escapePrefix) {
+		return s, nil
+	}
+	return escape(s, isNameByte), nil
+}
+
+func (escapingScrubPolicy) ScrubTagValue(s string) (string, error) {
+	if IsValidTagValue(s) && !strings.HasPrefix(s, _escapePrefix) {
+		return s, nil
+	}
+	return escape(s, isTagValueByte), nil
+}
+
+// escape encodes a string using only the bytes allowed by valid, which must
+// include alphanumerics and underscores. The result is always a valid name.
+func escape(s string, valid func(byte) bool) string {
+	const hex = "0123456789abcdef"
+	d := newDigester()
+	d.bs = append(d.bs, _escapePrefix...)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '_':
+			d.bs = append(d.bs, '_', '_')
+		case valid(c):
+			d.bs = append(d.bs, c)
+		default:
+			d.bs = append(d.bs, '_', hex[c>>4], hex[c&0xf], '_')
+		}
+	}
+	escaped := string(d.bs)
+	d.free()
+	return escaped
+}
+
+type rejectingScrubPolicy struct{}
+
+func (rejectingScrubPolicy) ScrubName(s string) (string, error) {
+	if !IsValidName(s) {
+		return "", fmt.Errorf("invalid metric or tag name %q", s)
+	}
+	return s, nil
+}
+
+func (rejectingScrubPolicy) ScrubTagValue(s string) (string, error) {
+	if !IsValidTagValue(s) {
+		return "", fmt.Errorf("invalid tag value %q", s)
+	}
+	return s, nil
+}
+
+// A scrubber applies a root's ScrubPolicy to user-supplied strings and
+// reports any that the policy rewrites.
+type scrubber struct {
+	policy ScrubPolicy                     // nil means StrictScrubPolicy
+	report func(original, scrubbed string) // optional
+}
+
+func (s scrubber) scrubPolicy() ScrubPolicy {
+	if s.policy == nil {
+		return StrictScrubPolicy
+	}
+	return s.policy
+}
+
+func (s scrubber) name(original string) (string, error) {
+	scrubbed, err := s.scrubPolicy().ScrubName(original)
+	return s.check(original, scrubbed, err)
+}
+
+func (s scrubber) tagValue(original string) (string, error) {
+	scrubbed, err := s.scrubPolicy().ScrubTagValue(original)
+	return s.check(original, scrubbed, err)
+}
+
+// check rejects scrubbed strings that contain null bytes and reports
+// rewritten strings. Since vector keys separate tag values with null bytes,
+// allowing them would make "a\x00b", "c" and "a", "b\x00c" retrieve the same
+// metric. StrictScrubPolicy never produces null bytes, so skip the check.
+func (s scrubber) check(original, scrubbed string, err error) (string, error) {
+	if err != nil {
+		return scrubbed, err
+	}
+	if _, strict := s.policy.(strictScrubPolicy); !strict && strings.IndexByte(scrubbed, 0) >= 0 {
+		return "", fmt.Errorf("scrubbed string %q contains a null byte", scrubbed)
+	}
+	if s.report != nil && scrubbed != original {
+		s.report(original, scrubbed)
+	}
+	return scrubbed, nil
+}
+
+// _scrubbedStringsName is the name of the counter used by WithScrubHook.
+const _scrubbedStringsName = "metrics_scrubbed_strings"
+
+// newScrubReporter creates the counter used by WithScrubHook and returns a
+// function that reports scrubbed strings to it and to the user's hook. The
+// counter is registered directly with the core, so it's exported but
+// scopes can't reset it and Root.Describe omits it.
+func newScrubReporter(c *core, hook func(original, scrubbed string)) func(original, scrubbed string) {
+	// The spec is valid and the root is empty, so this can't fail.
+	meta, _ := newMetadata(Spec{
+		Name: _scrubbedStringsName,
+		Help: "Number of metric names, tag names, and tag values rewritten by the ScrubPolicy.",
+	}, scrubber{})
+	meta.internal = true
+	counter := newCounter(meta)
+	_ = c.register(counter)
+	return func(original, scrubbed string) {
+		counter.Inc()
+		if hook != nil {
+			hook(original, scrubbed)
+		}
+	}
+}
+
+// isDefault reports whether the scrubber silently applies the default policy,
+// as VectorKeys do.
+func (s scrubber) isDefault() bool {
+	if s.report != nil {
+		return false
+	}
+	if s.policy == nil {
+		return true
+	}
+	_, ok := s.policy.(strictScrubPolicy)
+	return ok
+}
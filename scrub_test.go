@@ -0,0 +1,391 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrubPolicies(t *testing.T) {
+	tests := []struct {
+		policy    ScrubPolicy
+		in        string
+		name      string
+		nameErr   bool
+		value     string
+		valueErr  bool
+		skipValue bool
+	}{
+		{policy: StrictScrubPolicy, in: "foo_bar", name: "foo_bar", value: "foo_bar"},
+		{policy: StrictScrubPolicy, in: "foo.bar", name: "foo_bar", value: "foo.bar"},
+		{policy: StrictScrubPolicy, in: "café", name: "caf__", value: "caf__"},
+		{policy: StrictScrubPolicy, in: "", name: DefaultTagName, value: DefaultTagValue},
+
+		{policy: PrometheusScrubPolicy, in: "foo.bar", name: "foo_bar", value: "foo.bar"},
+		{policy: PrometheusScrubPolicy, in: "café", name: "caf__", value: "café"},
+		{policy: PrometheusScrubPolicy, in: "a\xffb", name: "a_b", value: "a�b"},
+		{policy: PrometheusScrubPolicy, in: "a\x00b", name: "a_b", value: "a�b"},
+		{policy: PrometheusScrubPolicy, in: "", name: DefaultTagName, value: DefaultTagValue},
+
+		{policy: EscapingScrubPolicy, in: "foo_bar", name: "foo_bar", value: "foo_bar"},
+		{policy: EscapingScrubPolicy, in: "foo.bar", name: "U__foo_2e_bar", value: "foo.bar"},
+		{policy: EscapingScrubPolicy, in: "foo/bar", name: "U__foo_2f_bar", value: "U__foo_2f_bar"},
+		{policy: EscapingScrubPolicy, in: "a_b/c", name: "U__a__b_2f_c", value: "U__a__b_2f_c"},
+		{policy: EscapingScrubPolicy, in: "U__foo", name: "U__U____foo", value: "U__U____foo"},
+		{policy: EscapingScrubPolicy, in: "1st", name: "U__1st", value: "1st"},
+		{policy: EscapingScrubPolicy, in: "a\x00b", name: "U__a_00_b", value: "U__a_00_b"},
+		{policy: EscapingScrubPolicy, in: "", name: "U__", value: "U__"},
+
+		{policy: RejectingScrubPolicy, in: "foo_bar", name: "foo_bar", value: "foo_bar"},
+		{policy: RejectingScrubPolicy, in: "foo.bar", nameErr: true, value: "foo.bar"},
+		{policy: RejectingScrubPolicy, in: "café", nameErr: true, valueErr: true},
+		{policy: RejectingScrubPolicy, in: "a\x00b", nameErr: true, valueErr: true},
+		{policy: RejectingScrubPolicy, in: "", nameErr: true, valueErr: true},
+	}
+
+	for _, tt := range tests {
+		name, err := tt.policy.ScrubName(tt.in)
+		if tt.nameErr {
+			assert.Error(t, err, "Expected %T to reject name %q.", tt.policy, tt.in)
+		} else if assert.NoError(t, err, "Unexpected error scrubbing name %q with %T.", tt.in, tt.policy) {
+			assert.Equal(t, tt.name, name, "Unexpected name from %T.", tt.policy)
+			assert.True(t, IsValidName(name), "Expected %T to produce a valid name, got %q.", tt.policy, name)
+		}
+
+		value, err := tt.policy.ScrubTagValue(tt.in)
+		if tt.valueErr {
+			assert.Error(t, err, "Expected %T to reject tag value %q.", tt.policy, tt.in)
+		} else if assert.NoError(t, err, "Unexpected error scrubbing tag value %q with %T.", tt.in, tt.policy) {
+			assert.Equal(t, tt.value, value, "Unexpected tag value from %T.", tt.policy)
+		}
+	}
+}
+
+func TestEscapingScrubPolicyIsLossless(t *testing.T) {
+	inputs := []string{
+		"", "_", "__", "U__", "U___", "foo", "foo_bar", "foo.bar", "foo/bar",
+		"foo-bar", "foo_2e_bar", "U__foo_2e_bar", "1foo", "café", "caf\xc3",
+	}
+	names := make(map[string]string, len(inputs))
+	values := make(map[string]string, len(inputs))
+	for _, in := range inputs {
+		name, err := EscapingScrubPolicy.ScrubName(in)
+		require.NoError(t, err, "Unexpected error escaping name %q.", in)
+		assert.True(t, IsValidName(name), "Expected escaped name %q to be valid.", name)
+		if prev, ok := names[name]; ok {
+			t.Errorf("Names %q and %q both escape to %q.", prev, in, name)
+		}
+		names[name] = in
+
+		value, err := EscapingScrubPolicy.ScrubTagValue(in)
+		require.NoError(t, err, "Unexpected error escaping tag value %q.", in)
+		assert.True(t, IsValidTagValue(value), "Expected escaped tag value %q to be valid.", value)
+		if prev, ok := values[value]; ok {
+			t.Errorf("Tag values %q and %q both escape to %q.", prev, in, value)
+		}
+		values[value] = in
+	}
+}
+
+func TestScrubPolicyDefault(t *testing.T) {
+	root := New()
+	assert.Equal(t, StrictScrubPolicy, root.core.scrubber.policy, "Expected strict scrubbing by default.")
+}
+
+func TestPrometheusScrubPolicy(t *testing.T) {
+	root := New(WithScrubPolicy(PrometheusScrubPolicy))
+	vec, err := root.Scope().Tagged(Tags{"city": "Zürich"}).CounterVector(Spec{
+		Name:    "test-counter",
+		Help:    "Some help.",
+		VarTags: []string{"dish"},
+	})
+	require.NoError(t, err, "Unexpected error constructing vector.")
+	vec.MustGet("dish", "crème brûlée").Inc()
+
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.Counters), "Unexpected number of counters.")
+	assert.Equal(t, Snapshot{
+		Name:  "test_counter",
+		Tags:  Tags{"city": "Zürich", "dish": "crème brûlée"},
+		Value: 1,
+	}, snap.Counters[0], "Unexpected counter snapshot.")
+
+	_, text := serveText(t, root, "")
+	assert.Contains(t, text, `test_counter{city="Zürich",dish="crème brûlée"} 1`, "Expected UTF-8 tag values in text output.")
+	assert.True(t, utf8.ValidString(text), "Expected valid UTF-8 output.")
+}
+
+// passthroughScrubPolicy accepts everything, including null bytes.
+type passthroughScrubPolicy struct{}
+
+func (passthroughScrubPolicy) ScrubName(s string) (string, error)     { return s, nil }
+func (passthroughScrubPolicy) ScrubTagValue(s string) (string, error) { return s, nil }
+
+func TestScrubbedNullBytes(t *testing.T) {
+	// Vectors separate tag values with null bytes, so tags containing them
+	// must not be able to collide.
+	policies := []ScrubPolicy{
+		StrictScrubPolicy,
+		PrometheusScrubPolicy,
+		EscapingScrubPolicy,
+		RejectingScrubPolicy,
+		passthroughScrubPolicy{},
+	}
+	for _, policy := range policies {
+		t.Run(fmt.Sprintf("%T", policy), func(t *testing.T) {
+			vec, err := New(WithScrubPolicy(policy)).Scope().CounterVector(Spec{
+				Name:    "test_counter",
+				Help:    "Some help.",
+				VarTags: []string{"a", "b"},
+			})
+			require.NoError(t, err, "Unexpected error constructing vector.")
+			left, leftErr := vec.Get("a", "p\x00q", "b", "r")
+			right, rightErr := vec.Get("a", "p", "b", "q\x00r")
+			if leftErr != nil || rightErr != nil {
+				// Rejecting both is fine.
+				assert.Error(t, leftErr, "Expected both tag sets to be rejected.")
+				assert.Error(t, rightErr, "Expected both tag sets to be rejected.")
+				return
+			}
+			assert.True(t, left != right, "Expected distinct counters for distinct tags.")
+		})
+	}
+}
+
+func TestEscapingScrubPolicy(t *testing.T) {
+	root := New(WithScrubPolicy(EscapingScrubPolicy))
+	scope := root.Scope().Tagged(Tags{"host.name": "a.example.com"})
+	vec, err := scope.CounterVector(Spec{
+		Name:    "requests",
+		Help:    "Some help.",
+		VarTags: []string{"path"},
+	})
+	require.NoError(t, err, "Unexpected error constructing vector.")
+
+	for _, path := range []string{"foo/bar", "foo_bar", "foo:bar"} {
+		vec.MustGet("path", path).Inc()
+	}
+	// Lookups re-scrub keys with the root's policy.
+	c, err := vec.Lookup(NewVectorKey("path", "foo/bar"))
+	require.NoError(t, err, "Unexpected error looking up counter.")
+	assert.Equal(t, vec.MustGet("path", "foo/bar"), c, "Expected Lookup to find the same counter as Get.")
+	// So do curried and generic vectors.
+	curried, err := vec.With("path", "foo/bar")
+	require.NoError(t, err, "Unexpected error currying vector.")
+	assert.Equal(t, c, curried.MustGet(), "Expected curried vector to find the same counter as Get.")
+
+	snap := root.Snapshot()
+	require.Equal(t, 3, len(snap.Counters), "Expected distinct tag values to produce distinct counters.")
+	for _, s := range snap.Counters {
+		assert.Equal(t, "a.example.com", s.Tags["U__host_2e_name"], "Expected escaped constant tag name.")
+	}
+	assert.Equal(t, Tags{"U__host_2e_name": "a.example.com", "path": "U__foo_2f_bar"}, snap.Counters[0].Tags, "Unexpected tags.")
+	assert.Equal(t, Tags{"U__host_2e_name": "a.example.com", "path": "U__foo_3a_bar"}, snap.Counters[1].Tags, "Unexpected tags.")
+	assert.Equal(t, Tags{"U__host_2e_name": "a.example.com", "path": "foo_bar"}, snap.Counters[2].Tags, "Unexpected tags.")
+}
+
+func TestRejectingScrubPolicy(t *testing.T) {
+	type tags struct{ Path string }
+
+	root := New(WithScrubPolicy(RejectingScrubPolicy))
+	scope := root.Scope()
+
+	t.Run("metric name", func(t *testing.T) {
+		_, err := scope.Counter(Spec{Name: "test-counter", Help: "Some help."})
+		assert.Error(t, err, "Expected an error constructing a counter with an invalid name.")
+	})
+
+	t.Run("const tags", func(t *testing.T) {
+		_, err := scope.Gauge(Spec{Name: "test_gauge", Help: "Some help.", ConstTags: Tags{"foo": "a/b"}})
+		assert.Error(t, err, "Expected an error constructing a gauge with an invalid tag value.")
+	})
+
+	t.Run("tagged scope", func(t *testing.T) {
+		tagged := scope.Tagged(Tags{"foo!": "bar"})
+		_, err := tagged.Histogram(HistogramSpec{
+			Spec:    Spec{Name: "test_histogram", Help: "Some help."},
+			Unit:    1,
+			Buckets: []int64{1},
+		})
+		assert.Error(t, err, "Expected an error constructing a histogram from a scope with invalid tags.")
+	})
+
+	t.Run("variable tags", func(t *testing.T) {
+		vec, err := scope.CounterVector(Spec{Name: "test_vector", Help: "Some help.", VarTags: []string{"path"}})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+
+		_, err = vec.Get("path", "a/b")
+		assert.Error(t, err, "Expected an error getting a counter with an invalid tag value.")
+		_, err = vec.Lookup(NewVectorKey("path", "a/b"))
+		assert.Error(t, err, "Expected an error looking up a counter with an invalid tag value.")
+		_, err = vec.With("path", "a/b")
+		assert.Error(t, err, "Expected an error currying a vector with an invalid tag value.")
+
+		curried, err := vec.With()
+		require.NoError(t, err, "Unexpected error currying vector.")
+		_, err = curried.Get("path", "a/b")
+		assert.Error(t, err, "Expected an error getting a counter from a curried vector with an invalid tag value.")
+
+		c, err := vec.Get("path", "a.b")
+		require.NoError(t, err, "Unexpected error getting a counter with a valid tag value.")
+		c.Inc()
+	})
+
+	t.Run("generic vector", func(t *testing.T) {
+		vec, err := NewCounterVec[tags](scope, Spec{Name: "test_generic", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		_, err = vec.Get(tags{Path: "a/b"})
+		assert.Error(t, err, "Expected an error getting a counter with an invalid tag value.")
+		assert.Panics(t, func() { vec.MustGet(tags{Path: "a/b"}) }, "Expected MustGet to panic with an invalid tag value.")
+		c, err := vec.Get(tags{Path: "a.b"})
+		require.NoError(t, err, "Unexpected error getting a counter with a valid tag value.")
+		assert.NotNil(t, c, "Expected a counter for a valid tag value.")
+	})
+
+	t.Run("histogram vector", func(t *testing.T) {
+		vec, err := scope.HistogramVector(HistogramSpec{
+			Spec:    Spec{Name: "test_histogram_vector", Help: "Some help.", VarTags: []string{"path"}},
+			Unit:    1,
+			Buckets: []int64{1},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		_, err = vec.Get("path", "a/b")
+		assert.Error(t, err, "Expected an error getting a histogram with an invalid tag value.")
+		_, err = vec.Lookup(NewVectorKey("path", "a/b"))
+		assert.Error(t, err, "Expected an error looking up a histogram with an invalid tag value.")
+	})
+}
+
+type scrubRecorder struct {
+	mu       sync.Mutex
+	scrubbed [][2]string
+}
+
+func (r *scrubRecorder) record(original, scrubbed string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scrubbed = append(r.scrubbed, [2]string{original, scrubbed})
+}
+
+func (r *scrubRecorder) calls() [][2]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][2]string(nil), r.scrubbed...)
+}
+
+func scrubCount(t testing.TB, root *Root) int64 {
+	for _, c := range root.Snapshot().Counters {
+		if c.Name == "metrics_scrubbed_strings" {
+			return c.Value
+		}
+	}
+	t.Fatal("Expected a counter of scrubbed strings.")
+	return 0
+}
+
+func TestScrubHook(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		assert.Empty(t, New().Snapshot().Counters, "Expected no self-metrics without a hook.")
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		var r scrubRecorder
+		root := New(WithScrubHook(r.record))
+		vec, err := root.Scope().Tagged(Tags{"host.name": "a.example.com"}).CounterVector(Spec{
+			Name:    "test-counter",
+			Help:    "Some help.",
+			VarTags: []string{"path"},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		assert.ElementsMatch(t, [][2]string{
+			{"host.name", "host_name"},
+			{"test-counter", "test_counter"},
+		}, r.calls(), "Unexpected reports from constructor.")
+		assert.Equal(t, int64(2), scrubCount(t, root), "Unexpected count of scrubbed strings.")
+
+		vec.MustGet("path", "ok").Inc()
+		assert.Equal(t, 2, len(r.calls()), "Expected valid tag values not to be reported.")
+
+		vec.MustGet("path", "a/b").Inc()
+		vec.MustGet("path", "a/b").Inc()
+		_, err = vec.Lookup(NewVectorKey("path", "a/b"))
+		require.NoError(t, err, "Unexpected error looking up counter.")
+		_, err = vec.With("path", "a/b")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		assert.Equal(t, [][2]string{
+			{"a/b", "a_b"},
+			{"a/b", "a_b"},
+			{"a/b", "a_b"},
+			{"a/b", "a_b"},
+		}, r.calls()[2:], "Expected each use of an invalid tag value to be reported.")
+		assert.Equal(t, int64(6), scrubCount(t, root), "Unexpected count of scrubbed strings.")
+
+		// Exporting doesn't re-report names and values.
+		_, _ = serveText(t, root, "")
+		root.Describe()
+		assert.Equal(t, 6, len(r.calls()), "Expected exports not to report scrubbing.")
+	})
+
+	t.Run("nil hook", func(t *testing.T) {
+		root := New(WithScrubHook(nil))
+		_, err := root.Scope().Counter(Spec{Name: "test-counter", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		assert.Equal(t, int64(1), scrubCount(t, root), "Unexpected count of scrubbed strings.")
+	})
+
+	t.Run("reserved counter", func(t *testing.T) {
+		root := New(WithScrubHook(nil))
+		scope := root.Scope()
+		_, err := scope.Counter(Spec{Name: "test-counter", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing counter.")
+
+		scope.Reset()
+		assert.Equal(t, int64(1), scrubCount(t, root), "Expected Reset not to affect the count of scrubbed strings.")
+		for _, d := range root.Describe() {
+			assert.NotEqual(t, _scrubbedStringsName, d.Name, "Expected Describe to omit the count of scrubbed strings.")
+		}
+		_, err = scope.Counter(Spec{Name: _scrubbedStringsName, Help: "Some help."})
+		assert.Error(t, err, "Expected an error reusing the reserved name.")
+	})
+
+	t.Run("escaping policy", func(t *testing.T) {
+		var r scrubRecorder
+		root := New(WithScrubPolicy(EscapingScrubPolicy), WithScrubHook(r.record))
+		_, err := root.Scope().Counter(Spec{Name: "test.counter", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		assert.Equal(t, [][2]string{{"test.counter", "U__test_2e_counter"}}, r.calls(), "Unexpected reports.")
+	})
+
+	t.Run("rejecting policy", func(t *testing.T) {
+		var r scrubRecorder
+		root := New(WithScrubPolicy(RejectingScrubPolicy), WithScrubHook(r.record))
+		_, err := root.Scope().Counter(Spec{Name: "test-counter", Help: "Some help."})
+		assert.Error(t, err, "Expected an error constructing a counter with an invalid name.")
+		assert.Empty(t, r.calls(), "Expected rejected strings not to be reported.")
+		assert.Equal(t, int64(0), scrubCount(t, root), "Unexpected count of scrubbed strings.")
+	})
+}
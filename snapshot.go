@@ -41,11 +41,57 @@ func (s Snapshot) less(other Snapshot) bool {
 }
 
 // A HistogramSnapshot is a point-in-time view of the state of a Histogram.
+// Its size depends only on the number of buckets, not the number of
+// observations, so it's reasonably cheap to take outside of tests.
 type HistogramSnapshot struct {
-	Name   string
-	Tags   Tags
-	Unit   time.Duration
-	Values []int64 // rounded up to bucket upper bounds
+	Name string
+	Tags Tags
+	Unit time.Duration
+	// Deprecated: Values expands the histogram into one element per
+	// observation, rounded up to its bucket's upper bound, so it's as large as
+	// Count. Use Buckets instead.
+	Values  []int64
+	Buckets []BucketSnapshot // all buckets, including the catch-all
+	Count   int64            // total number of observations
+	Sum     int64            // exact sum of observed values, in units
+}
+
+// A BucketSnapshot is a point-in-time view of a single histogram bucket.
+type BucketSnapshot struct {
+	Upper int64 // inclusive upper bound, in units; math.MaxInt64 for the catch-all bucket
+	Count int64 // observations in this bucket alone (not cumulative)
+}
+
+// values expands the snapshot's buckets into one element per observation,
+// with each observation rounded up to its bucket's upper bound.
+func (l HistogramSnapshot) values() []int64 {
+	if l.Count == 0 {
+		return nil
+	}
+	values := make([]int64, 0, l.Count)
+	for _, b := range l.Buckets {
+		for i := int64(0); i < b.Count; i++ {
+			values = append(values, b.Upper)
+		}
+	}
+	return values
+}
+
+// Quantile estimates the qth quantile (0 <= q <= 1) of the observed values,
+// in units, by interpolating linearly within buckets. It returns +Inf if the
+// quantile falls in the catch-all bucket and NaN if the histogram is empty.
+func (l HistogramSnapshot) Quantile(q float64) float64 {
+	var cumulative uint64
+	return quantile(q, uint64(l.Count), len(l.Buckets), func(i int) (float64, uint64) {
+		cumulative += uint64(l.Buckets[i].Count)
+		return upperBound(l.Buckets[i].Upper), cumulative
+	})
+}
+
+// Mean returns the exact mean of the observed values, in units. It returns
+// NaN if the histogram is empty.
+func (l HistogramSnapshot) Mean() float64 {
+	return mean(l.Sum, l.Count)
 }
 
 func (l HistogramSnapshot) less(other HistogramSnapshot) bool {
@@ -55,12 +101,55 @@ func (l HistogramSnapshot) less(other HistogramSnapshot) bool {
 	return l.Tags.less(other.Tags)
 }
 
+// A FloatHistogramSnapshot is a point-in-time view of the state of a
+// FloatHistogram.
+type FloatHistogramSnapshot struct {
+	Name    string
+	Tags    Tags
+	Buckets []FloatBucketSnapshot // all buckets, including the catch-all
+	Count   int64                 // total number of observations
+	Sum     float64               // sum of observed values
+}
+
+// A FloatBucketSnapshot is a point-in-time view of a single float histogram
+// bucket.
+type FloatBucketSnapshot struct {
+	Upper float64 // inclusive upper bound; +Inf for the catch-all bucket
+	Count int64   // observations in this bucket alone (not cumulative)
+}
+
+// Quantile estimates the qth quantile (0 <= q <= 1) of the observed values
+// by interpolating linearly within buckets. It returns +Inf if the quantile
+// falls in the catch-all bucket and NaN if the histogram is empty.
+func (l FloatHistogramSnapshot) Quantile(q float64) float64 {
+	var cumulative uint64
+	return quantile(q, uint64(l.Count), len(l.Buckets), func(i int) (float64, uint64) {
+		cumulative += uint64(l.Buckets[i].Count)
+		return l.Buckets[i].Upper, cumulative
+	})
+}
+
+// Mean returns the mean of the observed values. It returns NaN if the
+// histogram is empty.
+func (l FloatHistogramSnapshot) Mean() float64 {
+	return floatMean(l.Sum, l.Count)
+}
+
+func (l FloatHistogramSnapshot) less(other FloatHistogramSnapshot) bool {
+	if l.Name != other.Name {
+		return l.Name < other.Name
+	}
+	return l.Tags.less(other.Tags)
+}
+
 // A RootSnapshot exposes all the metrics contained in a Root and all its
 // Scopes. It's useful in tests, but relatively expensive to construct.
 type RootSnapshot struct {
 	Counters   []Snapshot
 	Gauges     []Snapshot
 	Histograms []HistogramSnapshot
+
+	FloatHistograms []FloatHistogramSnapshot
 }
 
 func (s *RootSnapshot) sort() {
@@ -73,6 +162,9 @@ func (s *RootSnapshot) sort() {
 	sort.Slice(s.Histograms, func(i, j int) bool {
 		return s.Histograms[i].less(s.Histograms[j])
 	})
+	sort.Slice(s.FloatHistograms, func(i, j int) bool {
+		return s.FloatHistograms[i].less(s.FloatHistograms[j])
+	})
 }
 
 func (s *RootSnapshot) add(m metric) {
@@ -89,5 +181,9 @@ func (s *RootSnapshot) add(m metric) {
 		s.Gauges = append(s.Gauges, v.snapshot()...)
 	case *HistogramVector:
 		s.Histograms = append(s.Histograms, v.snapshot()...)
+	case *FloatHistogram:
+		s.FloatHistograms = append(s.FloatHistograms, v.snapshot())
+	case *FloatHistogramVector:
+		s.FloatHistograms = append(s.FloatHistograms, v.snapshot()...)
 	}
 }
@@ -80,6 +80,13 @@ type HistogramSpec struct {
 	// A catch-all bucket for large observations is automatically created, if
 	// necessary.
 	Buckets []int64
+	// Striped spreads the histogram's state across several cache-line padded
+	// shards, so that goroutines running on different CPUs don't contend
+	// with each other. It makes updates from many goroutines much cheaper but
+	// reads slower, and it uses noticeably more memory, so it's best reserved
+	// for a handful of very hot metrics. For counters, see StripedCounter and
+	// StripedCounterVector.
+	Striped bool
 }
 
 func (hs HistogramSpec) validateScalar() error {
@@ -112,3 +119,44 @@ func (hs HistogramSpec) validateHistogram() error {
 	}
 	return nil
 }
+
+// A FloatHistogramSpec configures FloatHistograms and FloatHistogramVectors.
+type FloatHistogramSpec struct {
+	Spec
+
+	// Upper bounds (inclusive) for the histogram buckets. Bounds may be
+	// fractional or negative, but not NaN. A catch-all bucket for large
+	// observations is automatically created, if necessary.
+	Buckets []float64
+}
+
+func (fs FloatHistogramSpec) validateScalar() error {
+	if err := fs.validateFloatHistogram(); err != nil {
+		return err
+	}
+	return fs.Spec.validateScalar()
+}
+
+func (fs FloatHistogramSpec) validateVector() error {
+	if err := fs.validateFloatHistogram(); err != nil {
+		return err
+	}
+	return fs.Spec.validateVector()
+}
+
+func (fs FloatHistogramSpec) validateFloatHistogram() error {
+	if len(fs.Buckets) == 0 {
+		return fmt.Errorf("must specify some buckets")
+	}
+	prev := math.Inf(-1)
+	for i, upper := range fs.Buckets {
+		if math.IsNaN(upper) {
+			return fmt.Errorf("bucket upper bounds must not be NaN")
+		}
+		if i > 0 && upper <= prev {
+			return fmt.Errorf("bucket upper bounds must be sorted in increasing order")
+		}
+		prev = upper
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import "time"
+
+// A Clock tells the current time. Roots use the system clock by default,
+// but tests can supply their own with WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// A Stopwatch measures the duration of a single operation. It's a small
+// value type, so starting and stopping it doesn't allocate. Since it uses the
+// root's Clock, durations measured with the system clock use Go's monotonic
+// clock reading and are immune to wall-clock adjustments.
+//
+// The zero value is a valid no-op Stopwatch.
+type Stopwatch struct {
+	h     *Histogram
+	start time.Time
+}
+
+// Start starts a Stopwatch that records its elapsed time in the histogram
+// when stopped. It replaces the common pattern of calling time.Now before an
+// operation and Observe(time.Since(start)) after it:
+//
+//	defer h.Start().Stop()
+func (h *Histogram) Start() Stopwatch {
+	if h == nil {
+		return Stopwatch{}
+	}
+	return Stopwatch{h: h, start: h.clock.Now()}
+}
+
+// Stop observes the time elapsed since the Stopwatch was started and
+// returns it. Stopping a Stopwatch more than once records multiple
+// observations.
+func (s Stopwatch) Stop() time.Duration {
+	if s.h == nil {
+		return 0
+	}
+	elapsed := s.h.clock.Now().Sub(s.start)
+	s.h.Observe(elapsed)
+	return elapsed
+}
+
+// A VectorStopwatch measures the duration of a single operation, choosing
+// the histogram to record it in when stopped. This lets callers tag
+// observations with information that's only available once the operation
+// completes, like its outcome. Like Stopwatch, it doesn't allocate.
+//
+// The zero value is a valid no-op VectorStopwatch.
+type VectorStopwatch struct {
+	hv    *HistogramVector
+	start time.Time
+}
+
+// Start starts a VectorStopwatch for the vector.
+func (hv *HistogramVector) Start() VectorStopwatch {
+	if hv == nil {
+		return VectorStopwatch{}
+	}
+	return VectorStopwatch{hv: hv, start: hv.clock.Now()}
+}
+
+// Stop observes the time elapsed since the VectorStopwatch was started in
+// the histogram with the supplied variable tags, and returns the elapsed
+// time. As with HistogramVector.Get, the variable tags must be supplied in
+// the same order used when creating the vector; if they're incorrect, Stop
+// returns an error and doesn't record an observation.
+func (s VectorStopwatch) Stop(variableTagPairs ...string) (time.Duration, error) {
+	if s.hv == nil {
+		return 0, nil
+	}
+	elapsed := s.hv.clock.Now().Sub(s.start)
+	h, err := s.hv.Get(variableTagPairs...)
+	if err != nil {
+		return elapsed, err
+	}
+	h.Observe(elapsed)
+	return elapsed, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopwatch(t *testing.T) {
+	clock := newFakeClock()
+	root := New(WithClock(clock))
+	h, err := root.Scope().Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+
+	sw := h.Start()
+	clock.Add(42 * time.Millisecond)
+	assert.Equal(t, 42*time.Millisecond, sw.Stop(), "Unexpected elapsed time.")
+	assert.Equal(t, []int64{50}, h.snapshot().values(), "Unexpected observations.")
+
+	assert.Equal(t, time.Duration(0), Stopwatch{}.Stop(), "Unexpected elapsed time from zero Stopwatch.")
+	var nilHistogram *Histogram
+	assert.Equal(t, time.Duration(0), nilHistogram.Start().Stop(), "Unexpected elapsed time from no-op histogram.")
+
+	assertNoAllocs(t, func() {
+		h.Start().Stop()
+	}, "Unexpected allocations using Stopwatch.")
+}
+
+func TestVectorStopwatch(t *testing.T) {
+	clock := newFakeClock()
+	root := New(WithClock(clock))
+	hv, err := root.Scope().HistogramVector(HistogramSpec{
+		Spec:    Spec{Name: "test_latency_ms", Help: "Some help.", VarTags: []string{"outcome"}},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+
+	sw := hv.Start()
+	clock.Add(5 * time.Millisecond)
+	elapsed, err := sw.Stop("outcome", "success")
+	require.NoError(t, err, "Unexpected error stopping stopwatch.")
+	assert.Equal(t, 5*time.Millisecond, elapsed, "Unexpected elapsed time.")
+
+	sw = hv.Start()
+	clock.Add(20 * time.Millisecond)
+	_, err = sw.Stop("outcome", "error")
+	require.NoError(t, err, "Unexpected error stopping stopwatch.")
+
+	_, err = sw.Stop("wrong", "tags")
+	assert.Error(t, err, "Expected an error stopping stopwatch with wrong tags.")
+
+	assert.Equal(t, []int64{10}, hv.MustGet("outcome", "success").snapshot().values(), "Unexpected observations for success.")
+	assert.Equal(t, []int64{50}, hv.MustGet("outcome", "error").snapshot().values(), "Unexpected observations for error.")
+
+	elapsed, err = VectorStopwatch{}.Stop("outcome", "success")
+	assert.NoError(t, err, "Unexpected error from zero VectorStopwatch.")
+	assert.Zero(t, elapsed, "Unexpected elapsed time from zero VectorStopwatch.")
+	var nilVector *HistogramVector
+	_, err = nilVector.Start().Stop("outcome", "success")
+	assert.NoError(t, err, "Unexpected error from no-op vector.")
+
+	assertNoAllocs(t, func() {
+		hv.Start().Stop("outcome", "success")
+	}, "Unexpected allocations using VectorStopwatch.")
+}
+
+func TestSystemClockStopwatch(t *testing.T) {
+	h, err := New().Scope().Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_latency_ns", Help: "Some help."},
+		Unit:    time.Nanosecond,
+		Buckets: []int64{int64(time.Hour)},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	sw := h.Start()
+	time.Sleep(time.Millisecond)
+	assert.True(t, sw.Stop() >= time.Millisecond, "Expected elapsed time to include sleep.")
+	assert.Equal(t, int64(1), h.Count(), "Unexpected count.")
+}
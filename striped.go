@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"runtime"
+	"unsafe"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	_wordsPerCacheLine = 8 // 64-byte cache lines hold eight int64s
+	_maxStripes        = 128
+)
+
+// stripedCounts spreads a small array of counters across several shards,
+// each on its own cache lines, so that goroutines running on different CPUs
+// rarely contend. Writes touch a single shard, and reads sum all of them.
+type stripedCounts struct {
+	n      int    // counters per shard
+	width  int    // words per shard, including padding
+	shift  uint64 // for mapping hashes to shards
+	counts []atomic.Int64
+}
+
+func newStripedCounts(n int) *stripedCounts {
+	shards, shift := 1, uint64(64)
+	for shards < runtime.GOMAXPROCS(0) && shards < _maxStripes {
+		shards *= 2
+		shift--
+	}
+	// Round each shard up to a whole number of cache lines, then add another
+	// line of padding so that shards never share a line, even if the
+	// allocation itself isn't aligned.
+	width := (n+_wordsPerCacheLine-1)/_wordsPerCacheLine*_wordsPerCacheLine + _wordsPerCacheLine
+	return &stripedCounts{
+		n:      n,
+		width:  width,
+		shift:  shift,
+		counts: make([]atomic.Int64, shards*width),
+	}
+}
+
+// add adds delta to the ith counter in the current goroutine's shard.
+func (s *stripedCounts) add(i int, delta int64) {
+	s.counts[s.shard()*s.width+i].Add(delta)
+}
+
+// load sums the ith counter across all shards.
+func (s *stripedCounts) load(i int) int64 {
+	var total int64
+	for j := i; j < len(s.counts); j += s.width {
+		total += s.counts[j].Load()
+	}
+	return total
+}
+
+// swap zeroes the ith counter in every shard, returning the sum of the old
+// values. Concurrent adds land either before or after the swap, so none are
+// lost.
+func (s *stripedCounts) swap(i int) int64 {
+	var total int64
+	for j := i; j < len(s.counts); j += s.width {
+		total += s.counts[j].Swap(0)
+	}
+	return total
+}
+
+// shard cheaply picks a shard for the calling goroutine. Go doesn't expose
+// the current P or CPU, so we hash the address of a stack variable instead:
+// since each goroutine has its own stack, concurrent goroutines almost always
+// land on different shards. Correctness doesn't depend on the choice, so it's
+// fine that a goroutine's stack may move.
+func (s *stripedCounts) shard() int {
+	var marker byte
+	addr := uint64(uintptr(unsafe.Pointer(&marker)))
+	return int(((addr >> 10) * 0x9E3779B97F4A7C15) >> s.shift)
+}
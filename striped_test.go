@@ -0,0 +1,291 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	bucketpkg "go.uber.org/net/metrics/bucket"
+	"go.uber.org/net/metrics/tallypush"
+)
+
+// newStripedRoot creates a root with a counter, counter vector, histogram,
+// and histogram vector, all striped if requested, and records the same
+// observations from many goroutines.
+func newStripedRoot(t testing.TB, striped bool) *Root {
+	root := New()
+	scope := root.Scope()
+	spec := func(name string, vars ...string) Spec {
+		return Spec{Name: name, Help: "Some help.", VarTags: vars}
+	}
+	histSpec := func(s Spec) HistogramSpec {
+		return HistogramSpec{Spec: s, Unit: time.Millisecond, Buckets: []int64{10, 50, 100}, Striped: striped}
+	}
+
+	// Counters and striped counters have different method sets, so record
+	// observations through closures.
+	var inc, add2 func()
+	var incVec func(tag string)
+	if striped {
+		c, err := scope.StripedCounter(spec("test_counter"))
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		cv, err := scope.StripedCounterVector(spec("test_counter_vector", "var"))
+		require.NoError(t, err, "Unexpected error constructing counter vector.")
+		inc, add2 = c.Inc, func() { c.Add(2) }
+		incVec = func(tag string) { cv.MustGet("var", tag).Inc() }
+	} else {
+		c, err := scope.Counter(spec("test_counter"))
+		require.NoError(t, err, "Unexpected error constructing counter.")
+		cv, err := scope.CounterVector(spec("test_counter_vector", "var"))
+		require.NoError(t, err, "Unexpected error constructing counter vector.")
+		inc, add2 = func() { c.Inc() }, func() { c.Add(2) }
+		incVec = func(tag string) { cv.MustGet("var", tag).Inc() }
+	}
+	h, err := scope.Histogram(histSpec(spec("test_histogram")))
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	hv, err := scope.HistogramVector(histSpec(spec("test_histogram_vector", "var")))
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+
+	const goroutines, iterations = 16, 500
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			tag := fmt.Sprint(g % 2)
+			for i := 0; i < iterations; i++ {
+				inc()
+				add2()
+				incVec(tag)
+				h.IncBucket(int64(i % 200))
+				h.IncBucketN(75, 2)
+				hv.MustGet("var", tag).Observe(time.Duration(i) * time.Millisecond)
+			}
+			h.ObserveMany([]time.Duration{time.Millisecond, time.Second})
+		}(g)
+	}
+	wg.Wait()
+	return root
+}
+
+func TestStripedCounter(t *testing.T) {
+	scope := New().Scope()
+	c, err := scope.StripedCounter(Spec{Name: "test_counter", Help: "Some help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+
+	c.Inc()
+	c.Add(2)
+	c.Add(-10)
+	assert.Equal(t, int64(3), c.Load(), "Unexpected value after increments.")
+	assert.Equal(t, int64(3), c.counter().snapshot().Value, "Unexpected snapshot value.")
+	assert.Equal(t, int64(3), c.Reset(), "Unexpected value returned from Reset.")
+	assert.Equal(t, int64(0), c.Load(), "Unexpected value after reset.")
+
+	t.Run("vector", func(t *testing.T) {
+		cv, err := scope.StripedCounterVector(Spec{Name: "test_counter_vector", Help: "Some help.", VarTags: []string{"var"}})
+		require.NoError(t, err, "Unexpected error constructing counter vector.")
+		cv.MustGet("var", "b").Add(2)
+		c, err := cv.Lookup(NewVectorKey("var", "a"))
+		require.NoError(t, err, "Unexpected error looking up counter.")
+		c.Inc()
+		_, err = cv.Get("var")
+		assert.Error(t, err, "Expected an error with an odd number of tags.")
+		curried, err := cv.With("var", "b")
+		require.NoError(t, err, "Unexpected error currying vector.")
+		curried.MustGet().Inc()
+		_, err = cv.With("foo", "bar")
+		assert.Error(t, err, "Expected an error currying an unknown tag.")
+
+		got := make(map[string]int64)
+		cv.Range(func(tags Tags, c *StripedCounter) bool {
+			got[tags["var"]] = c.Load()
+			return true
+		})
+		assert.Equal(t, map[string]int64{"a": 1, "b": 3}, got, "Unexpected counters.")
+
+		cv.Reset()
+		cv.Range(func(Tags, *StripedCounter) bool {
+			t.Error("Expected vector to be empty after reset.")
+			return false
+		})
+	})
+}
+
+func TestStripedHistogram(t *testing.T) {
+	newHist := func(striped bool) *Histogram {
+		h, err := New().Scope().Histogram(HistogramSpec{
+			Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+			Unit:    time.Millisecond,
+			Buckets: []int64{10, 50},
+			Striped: striped,
+		})
+		require.NoError(t, err, "Unexpected error constructing histogram.")
+		return h
+	}
+	plain, striped := newHist(false), newHist(true)
+	for _, h := range []*Histogram{plain, striped} {
+		h.IncBucket(5)
+		h.IncBucketN(20, 3)
+		h.ObserveMany([]time.Duration{time.Millisecond, time.Minute})
+	}
+
+	assert.Equal(t, int64(6), striped.Count(), "Unexpected count.")
+	assert.Equal(t, plain.Sum(), striped.Sum(), "Unexpected sum.")
+	assert.Equal(t, plain.Quantile(0.5), striped.Quantile(0.5), "Unexpected median.")
+	assert.Equal(t, plain.snapshot(), striped.snapshot(), "Unexpected snapshot.")
+
+	t.Run("merge", func(t *testing.T) {
+		require.NoError(t, striped.Merge(plain), "Unexpected error merging into striped histogram.")
+		require.NoError(t, plain.Merge(striped), "Unexpected error merging striped histogram.")
+		assert.Equal(t, int64(12), striped.Count(), "Unexpected count after merge.")
+		assert.Equal(t, int64(18), plain.Count(), "Unexpected count after merge.")
+	})
+}
+
+func TestStripedMatchesUnstriped(t *testing.T) {
+	plain, striped := newStripedRoot(t, false), newStripedRoot(t, true)
+
+	t.Run("snapshot", func(t *testing.T) {
+		assert.Equal(t, plain.Snapshot(), striped.Snapshot(), "Snapshots should match.")
+	})
+
+	t.Run("proto", func(t *testing.T) {
+		want, err := plain.core.gather()
+		require.NoError(t, err, "Unexpected error gathering metrics.")
+		got, err := striped.core.gather()
+		require.NoError(t, err, "Unexpected error gathering metrics.")
+		assert.Equal(t, want, got, "Protobufs should match.")
+	})
+
+	t.Run("text", func(t *testing.T) {
+		_, want := serveText(t, plain, "")
+		_, got := serveText(t, striped, "")
+		assert.Equal(t, want, got, "Text exposition should match.")
+	})
+
+	t.Run("push", func(t *testing.T) {
+		pushed := func(root *Root) tally.Snapshot {
+			scope := tally.NewTestScope("" /* prefix */, nil /* tags */)
+			root.core.push(tallypush.New(scope))
+			return scope.Snapshot()
+		}
+		want, got := pushed(plain), pushed(striped)
+		require.Equal(t, len(want.Counters()), len(got.Counters()), "Unexpected number of pushed counters.")
+		for k, c := range want.Counters() {
+			assert.Equal(t, c.Value(), got.Counters()[k].Value(), "Unexpected value for pushed counter %q.", k)
+		}
+		require.Equal(t, len(want.Histograms()), len(got.Histograms()), "Unexpected number of pushed histograms.")
+		for k, h := range want.Histograms() {
+			assert.Equal(t, h.Durations(), got.Histograms()[k].Durations(), "Unexpected buckets for pushed histogram %q.", k)
+		}
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		assert.Equal(t, plain.Describe(), striped.Describe(), "Striping shouldn't affect descriptors.")
+	})
+}
+
+func TestStripedCountsLayout(t *testing.T) {
+	for _, n := range []int{1, 7, 8, 9, 17} {
+		s := newStripedCounts(n)
+		assert.True(t, s.width >= n+_wordsPerCacheLine, "Shards with %d counters should be padded by a full cache line.", n)
+		assert.Zero(t, s.width%_wordsPerCacheLine, "Shards with %d counters should fill whole cache lines.", n)
+		shards := len(s.counts) / s.width
+		assert.Zero(t, shards&(shards-1), "Expected a power-of-two number of shards, got %d.", shards)
+		assert.True(t, shards <= _maxStripes, "Expected at most %d shards, got %d.", _maxStripes, shards)
+		assert.True(t, s.shard() < shards, "Shard index out of range.")
+	}
+}
+
+func BenchmarkStriped(b *testing.B) {
+	for _, striped := range []bool{false, true} {
+		name := "unstriped"
+		if striped {
+			name = "striped"
+		}
+		meta := metadata{Name: new(string), Striped: striped}
+
+		b.Run("counter/"+name, func(b *testing.B) {
+			// Only striped counters can be converted to StripedCounters.
+			c := newCounter(meta)
+			b.ResetTimer()
+			if striped {
+				sc := (*StripedCounter)(c)
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						sc.Inc()
+					}
+				})
+				return
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.Inc()
+				}
+			})
+		})
+
+		b.Run("histogram/"+name, func(b *testing.B) {
+			h := newHistogram(meta, time.Millisecond, bucketpkg.NewRPCLatency(), systemClock{})
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var n int64
+				for pb.Next() {
+					h.IncBucket(n % 1000)
+					n++
+				}
+			})
+		})
+
+		// Reads and pushes are slower for striped metrics, since they sum
+		// across shards. Compare with BenchmarkHistogram and
+		// BenchmarkValueVector.
+		b.Run("histogram push/"+name, func(b *testing.B) {
+			pusher := tallypush.New(tally.NoopScope)
+			h := newHistogram(meta, time.Millisecond, bucketpkg.NewRPCLatency(), systemClock{})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.push(pusher)
+			}
+		})
+
+		b.Run("vector push/"+name, func(b *testing.B) {
+			const _loopLimit = 1000
+			vect := newCounterVector(metadata{Name: new(string), varTagNames: []string{"key"}, Striped: striped})
+			for i := 0; i < _loopLimit; i++ {
+				if _, err := vect.getOrCreate([]string{"key", fmt.Sprint("val", i)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			pusher := tallypush.New(tally.NoopScope)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				vect.push(pusher)
+			}
+		})
+	}
+}
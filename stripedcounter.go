@@ -0,0 +1,203 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import "fmt"
+
+// A StripedCounter is a Counter whose value is spread across cache-line
+// padded shards, so that goroutines running on different CPUs don't contend
+// with each other. Increments are much cheaper under contention, but reads
+// must sum all the shards, so they're slower. Since computing the new value
+// would defeat the purpose of striping, Add and Inc don't return it.
+//
+// Striped counters are exported exactly like Counters. All exported methods
+// are safe to use concurrently, and nil *StripedCounters are safe no-op
+// implementations.
+type StripedCounter Counter
+
+func (c *StripedCounter) counter() *Counter {
+	return (*Counter)(c)
+}
+
+// Add increases the value of the counter. Since counters must be
+// monotonically increasing, passing a negative number is a no-op.
+func (c *StripedCounter) Add(n int64) {
+	if c == nil || n <= 0 {
+		return
+	}
+	c.stripes.add(0, n)
+}
+
+// Inc increments the counter's value by one.
+func (c *StripedCounter) Inc() {
+	if c == nil {
+		return
+	}
+	c.stripes.add(0, 1)
+}
+
+// Load returns the counter's current value. It's not an atomic snapshot:
+// increments made while Load is summing the shards may or may not be
+// included.
+func (c *StripedCounter) Load() int64 {
+	return c.counter().Load()
+}
+
+// Reset sets the counter's value to zero and returns its previous value. See
+// Counter.Reset for details.
+func (c *StripedCounter) Reset() int64 {
+	return c.counter().Reset()
+}
+
+// A StripedCounterVector is a collection of StripedCounters that share a
+// name and some constant tags, but also have a consistent set of variable
+// tags. All exported methods are safe to use concurrently. Nil
+// *StripedCounterVectors are safe to use and always return no-op counters.
+//
+// For a general description of vector types, see the package-level
+// documentation.
+type StripedCounterVector struct {
+	vec *CounterVector
+}
+
+// Get retrieves the counter with the supplied variable tag names and values
+// from the vector, creating one if necessary. The variable tags must be
+// supplied in the same order used when creating the vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (v *StripedCounterVector) Get(variableTagPairs ...string) (*StripedCounter, error) {
+	if v == nil {
+		return nil, nil
+	}
+	c, err := v.vec.Get(variableTagPairs...)
+	return (*StripedCounter)(c), err
+}
+
+// Lookup behaves like Get, but identifies the counter with a precomputed key.
+//
+// Lookup returns an error if the key's tag names don't match the vector's.
+func (v *StripedCounterVector) Lookup(key VectorKey) (*StripedCounter, error) {
+	if v == nil {
+		return nil, nil
+	}
+	c, err := v.vec.Lookup(key)
+	return (*StripedCounter)(c), err
+}
+
+// With fixes some of the vector's variable tags, returning a narrower vector
+// whose Get method takes only the remaining tags. See CounterVector.With for
+// details.
+func (v *StripedCounterVector) With(tagPairs ...string) (*CurriedStripedCounterVector, error) {
+	if v == nil {
+		return nil, nil
+	}
+	c, err := v.vec.With(tagPairs...)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedStripedCounterVector{vec: c}, nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (v *StripedCounterVector) MustGet(variableTagPairs ...string) *StripedCounter {
+	if v == nil {
+		return nil
+	}
+	c, err := v.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get counter: %v", err))
+	}
+	return c
+}
+
+// Range calls f for each counter in the vector, sorted by tags, until f
+// returns false. The tags passed to f include the vector's constant tags.
+//
+// Range copies the vector's contents before calling f, so f may safely use
+// the vector. Counters created while Range is running aren't visited.
+func (v *StripedCounterVector) Range(f func(Tags, *StripedCounter) bool) {
+	if v == nil {
+		return
+	}
+	v.vec.Range(func(tags Tags, c *Counter) bool {
+		return f(tags, (*StripedCounter)(c))
+	})
+}
+
+// Reset drops all the counters in the vector. Counters retrieved before the
+// reset remain usable, but they're no longer exported.
+func (v *StripedCounterVector) Reset() {
+	if v == nil {
+		return
+	}
+	v.vec.Reset()
+}
+
+// A CurriedStripedCounterVector is a StripedCounterVector with some of its
+// variable tags fixed. It shares its counters with the original vector. All
+// exported methods are safe to use concurrently, and nil
+// *CurriedStripedCounterVectors are safe to use and always return no-op
+// counters.
+type CurriedStripedCounterVector struct {
+	vec *CurriedCounterVector
+}
+
+// Get retrieves the counter with the supplied remaining variable tag names
+// and values, creating one if necessary. The tags must be supplied in the
+// same order used when creating the original vector.
+//
+// Get returns an error if the number or order of tags is incorrect, or if the
+// root's ScrubPolicy rejects a tag value.
+func (c *CurriedStripedCounterVector) Get(variableTagPairs ...string) (*StripedCounter, error) {
+	if c == nil {
+		return nil, nil
+	}
+	sc, err := c.vec.Get(variableTagPairs...)
+	return (*StripedCounter)(sc), err
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (c *CurriedStripedCounterVector) MustGet(variableTagPairs ...string) *StripedCounter {
+	if c == nil {
+		return nil
+	}
+	sc, err := c.Get(variableTagPairs...)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get counter: %v", err))
+	}
+	return sc
+}
+
+// With fixes more of the vector's variable tags, returning an even narrower
+// vector.
+func (c *CurriedStripedCounterVector) With(tagPairs ...string) (*CurriedStripedCounterVector, error) {
+	if c == nil {
+		return nil, nil
+	}
+	next, err := c.vec.With(tagPairs...)
+	if err != nil {
+		return nil, err
+	}
+	return &CurriedStripedCounterVector{vec: next}, nil
+}
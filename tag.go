@@ -94,6 +94,18 @@ func (t Tags) less(other Tags) bool {
 	return cmp == -1
 }
 
+func (t Tags) equal(other Tags) bool {
+	if len(t) != len(other) {
+		return false
+	}
+	for k, v := range t {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
 func (t Tags) addToDigester(d *digester) {
 	names := make([]string, 0, len(t))
 	for k := range t {
@@ -156,6 +168,17 @@ func IsValidName(s string) bool {
 	return true
 }
 
+// isNameByte reports whether a byte may appear in a valid name after the
+// first position.
+func isNameByte(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || c == '_'
+}
+
+// isTagValueByte reports whether a byte may appear in a valid tag value.
+func isTagValueByte(c byte) bool {
+	return isNameByte(c) || c == '-' || c == '.'
+}
+
 // scrubName replaces any invalid runes in the input string with '_'. If the
 // input is already a valid tag and metric name (in both Prometheus and
 // Tally), it's returned unchanged.
@@ -52,6 +52,9 @@ func (tp *target) NewGauge(spec push.Spec) push.Gauge {
 }
 
 func (tp *target) NewHistogram(spec push.HistogramSpec) push.Histogram {
+	if len(spec.FloatBuckets) > 0 {
+		return newFloatHistogram(tp.Tagged(spec.Tags), spec)
+	}
 	buckets := make([]float64, len(spec.Buckets))
 	for i := range spec.Buckets {
 		if spec.Buckets[i] == math.MaxInt64 {
@@ -77,11 +80,22 @@ type counter struct {
 }
 
 func (c *counter) Set(total int64) {
-	delta := total - c.last
+	delta := sinceLast(c.last, total)
 	c.last = total
 	c.Inc(delta)
 }
 
+// sinceLast computes the change in a cumulative total since the last push. The
+// metrics package never pushes a decreasing total, even after a reset, but
+// other callers might: treat a smaller total as a restart from zero, so
+// everything in it is new.
+func sinceLast(last, total int64) int64 {
+	if total < last {
+		return total
+	}
+	return total - last
+}
+
 type gauge struct {
 	tally.Gauge
 }
@@ -129,7 +143,7 @@ func (th *histogram) ensureBucket(index int, bucket int64, panicOnError bool) {
 }
 
 func (th *histogram) recordValue(index int, bucket int64, total int64) {
-	delta := total - th.lasts[index]
+	delta := sinceLast(th.lasts[index], total)
 	th.lasts[index] = total
 
 	for i := int64(0); i < delta; i++ {
@@ -143,3 +157,59 @@ func (th *histogram) SetIndex(bucketIndex int, bucket int64, total int64) {
 	th.ensureBucket(bucketIndex, bucket, true)
 	th.recordValue(bucketIndex, bucket, total)
 }
+
+// A floatHistogram pushes histograms with floating-point bucket bounds.
+type floatHistogram struct {
+	tally.Histogram
+
+	// lasts keeps the last value pushed to tally
+	lasts []int64
+	// bucketValue keeps the bucket upper bounds, as reported to tally
+	bucketValue []float64
+}
+
+func newFloatHistogram(scope tally.Scope, spec push.HistogramSpec) *floatHistogram {
+	buckets := make([]float64, len(spec.FloatBuckets))
+	for i, upper := range spec.FloatBuckets {
+		buckets[i] = tallyBound(upper)
+	}
+	return &floatHistogram{
+		Histogram:   scope.Histogram(spec.Name, tally.ValueBuckets(buckets)),
+		lasts:       make([]int64, len(buckets)),
+		bucketValue: buckets,
+	}
+}
+
+// tallyBound replaces infinite bucket bounds, which Tally doesn't support.
+func tallyBound(upper float64) float64 {
+	switch {
+	case math.IsInf(upper, 1):
+		return math.MaxFloat64
+	case math.IsInf(upper, -1):
+		return -math.MaxFloat64
+	default:
+		return upper
+	}
+}
+
+func (th *floatHistogram) Set(bucket int64, total int64) {
+	index := sort.SearchFloat64s(th.bucketValue, float64(bucket))
+	th.SetFloatIndex(index, float64(bucket), total)
+}
+
+func (th *floatHistogram) SetIndex(bucketIndex int, bucket int64, total int64) {
+	th.SetFloatIndex(bucketIndex, float64(bucket), total)
+}
+
+func (th *floatHistogram) SetFloatIndex(bucketIndex int, bucket float64, total int64) {
+	upper := tallyBound(bucket)
+	if bucketIndex >= len(th.lasts) {
+		// The metrics package appends a catch-all bucket.
+		th.lasts = append(th.lasts, make([]int64, bucketIndex+1-len(th.lasts))...)
+	}
+	delta := sinceLast(th.lasts[bucketIndex], total)
+	th.lasts[bucketIndex] = total
+	for i := int64(0); i < delta; i++ {
+		th.RecordValue(upper)
+	}
+}
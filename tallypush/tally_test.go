@@ -23,6 +23,7 @@ package tallypush
 import (
 	"math"
 	"testing"
+	"time"
 
 	"go.uber.org/net/metrics"
 	"go.uber.org/net/metrics/push"
@@ -50,6 +51,32 @@ func TestCounter(t *testing.T) {
 	assert.Equal(t, int64(20), counters["test_counter+foo=bar"].Value(), "Unexpected exported value.")
 }
 
+func TestCounterReset(t *testing.T) {
+	scope := newScope()
+	target := New(scope)
+	c := target.NewCounter(push.Spec{Name: "test_counter"})
+	c.Set(10)
+	c.Set(3) // counter was reset, then incremented three times
+	c.Set(5)
+	counters := scope.Snapshot().Counters()
+	require.Equal(t, 1, len(counters), "Unexpected number of counters.")
+	assert.Equal(t, int64(15), counters["test_counter+"].Value(), "Unexpected exported value after reset.")
+}
+
+func TestHistogramReset(t *testing.T) {
+	scope := newScope()
+	target := New(scope)
+	h := target.NewHistogram(push.HistogramSpec{
+		Spec:    push.Spec{Name: "test_histogram"},
+		Buckets: []int64{5, math.MaxInt64},
+	})
+	h.SetIndex(0, 5, 3)
+	h.SetIndex(0, 5, 1) // histogram was reset, then observed once
+	histograms := scope.Snapshot().Histograms()
+	require.Equal(t, 1, len(histograms), "Unexpected number of histograms.")
+	assert.Equal(t, int64(4), histograms["test_histogram+"].Values()[5], "Unexpected exported count after reset.")
+}
+
 func TestGauge(t *testing.T) {
 	scope := newScope()
 	target := New(scope)
@@ -81,3 +108,51 @@ func TestHistogram(t *testing.T) {
 		histograms["test_histogram+foo=bar"].Values(),
 	)
 }
+
+func TestFloatHistogram(t *testing.T) {
+	scope := newScope()
+	target := New(scope)
+	h := target.NewHistogram(push.HistogramSpec{
+		Spec:         push.Spec{Name: "test_float_histogram", Tags: metrics.Tags{"foo": "bar"}},
+		FloatBuckets: []float64{-0.5, 0.5},
+	})
+	fh, ok := h.(push.FloatHistogram)
+	require.True(t, ok, "Expected float histogram to implement push.FloatHistogram.")
+	fh.SetFloatIndex(0, -0.5, 1)
+	fh.SetFloatIndex(0, -0.5, 3) // should overwrite previous value
+	fh.SetFloatIndex(2, math.Inf(1), 1)
+	h.SetIndex(1, 0, 2) // integer fallback
+
+	histograms := scope.Snapshot().Histograms()
+	require.Equal(t, 1, len(histograms), "Unexpected number of histograms.")
+	assert.Equal(
+		t,
+		map[float64]int64{-0.5: 3, 0.5: 2, math.MaxFloat64: 1},
+		histograms["test_float_histogram+foo=bar"].Values(),
+	)
+}
+
+func TestFloatHistogramEndToEnd(t *testing.T) {
+	root := metrics.New()
+	h, err := root.Scope().FloatHistogram(metrics.FloatHistogramSpec{
+		Spec:    metrics.Spec{Name: "test_ratio", Help: "Some help."},
+		Buckets: []float64{0.25, 0.75},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+	h.Observe(0.5)
+	h.Observe(0.5)
+	h.Observe(0.9)
+
+	scope := newScope()
+	stop, err := root.Push(New(scope), time.Hour)
+	require.NoError(t, err, "Unexpected error starting push.")
+	stop()
+
+	histograms := scope.Snapshot().Histograms()
+	require.Equal(t, 1, len(histograms), "Unexpected number of histograms.")
+	assert.Equal(
+		t,
+		map[float64]int64{0.25: 0, 0.75: 2, math.MaxFloat64: 1},
+		histograms["test_ratio+"].Values(),
+	)
+}
@@ -0,0 +1,398 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	promproto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	_openMetricsType        = "application/openmetrics-text"
+	_openMetricsContentType = _openMetricsType + "; version=1.0.0; charset=utf-8"
+
+	// Buffered output is written to the network once it exceeds
+	// _flushThreshold. Buffers that somehow grow beyond _maxPooledBuffer
+	// aren't reused.
+	_flushThreshold  = 32 * 1024
+	_maxPooledBuffer = 1024 * 1024
+)
+
+var (
+	_textWriterPool = sync.Pool{New: func() interface{} {
+		return &textWriter{buf: make([]byte, 0, 2*_flushThreshold)}
+	}}
+	_gzipPool = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}
+)
+
+// serveText writes the Prometheus text or OpenMetrics representation of the
+// core's metrics directly to the response, without building an intermediate
+// tree of protobufs. Metrics from external gatherers are included, but
+// they're gathered before writing anything so that errors can still be
+// reported with an appropriate status code.
+func (c *core) serveText(w http.ResponseWriter, req *http.Request, f *filter, openMetrics bool) {
+	c.refresh()
+	external, err := c.gatherExternal(f)
+	if err != nil {
+		// Match the Prometheus client's HTTPErrorOnError behavior.
+		http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	if openMetrics {
+		header.Set("Content-Type", _openMetricsContentType)
+	} else {
+		header.Set("Content-Type", string(expfmt.FmtText))
+	}
+	var out io.Writer = w
+	if gzipAccepted(req.Header) {
+		header.Set("Content-Encoding", "gzip")
+		gz := _gzipPool.Get().(*gzip.Writer)
+		gz.Reset(w)
+		defer func() {
+			gz.Close()
+			_gzipPool.Put(gz)
+		}()
+		out = gz
+	}
+
+	tw := newTextWriter(out, openMetrics, f)
+	defer tw.free()
+	for _, m := range c.all() {
+		if !f.matchMetadata(m.describe()) {
+			continue
+		}
+		m.text(tw)
+		tw.maybeFlush()
+	}
+	for _, family := range external {
+		tw.family(family)
+		tw.maybeFlush()
+	}
+	if openMetrics {
+		tw.buf = append(tw.buf, "# EOF\n"...)
+	}
+	tw.flush()
+}
+
+// negotiate inspects the Accept header and reports whether the client
+// prefers OpenMetrics or a protocol buffer encoding. Like the Prometheus
+// server, clients list media types in order of preference. Unless
+// allowOpenMetrics is set, OpenMetrics media types are skipped.
+func negotiate(h http.Header, allowOpenMetrics bool) (openMetrics, protobuf bool) {
+	accept := h.Get("Accept")
+	for accept != "" {
+		var part string
+		if i := strings.IndexByte(accept, ','); i >= 0 {
+			part, accept = accept[:i], accept[i+1:]
+		} else {
+			part, accept = accept, ""
+		}
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			part = part[:i]
+		}
+		switch strings.TrimSpace(part) {
+		case _openMetricsType:
+			if allowOpenMetrics {
+				return true, false
+			}
+		case expfmt.ProtoType:
+			return false, expfmt.Negotiate(h) != expfmt.FmtText
+		case "text/plain":
+			return false, false
+		}
+	}
+	return false, false
+}
+
+func gzipAccepted(h http.Header) bool {
+	encodings := h.Get("Accept-Encoding")
+	for encodings != "" {
+		var part string
+		if i := strings.IndexByte(encodings, ','); i >= 0 {
+			part, encodings = encodings[:i], encodings[i+1:]
+		} else {
+			part, encodings = encodings, ""
+		}
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
+
+// A textWriter buffers the Prometheus text or OpenMetrics representation of
+// metrics. Each family's header is written lazily, just before its first
+// sample, so families without any samples that satisfy the filter are
+// omitted entirely.
+type textWriter struct {
+	out         io.Writer
+	err         error
+	buf         []byte
+	openMetrics bool
+	filter      *filter
+
+	// scratch space for copying vectors' contents
+	children   []child
+	histograms []*Histogram
+
+	// current family
+	name, help string
+	typ        promproto.MetricType
+	pending    bool // header not yet written
+}
+
+func newTextWriter(out io.Writer, openMetrics bool, f *filter) *textWriter {
+	w := _textWriterPool.Get().(*textWriter)
+	w.out = out
+	w.openMetrics = openMetrics
+	w.filter = f
+	return w
+}
+
+func (w *textWriter) free() {
+	if cap(w.buf) > _maxPooledBuffer {
+		return
+	}
+	// Don't keep metrics reachable from the pool.
+	for i := range w.children {
+		w.children[i] = nil
+	}
+	for i := range w.histograms {
+		w.histograms[i] = nil
+	}
+	*w = textWriter{
+		buf:        w.buf[:0],
+		children:   w.children[:0],
+		histograms: w.histograms[:0],
+	}
+	_textWriterPool.Put(w)
+}
+
+func (w *textWriter) maybeFlush() {
+	if len(w.buf) >= _flushThreshold {
+		w.flush()
+	}
+}
+
+func (w *textWriter) flush() {
+	if w.err == nil && len(w.buf) > 0 {
+		_, w.err = w.out.Write(w.buf)
+	}
+	w.buf = w.buf[:0]
+}
+
+// begin starts a new metric family.
+func (w *textWriter) begin(meta metadata, typ promproto.MetricType) {
+	w.beginFamily(*meta.Name, *meta.Help, typ)
+}
+
+func (w *textWriter) beginFamily(name, help string, typ promproto.MetricType) {
+	w.name, w.help, w.typ = name, help, typ
+	w.pending = true
+}
+
+// accept reports whether a metric with the supplied tags satisfies the
+// filter. If so, it writes the current family's header (if necessary).
+func (w *textWriter) accept(pairs []*promproto.LabelPair) bool {
+	if !w.filter.matchTags(pairs) {
+		return false
+	}
+	if w.pending {
+		w.pending = false
+		w.writeHeader()
+	}
+	return true
+}
+
+func (w *textWriter) writeHeader() {
+	name := w.familyName()
+	w.buf = append(w.buf, "# HELP "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = appendEscaped(w.buf, w.help, w.openMetrics /* quote */)
+	w.buf = append(w.buf, "\n# TYPE "...)
+	w.buf = append(w.buf, name...)
+	w.buf = append(w.buf, ' ')
+	w.buf = append(w.buf, w.typeName()...)
+	w.buf = append(w.buf, '\n')
+}
+
+// familyName returns the name of the current family. OpenMetrics requires
+// counter samples to end in _total, but forbids that suffix in the family
+// name.
+func (w *textWriter) familyName() string {
+	if w.openMetrics && w.typ == promproto.MetricType_COUNTER {
+		return strings.TrimSuffix(w.name, "_total")
+	}
+	return w.name
+}
+
+// valueSuffix returns the suffix for simple counter, gauge, and untyped
+// samples in the current family.
+func (w *textWriter) valueSuffix() string {
+	if w.openMetrics && w.typ == promproto.MetricType_COUNTER {
+		return "_total"
+	}
+	return ""
+}
+
+func (w *textWriter) typeName() string {
+	switch w.typ {
+	case promproto.MetricType_COUNTER:
+		return "counter"
+	case promproto.MetricType_GAUGE:
+		return "gauge"
+	case promproto.MetricType_HISTOGRAM:
+		return "histogram"
+	case promproto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		if w.openMetrics {
+			return "unknown"
+		}
+		return "untyped"
+	}
+}
+
+// sample writes a single sample. The labels must already be rendered; an
+// additional label (typically the upper bound of a histogram bucket) may be
+// supplied separately.
+func (w *textWriter) sample(suffix, labels, extraName string, extraValue, value float64) {
+	w.buf = append(w.buf, w.familyName()...)
+	w.buf = append(w.buf, suffix...)
+	if labels != "" || extraName != "" {
+		w.buf = append(w.buf, '{')
+		w.buf = append(w.buf, labels...)
+		if extraName != "" {
+			if labels != "" {
+				w.buf = append(w.buf, ',')
+			}
+			w.buf = append(w.buf, extraName...)
+			w.buf = append(w.buf, `="`...)
+			w.buf = w.appendLabelFloat(w.buf, extraValue)
+			w.buf = append(w.buf, '"')
+		}
+		w.buf = append(w.buf, '}')
+	}
+	w.buf = append(w.buf, ' ')
+	w.buf = strconv.AppendFloat(w.buf, value, 'g', -1, 64)
+	w.buf = append(w.buf, '\n')
+}
+
+// appendLabelFloat formats floating-point label values, like bucket upper
+// bounds. OpenMetrics requires them to be canonical floats, so integral
+// values must include a decimal point.
+func (w *textWriter) appendLabelFloat(b []byte, f float64) []byte {
+	start := len(b)
+	b = strconv.AppendFloat(b, f, 'g', -1, 64)
+	if w.openMetrics && !math.IsInf(f, 0) && !math.IsNaN(f) &&
+		!bytes.ContainsAny(b[start:], ".e") {
+		b = append(b, ".0"...)
+	}
+	return b
+}
+
+// family writes a metric family gathered from an external source.
+func (w *textWriter) family(f *promproto.MetricFamily) {
+	w.beginFamily(f.GetName(), f.GetHelp(), f.GetType())
+	for _, m := range f.Metric {
+		if !w.accept(m.Label) {
+			continue
+		}
+		labels := renderLabels(m.Label)
+		switch {
+		case m.Counter != nil:
+			w.sample(w.valueSuffix(), labels, "", 0, m.Counter.GetValue())
+		case m.Gauge != nil:
+			w.sample("", labels, "", 0, m.Gauge.GetValue())
+		case m.Untyped != nil:
+			w.sample("", labels, "", 0, m.Untyped.GetValue())
+		case m.Summary != nil:
+			for _, q := range m.Summary.Quantile {
+				w.sample("", labels, "quantile", q.GetQuantile(), q.GetValue())
+			}
+			w.sample("_sum", labels, "", 0, m.Summary.GetSampleSum())
+			w.sample("_count", labels, "", 0, float64(m.Summary.GetSampleCount()))
+		case m.Histogram != nil:
+			infSeen := false
+			for _, b := range m.Histogram.Bucket {
+				w.sample("_bucket", labels, "le", b.GetUpperBound(), float64(b.GetCumulativeCount()))
+				infSeen = infSeen || math.IsInf(b.GetUpperBound(), 1)
+			}
+			if !infSeen {
+				w.sample("_bucket", labels, "le", math.Inf(1), float64(m.Histogram.GetSampleCount()))
+			}
+			w.sample("_sum", labels, "", 0, m.Histogram.GetSampleSum())
+			w.sample("_count", labels, "", 0, float64(m.Histogram.GetSampleCount()))
+		}
+	}
+}
+
+// renderLabels renders tags in the Prometheus text format, without the
+// enclosing braces. Since tag values are escaped, the result is also a
+// convenient sort key.
+func renderLabels(pairs []*promproto.LabelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b []byte
+	for i, pair := range pairs {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, pair.GetName()...)
+		b = append(b, `="`...)
+		b = appendEscaped(b, pair.GetValue(), true /* quote */)
+		b = append(b, '"')
+	}
+	return string(b)
+}
+
+// appendEscaped escapes backslashes, newlines, and (optionally) double quotes.
+func appendEscaped(b []byte, s string, quote bool) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			b = append(b, `\\`...)
+		case c == '\n':
+			b = append(b, `\n`...)
+		case c == '"' && quote:
+			b = append(b, `\"`...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return b
+}
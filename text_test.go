@@ -0,0 +1,366 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promproto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTextRoot(t testing.TB, opts ...Option) *Root {
+	root := New(opts...)
+	scope := root.Scope().Tagged(Tags{"service": "users"})
+
+	c, err := scope.Counter(Spec{Name: "test_counter_total", Help: "Counter help."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Add(1000000)
+
+	g, err := scope.Gauge(Spec{Name: "test_gauge", Help: "Multi-line\nhelp with \\ and \"."})
+	require.NoError(t, err, "Unexpected error constructing gauge.")
+	g.Store(-1)
+
+	cv, err := scope.CounterVector(Spec{
+		Name:    "test_counter_vector",
+		Help:    "Counter vector help.",
+		VarTags: []string{"b", "a"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	// Create children out of order.
+	for _, vals := range [][2]string{{"z", "1"}, {"x", "2"}, {"x_y", "3"}, {"x", "1"}, {"", ""}} {
+		cv.MustGet("b", vals[0], "a", vals[1]).Inc()
+	}
+
+	gv, err := scope.GaugeVector(Spec{
+		Name:    "test_gauge_vector",
+		Help:    "Gauge vector help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing gauge vector.")
+	gv.MustGet("var", "y").Store(2)
+	gv.MustGet("var", "x").Store(1)
+
+	h, err := scope.Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_histogram", Help: "Histogram help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 1000000},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	h.IncBucket(5)
+	h.IncBucket(2000000)
+
+	hv, err := scope.HistogramVector(HistogramSpec{
+		Spec: Spec{
+			Name:    "test_histogram_vector",
+			Help:    "Histogram vector help.",
+			VarTags: []string{"var"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 50},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram vector.")
+	hv.MustGet("var", "y").IncBucket(20)
+	hv.MustGet("var", "x").IncBucket(5)
+
+	fh, err := scope.FloatHistogram(FloatHistogramSpec{
+		Spec:    Spec{Name: "test_float_histogram", Help: "Float histogram help."},
+		Buckets: []float64{-1.5, 0, 0.25, 1e21},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram.")
+	fh.Observe(-3)
+	fh.Observe(0.1)
+	fh.Observe(2)
+
+	fhv, err := scope.FloatHistogramVector(FloatHistogramSpec{
+		Spec: Spec{
+			Name:    "test_float_histogram_vector",
+			Help:    "Float histogram vector help.",
+			VarTags: []string{"var"},
+		},
+		Buckets: []float64{0.5, 1},
+	})
+	require.NoError(t, err, "Unexpected error constructing float histogram vector.")
+	fhv.MustGet("var", "y").Observe(0.75)
+	fhv.MustGet("var", "x").Observe(0.125)
+
+	_, err = scope.CounterVector(Spec{
+		Name:    "test_empty_vector",
+		Help:    "Empty vector help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing empty vector.")
+
+	return root
+}
+
+func newExternalRegistry(t testing.TB) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	summary := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       "official_summary",
+		Help:       "Summary help.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+	}, []string{"var"})
+	summary.WithLabelValues("x").Observe(1)
+	untyped := prometheus.NewUntypedFunc(prometheus.UntypedOpts{
+		Name: "official_untyped",
+		Help: "Untyped help.",
+	}, func() float64 { return 3 })
+	registry.MustRegister(summary, untyped)
+	return registry
+}
+
+func serveText(t testing.TB, root *Root, accept string) (*httptest.ResponseRecorder, string) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, "Unexpected HTTP response code.")
+	return rec, rec.Body.String()
+}
+
+func TestTextMatchesPrometheusClient(t *testing.T) {
+	root := newTextRoot(t, WithGatherers(newExternalRegistry(t)))
+
+	families, err := root.core.gather()
+	require.NoError(t, err, "Unexpected error gathering metrics.")
+	var want bytes.Buffer
+	for _, f := range families {
+		_, err := expfmt.MetricFamilyToText(&want, f)
+		require.NoError(t, err, "Unexpected error encoding metrics with the Prometheus client.")
+	}
+
+	rec, got := serveText(t, root, "")
+	assert.Equal(t, string(expfmt.FmtText), rec.Header().Get("Content-Type"), "Unexpected content type.")
+	assert.Equal(t, want.String(), got, "Expected streaming output to match the Prometheus client.")
+}
+
+func TestOpenMetrics(t *testing.T) {
+	root := New(WithGatherers(newExternalRegistry(t)), WithOpenMetrics())
+	scope := root.Scope()
+
+	c, err := scope.Counter(Spec{Name: "test_counter_total", Help: `Counter "help".`})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Inc()
+	cv, err := scope.CounterVector(Spec{
+		Name:    "test_counter_vector",
+		Help:    "Counter vector help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	cv.MustGet("var", "x").Add(2)
+	h, err := scope.Histogram(HistogramSpec{
+		Spec:    Spec{Name: "test_histogram", Help: "Histogram help."},
+		Unit:    time.Millisecond,
+		Buckets: []int64{10, 1000000},
+	})
+	require.NoError(t, err, "Unexpected error constructing histogram.")
+	h.IncBucket(5)
+
+	rec, got := serveText(t, root, "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	assert.Equal(t, _openMetricsContentType, rec.Header().Get("Content-Type"), "Unexpected content type.")
+	assert.Equal(t, `# HELP test_counter Counter \"help\".
+# TYPE test_counter counter
+test_counter_total 1
+# HELP test_counter_vector Counter vector help.
+# TYPE test_counter_vector counter
+test_counter_vector_total{var="x"} 2
+# HELP test_histogram Histogram help.
+# TYPE test_histogram histogram
+test_histogram_bucket{le="10.0"} 1
+test_histogram_bucket{le="1e+06"} 1
+test_histogram_bucket{le="+Inf"} 1
+test_histogram_sum 5
+test_histogram_count 1
+# HELP official_summary Summary help.
+# TYPE official_summary summary
+official_summary{var="x",quantile="0.5"} 1
+official_summary{var="x",quantile="0.99"} 1
+official_summary_sum{var="x"} 1
+official_summary_count{var="x"} 1
+# HELP official_untyped Untyped help.
+# TYPE official_untyped unknown
+official_untyped 3
+# EOF
+`, got, "Unexpected OpenMetrics output.")
+}
+
+func TestOpenMetricsDisabled(t *testing.T) {
+	root := New()
+	c, err := root.Scope().Counter(Spec{Name: "requests", Help: "Total requests."})
+	require.NoError(t, err, "Unexpected error constructing counter.")
+	c.Inc()
+
+	// Prometheus 2.x sends this Accept header.
+	const accept = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+	rec, got := serveText(t, root, accept)
+	assert.Equal(t, string(expfmt.FmtText), rec.Header().Get("Content-Type"), "Unexpected content type.")
+	assert.Equal(t, "# HELP requests Total requests.\n# TYPE requests counter\nrequests 1\n", got, "Unexpected text output.")
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept      string
+		allow       bool
+		openMetrics bool
+		protobuf    bool
+	}{
+		{accept: ""},
+		{accept: "text/plain"},
+		{accept: "*/*"},
+		{accept: "text/plain;version=0.0.4;q=0.5,application/openmetrics-text", allow: true},
+		{accept: "application/openmetrics-text;version=1.0.0,text/plain;q=0.5", allow: true, openMetrics: true},
+		{accept: "application/openmetrics-text;version=1.0.0,text/plain;q=0.5"},
+		{accept: "application/openmetrics-text,application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", protobuf: true},
+		{accept: string(expfmt.FmtProtoDelim), protobuf: true},
+		{accept: string(expfmt.FmtProtoDelim) + ";q=0.7,text/plain;version=0.0.4;q=0.3", protobuf: true},
+		{accept: "application/vnd.google.protobuf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("Accept", tt.accept)
+			openMetrics, protobuf := negotiate(h, tt.allow)
+			assert.Equal(t, tt.openMetrics, openMetrics, "Unexpected OpenMetrics negotiation.")
+			assert.Equal(t, tt.protobuf, protobuf, "Unexpected protobuf negotiation.")
+		})
+	}
+}
+
+func TestTextGzip(t *testing.T) {
+	root := newTextRoot(t)
+	_, plain := serveText(t, root, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=1.0")
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, "Unexpected HTTP response code.")
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"), "Unexpected content encoding.")
+
+	r, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err, "Unexpected error reading gzipped response.")
+	decompressed, err := ioutil.ReadAll(r)
+	require.NoError(t, err, "Unexpected error decompressing response.")
+	assert.Equal(t, plain, string(decompressed), "Expected gzipped output to match plain text.")
+}
+
+func TestTextExternalErrors(t *testing.T) {
+	failing := prometheus.GathererFunc(func() ([]*promproto.MetricFamily, error) {
+		return nil, errors.New("gathering failed")
+	})
+	root := New(WithGatherers(failing))
+
+	rec := httptest.NewRecorder()
+	root.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "Unexpected HTTP response code.")
+	assert.Contains(t, rec.Body.String(), "gathering failed", "Expected error in response body.")
+}
+
+func TestTextLargeOutput(t *testing.T) {
+	// Make sure that output larger than the flush threshold is written
+	// completely and in order.
+	root := New()
+	vec, err := root.Scope().CounterVector(Spec{
+		Name:    "test_counter",
+		Help:    "Some help.",
+		VarTags: []string{"var"},
+	})
+	require.NoError(t, err, "Unexpected error constructing counter vector.")
+	for i := 0; i < 5000; i++ {
+		vec.MustGet("var", fmt.Sprintf("%05d", i)).Inc()
+	}
+
+	families, err := root.core.gather()
+	require.NoError(t, err, "Unexpected error gathering metrics.")
+	var want bytes.Buffer
+	_, err = expfmt.MetricFamilyToText(&want, families[0])
+	require.NoError(t, err, "Unexpected error encoding metrics with the Prometheus client.")
+	require.True(t, want.Len() > _flushThreshold, "Expected output to exceed flush threshold.")
+
+	_, got := serveText(t, root, "")
+	assert.Equal(t, want.String(), got, "Unexpected output.")
+}
+
+func TestTextAllocations(t *testing.T) {
+	root := newTextRoot(t)
+	metrics := root.core.all()
+	w := newTextWriter(ioutil.Discard, false /* OpenMetrics */, nil /* filter */)
+	defer w.free()
+
+	assertNoAllocs(t, func() {
+		for _, m := range metrics {
+			m.text(w)
+			w.flush()
+		}
+	}, "Expected writing text to be allocation-free.")
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	root := New()
+	vec, err := root.Scope().HistogramVector(HistogramSpec{
+		Spec: Spec{
+			Name:    "test_histogram",
+			Help:    "Some help.",
+			VarTags: []string{"var"},
+		},
+		Unit:    time.Millisecond,
+		Buckets: []int64{1, 5, 10, 50, 100, 500, 1000},
+	})
+	require.NoError(b, err, "Unexpected error constructing histogram vector.")
+	for i := 0; i < 10000; i++ {
+		vec.MustGet("var", fmt.Sprint(i)).IncBucket(int64(i % 1000))
+	}
+
+	for _, accept := range []string{"text/plain", string(expfmt.FmtProtoDelim)} {
+		b.Run(accept, func(b *testing.B) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", accept)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				root.ServeHTTP(discardResponseWriter{}, req)
+			}
+		})
+	}
+}
+
+// discardResponseWriter keeps benchmarks from measuring the cost of
+// buffering responses.
+type discardResponseWriter struct{}
+
+func (discardResponseWriter) Header() http.Header         { return http.Header{} }
+func (discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,411 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// A tagLayout describes a struct whose string fields hold a vector's
+// variable tags. Field offsets are computed once, so typed vectors can read
+// tag values without reflection or allocation.
+type tagLayout struct {
+	names   []string
+	offsets []uintptr
+}
+
+func newTagLayout(t reflect.Type) (tagLayout, error) {
+	if t.Kind() != reflect.Struct {
+		return tagLayout{}, fmt.Errorf("variable tags must be a struct, got %v", t)
+	}
+	var l tagLayout
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("metric"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		if f.Type.Kind() != reflect.String {
+			return tagLayout{}, fmt.Errorf("variable tag field %s.%s must be a string, got %v", t, f.Name, f.Type)
+		}
+		l.names = append(l.names, name)
+		l.offsets = append(l.offsets, f.Offset)
+	}
+	return l, nil
+}
+
+// spec sets the spec's variable tags to the layout's names. Users may supply
+// VarTags explicitly, but they must match.
+func (l tagLayout) spec(s Spec) (Spec, error) {
+	if len(s.VarTags) == 0 {
+		s.VarTags = l.names
+		return s, nil
+	}
+	if len(s.VarTags) != len(l.names) {
+		return s, fmt.Errorf("spec's variable tags %v don't match struct fields %v", s.VarTags, l.names)
+	}
+	for i := range l.names {
+		if s.VarTags[i] != l.names[i] {
+			return s, fmt.Errorf("spec's variable tags %v don't match struct fields %v", s.VarTags, l.names)
+		}
+	}
+	return s, nil
+}
+
+func (l tagLayout) value(tags unsafe.Pointer, i int) string {
+	return *(*string)(unsafe.Add(tags, l.offsets[i]))
+}
+
+// digest adds the struct's tag values to the digester, in the same format
+// vectors use for their map keys. It returns an error if the scrub policy
+// rejects a value.
+func (l tagLayout) digest(d *digester, m metadata, tags unsafe.Pointer) error {
+	for i := range l.offsets {
+		val, err := m.scrubTagValue(l.value(tags, i))
+		if err != nil {
+			return err
+		}
+		d.add("", val)
+	}
+	return nil
+}
+
+// pairs converts the struct to a list of variable tag pairs. It's only
+// needed when creating a new metric.
+func (l tagLayout) pairs(tags unsafe.Pointer) []string {
+	pairs := make([]string, 0, 2*len(l.names))
+	for i, name := range l.names {
+		pairs = append(pairs, name, l.value(tags, i))
+	}
+	return pairs
+}
+
+func layoutOf[T any]() (tagLayout, error) {
+	// reflect.TypeOf(zero) would be nil for interface types.
+	return newTagLayout(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// A CounterVec is a CounterVector whose variable tags are the string fields
+// of a struct. Since tags are supplied as a struct, the compiler checks
+// their names and order, and Get can only fail if the root's ScrubPolicy
+// rejects a tag value.
+//
+// Each exported string field is a variable tag, in the order the fields are
+// declared. By default, the tag name is the field name; a `metric:"name"`
+// struct tag overrides it, and `metric:"-"` skips the field. Fields of other
+// types aren't allowed.
+//
+// All methods are safe to use concurrently, and nil *CounterVecs are safe to
+// use and always return no-op counters.
+type CounterVec[T any] struct {
+	vec    *CounterVector
+	layout tagLayout
+}
+
+// NewCounterVec constructs a new CounterVec. The spec's VarTags are derived
+// from T, so they may be omitted.
+func NewCounterVec[T any](s *Scope, spec Spec) (*CounterVec[T], error) {
+	if s == nil {
+		return nil, nil
+	}
+	l, err := layoutOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	if spec, err = l.spec(spec); err != nil {
+		return nil, err
+	}
+	vec, err := s.CounterVector(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &CounterVec[T]{vec: vec, layout: l}, nil
+}
+
+// Get retrieves the counter with the supplied variable tags, creating one if
+// necessary. It returns an error if the root's ScrubPolicy rejects a tag
+// value.
+func (v *CounterVec[T]) Get(tags T) (*Counter, error) {
+	if v == nil {
+		return nil, nil
+	}
+	p := unsafe.Pointer(&tags)
+	digester := newDigester()
+	if err := v.layout.digest(digester, v.vec.meta, p); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := v.vec.index.load(digester.digest())
+	if !ok {
+		m = v.vec.get(digester.digest(), v.layout.pairs(p))
+	}
+	digester.free()
+	return m.(*Counter), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (v *CounterVec[T]) MustGet(tags T) *Counter {
+	if v == nil {
+		return nil
+	}
+	m, err := v.Get(tags)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get counter: %v", err))
+	}
+	return m
+}
+
+// Vector returns the underlying CounterVector.
+func (v *CounterVec[T]) Vector() *CounterVector {
+	if v == nil {
+		return nil
+	}
+	return v.vec
+}
+
+// A GaugeVec is a GaugeVector whose variable tags are the string fields of a
+// struct. See CounterVec for a description of the struct's requirements.
+//
+// All methods are safe to use concurrently, and nil *GaugeVecs are safe to
+// use and always return no-op gauges.
+type GaugeVec[T any] struct {
+	vec    *GaugeVector
+	layout tagLayout
+}
+
+// NewGaugeVec constructs a new GaugeVec. The spec's VarTags are derived from
+// T, so they may be omitted.
+func NewGaugeVec[T any](s *Scope, spec Spec) (*GaugeVec[T], error) {
+	if s == nil {
+		return nil, nil
+	}
+	l, err := layoutOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	if spec, err = l.spec(spec); err != nil {
+		return nil, err
+	}
+	vec, err := s.GaugeVector(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &GaugeVec[T]{vec: vec, layout: l}, nil
+}
+
+// Get retrieves the gauge with the supplied variable tags, creating one if
+// necessary. It returns an error if the root's ScrubPolicy rejects a tag
+// value.
+func (v *GaugeVec[T]) Get(tags T) (*Gauge, error) {
+	if v == nil {
+		return nil, nil
+	}
+	p := unsafe.Pointer(&tags)
+	digester := newDigester()
+	if err := v.layout.digest(digester, v.vec.meta, p); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := v.vec.index.load(digester.digest())
+	if !ok {
+		m = v.vec.get(digester.digest(), v.layout.pairs(p))
+	}
+	digester.free()
+	return m.(*Gauge), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (v *GaugeVec[T]) MustGet(tags T) *Gauge {
+	if v == nil {
+		return nil
+	}
+	m, err := v.Get(tags)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get gauge: %v", err))
+	}
+	return m
+}
+
+// Vector returns the underlying GaugeVector.
+func (v *GaugeVec[T]) Vector() *GaugeVector {
+	if v == nil {
+		return nil
+	}
+	return v.vec
+}
+
+// A HistogramVec is a HistogramVector whose variable tags are the string
+// fields of a struct. See CounterVec for a description of the struct's
+// requirements.
+//
+// All methods are safe to use concurrently, and nil *HistogramVecs are safe
+// to use and always return no-op histograms.
+type HistogramVec[T any] struct {
+	vec    *HistogramVector
+	layout tagLayout
+}
+
+// NewHistogramVec constructs a new HistogramVec. The spec's VarTags are
+// derived from T, so they may be omitted.
+func NewHistogramVec[T any](s *Scope, spec HistogramSpec) (*HistogramVec[T], error) {
+	if s == nil {
+		return nil, nil
+	}
+	l, err := layoutOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	if spec.Spec, err = l.spec(spec.Spec); err != nil {
+		return nil, err
+	}
+	vec, err := s.HistogramVector(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &HistogramVec[T]{vec: vec, layout: l}, nil
+}
+
+// Get retrieves the histogram with the supplied variable tags, creating one if
+// necessary. It returns an error if the root's ScrubPolicy rejects a tag
+// value.
+func (v *HistogramVec[T]) Get(tags T) (*Histogram, error) {
+	if v == nil {
+		return nil, nil
+	}
+	p := unsafe.Pointer(&tags)
+	digester := newDigester()
+	if err := v.layout.digest(digester, v.vec.meta, p); err != nil {
+		digester.free()
+		return nil, err
+	}
+	var h *Histogram
+	if m, ok := v.vec.index.load(digester.digest()); ok {
+		h = m.(*Histogram)
+	} else {
+		h = v.vec.get(digester.digest(), v.layout.pairs(p))
+	}
+	digester.free()
+	return h, nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (v *HistogramVec[T]) MustGet(tags T) *Histogram {
+	if v == nil {
+		return nil
+	}
+	m, err := v.Get(tags)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get histogram: %v", err))
+	}
+	return m
+}
+
+// Vector returns the underlying HistogramVector.
+func (v *HistogramVec[T]) Vector() *HistogramVector {
+	if v == nil {
+		return nil
+	}
+	return v.vec
+}
+
+// A FloatHistogramVec is a FloatHistogramVector whose variable tags are the
+// string fields of a struct. See CounterVec for a description of the
+// struct's requirements.
+//
+// All methods are safe to use concurrently, and nil *FloatHistogramVecs are
+// safe to use and always return no-op histograms.
+type FloatHistogramVec[T any] struct {
+	vec    *FloatHistogramVector
+	layout tagLayout
+}
+
+// NewFloatHistogramVec constructs a new FloatHistogramVec. The spec's
+// VarTags are derived from T, so they may be omitted.
+func NewFloatHistogramVec[T any](s *Scope, spec FloatHistogramSpec) (*FloatHistogramVec[T], error) {
+	if s == nil {
+		return nil, nil
+	}
+	l, err := layoutOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	if spec.Spec, err = l.spec(spec.Spec); err != nil {
+		return nil, err
+	}
+	vec, err := s.FloatHistogramVector(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &FloatHistogramVec[T]{vec: vec, layout: l}, nil
+}
+
+// Get retrieves the histogram with the supplied variable tags, creating one if
+// necessary. It returns an error if the root's ScrubPolicy rejects a tag
+// value.
+func (v *FloatHistogramVec[T]) Get(tags T) (*FloatHistogram, error) {
+	if v == nil {
+		return nil, nil
+	}
+	p := unsafe.Pointer(&tags)
+	digester := newDigester()
+	if err := v.layout.digest(digester, v.vec.meta, p); err != nil {
+		digester.free()
+		return nil, err
+	}
+	m, ok := v.vec.index.load(digester.digest())
+	if !ok {
+		m = v.vec.get(digester.digest(), v.layout.pairs(p))
+	}
+	digester.free()
+	return m.(*FloatHistogram), nil
+}
+
+// MustGet behaves exactly like Get, but panics on errors. If code using this
+// method is covered by unit tests, this is safe.
+func (v *FloatHistogramVec[T]) MustGet(tags T) *FloatHistogram {
+	if v == nil {
+		return nil
+	}
+	m, err := v.Get(tags)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get histogram: %v", err))
+	}
+	return m
+}
+
+// Vector returns the underlying FloatHistogramVector.
+func (v *FloatHistogramVec[T]) Vector() *FloatHistogramVector {
+	if v == nil {
+		return nil
+	}
+	return v.vec
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type outcome string
+
+type requestTags struct {
+	Service   string `metric:"service"`
+	Procedure string `metric:"procedure"`
+	Outcome   outcome
+	internal  int
+	Ignored   int `metric:"-"`
+}
+
+func TestTypedVectors(t *testing.T) {
+	scope := New().Scope()
+	tags := requestTags{Service: "users", Procedure: "get all", Outcome: "success"}
+	pairs := []string{"service", "users", "procedure", "get all", "Outcome", "success"}
+
+	t.Run("counter", func(t *testing.T) {
+		vec, err := NewCounterVec[requestTags](scope, Spec{Name: "test_counter", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		c, err := vec.Get(tags)
+		require.NoError(t, err, "Unexpected error getting counter.")
+		assert.True(t, c == vec.Vector().MustGet(pairs...), "Expected typed and untyped vectors to share counters.")
+		assert.Equal(t, Tags{"service": "users", "procedure": "get_all", "Outcome": "success"}, c.snapshot().Tags,
+			"Unexpected tags.")
+	})
+
+	t.Run("gauge", func(t *testing.T) {
+		vec, err := NewGaugeVec[requestTags](scope, Spec{Name: "test_gauge", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		assert.True(t, vec.MustGet(tags) == vec.Vector().MustGet(pairs...), "Expected typed and untyped vectors to share gauges.")
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		vec, err := NewHistogramVec[requestTags](scope, HistogramSpec{
+			Spec:    Spec{Name: "test_histogram", Help: "Some help."},
+			Unit:    time.Millisecond,
+			Buckets: []int64{10},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		assert.True(t, vec.MustGet(tags) == vec.Vector().MustGet(pairs...), "Expected typed and untyped vectors to share histograms.")
+	})
+
+	t.Run("float histogram", func(t *testing.T) {
+		vec, err := NewFloatHistogramVec[requestTags](scope, FloatHistogramSpec{
+			Spec:    Spec{Name: "test_float_histogram", Help: "Some help."},
+			Buckets: []float64{0.5},
+		})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		assert.True(t, vec.MustGet(tags) == vec.Vector().MustGet(pairs...), "Expected typed and untyped vectors to share histograms.")
+	})
+
+	t.Run("explicit VarTags", func(t *testing.T) {
+		_, err := NewCounterVec[requestTags](scope, Spec{
+			Name:    "test_explicit",
+			Help:    "Some help.",
+			VarTags: []string{"service", "procedure", "Outcome"},
+		})
+		assert.NoError(t, err, "Unexpected error with matching VarTags.")
+
+		_, err = NewCounterVec[requestTags](scope, Spec{
+			Name:    "test_mismatched",
+			Help:    "Some help.",
+			VarTags: []string{"procedure", "service", "Outcome"},
+		})
+		assert.Error(t, err, "Expected an error with mismatched VarTags.")
+	})
+
+	t.Run("allocations", func(t *testing.T) {
+		vec, err := NewCounterVec[requestTags](scope, Spec{Name: "test_allocs", Help: "Some help."})
+		require.NoError(t, err, "Unexpected error constructing vector.")
+		// Scrubbing invalid tag values allocates, so use valid ones.
+		tags := requestTags{Service: "users", Procedure: "get", Outcome: "success"}
+		vec.MustGet(tags)
+		assertNoAllocs(t, func() {
+			vec.MustGet(tags).Inc()
+		}, "Expected Get to be allocation-free for existing counters.")
+	})
+}
+
+func TestTypedVectorErrors(t *testing.T) {
+	scope := New().Scope()
+	spec := Spec{Name: "test", Help: "Some help."}
+
+	_, err := NewCounterVec[string](scope, spec)
+	assert.Error(t, err, "Expected an error using a non-struct type.")
+
+	_, err = NewCounterVec[error](scope, spec)
+	assert.Error(t, err, "Expected an error using an interface type.")
+
+	_, err = NewGaugeVec[*struct{ A string }](scope, spec)
+	assert.Error(t, err, "Expected an error using a pointer type.")
+
+	_, err = NewCounterVec[struct{ Count int }](scope, spec)
+	assert.Error(t, err, "Expected an error using a non-string field.")
+
+	_, err = NewCounterVec[struct{}](scope, spec)
+	assert.Error(t, err, "Expected an error using a struct without tags.")
+
+	_, err = NewGaugeVec[struct {
+		A string `metric:"dup"`
+		B string `metric:"dup"`
+	}](scope, spec)
+	assert.Error(t, err, "Expected an error using duplicate tag names.")
+
+	_, err = NewHistogramVec[struct{ A string }](scope, HistogramSpec{Spec: spec})
+	assert.Error(t, err, "Expected an error using an invalid spec.")
+
+	_, err = NewFloatHistogramVec[struct{ A int }](scope, FloatHistogramSpec{Spec: spec, Buckets: []float64{1}})
+	assert.Error(t, err, "Expected an error using a non-string field.")
+}
+
+func TestNopTypedVectors(t *testing.T) {
+	var s *Scope
+	type tags struct{ Foo string }
+
+	cv, err := NewCounterVec[tags](s, Spec{})
+	require.NoError(t, err, "Error calling NewCounterVec on nil scope.")
+	assert.Nil(t, cv.Vector(), "Expected no-op vector to wrap a nil vector.")
+	assertNopCounter(t, cv.MustGet(tags{"bar"}))
+	c, err := cv.Get(tags{"bar"})
+	require.NoError(t, err, "Failed Get from no-op CounterVec.")
+	assertNopCounter(t, c)
+
+	gv, err := NewGaugeVec[tags](s, Spec{})
+	require.NoError(t, err, "Error calling NewGaugeVec on nil scope.")
+	assert.Nil(t, gv.Vector(), "Expected no-op vector to wrap a nil vector.")
+	assertNopGauge(t, gv.MustGet(tags{"bar"}))
+	g, err := gv.Get(tags{"bar"})
+	require.NoError(t, err, "Failed Get from no-op GaugeVec.")
+	assertNopGauge(t, g)
+
+	hv, err := NewHistogramVec[tags](s, HistogramSpec{})
+	require.NoError(t, err, "Error calling NewHistogramVec on nil scope.")
+	assert.Nil(t, hv.Vector(), "Expected no-op vector to wrap a nil vector.")
+	assertNopHistogram(t, hv.MustGet(tags{"bar"}))
+	h, err := hv.Get(tags{"bar"})
+	require.NoError(t, err, "Failed Get from no-op HistogramVec.")
+	assertNopHistogram(t, h)
+
+	fv, err := NewFloatHistogramVec[tags](s, FloatHistogramSpec{})
+	require.NoError(t, err, "Error calling NewFloatHistogramVec on nil scope.")
+	assert.Nil(t, fv.Vector(), "Expected no-op vector to wrap a nil vector.")
+	assertNopFloatHistogram(t, fv.MustGet(tags{"bar"}))
+	f, err := fv.Get(tags{"bar"})
+	require.NoError(t, err, "Failed Get from no-op FloatHistogramVec.")
+	assertNopFloatHistogram(t, f)
+}
+
+func BenchmarkTypedVector(b *testing.B) {
+	vec, err := NewCounterVec[requestTags](New().Scope(), Spec{Name: "test", Help: "Some help."})
+	require.NoError(b, err, "Unexpected error constructing vector.")
+	tags := requestTags{Service: "users", Procedure: "get", Outcome: "success"}
+	vec.MustGet(tags)
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vec.MustGet(tags).Inc()
+	}
+}
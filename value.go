@@ -35,19 +35,24 @@ type value struct {
 
 	meta     metadata
 	tagPairs []*promproto.LabelPair
+	labels   string // rendered tagPairs, used for sorting and text output
 }
 
 func newValue(m metadata) value {
+	pairs := m.MergeTags(nil /* variable tags */)
 	return value{
 		meta:     m,
-		tagPairs: m.MergeTags(nil /* variable tags */),
+		tagPairs: pairs,
+		labels:   renderLabels(pairs),
 	}
 }
 
 func newDynamicValue(m metadata, variableTagPairs []string) value {
+	pairs := m.MergeTags(variableTagPairs)
 	return value{
 		meta:     m,
-		tagPairs: m.MergeTags(variableTagPairs),
+		tagPairs: pairs,
+		labels:   renderLabels(pairs),
 	}
 }
 
@@ -67,11 +72,21 @@ type vector struct {
 	// and the variable tag keys and values.
 	factory func(metadata, []string) metric
 
+	// index maps digested variable tag values to metrics. Lookups of existing
+	// metrics don't lock metricsMu.
+	index readMap
+
+	// metricsMu guards creation of new metrics and the slices below.
 	metricsMu sync.RWMutex
-	// key is variable tag vals, the value is the index to metricsStorage. We do this to reduce GC.
-	metrics map[string]uint32
 	// this is needed to reduce overhead of for loop because looping a map is more expensive
 	metricsStorage []metric
+	// the same metrics, ordered by their rendered tags for exposition unless
+	// unsorted is set
+	sorted []child
+	// unsorted is set when metrics are appended to sorted. Rather than
+	// inserting each new metric in order, which makes building large vectors
+	// quadratic, we sort lazily before the next export.
+	unsorted bool
 }
 
 func (vec *vector) getOrCreate(variableTagPairs []string) (metric, error) {
@@ -79,47 +94,104 @@ func (vec *vector) getOrCreate(variableTagPairs []string) (metric, error) {
 		return nil, err
 	}
 	digester := newDigester()
-	for i := 0; i < len(variableTagPairs)/2; i++ {
-		digester.add("", scrubTagValue(variableTagPairs[i*2+1]))
+	if err := vec.meta.digestVariableTags(digester, variableTagPairs); err != nil {
+		digester.free()
+		return nil, err
 	}
+	m := vec.get(digester.digest(), variableTagPairs)
+	digester.free()
+	return m, nil
+}
 
-	vec.metricsMu.RLock()
-	mIndex, ok := vec.metrics[string(digester.digest())]
+func (vec *vector) lookup(key VectorKey) (metric, error) {
+	if !vec.meta.scrubber.isDefault() {
+		// Keys are digested with the default policy, and scrubbing them
+		// wasn't reported.
+		return vec.getOrCreate(key.pairs)
+	}
+	if err := vec.meta.ValidateVariableTags(key.pairs); err != nil {
+		return nil, err
+	}
+	return vec.get(key.digest, key.pairs), nil
+}
 
-	if ok {
-		m := vec.metricsStorage[mIndex]
-		vec.metricsMu.RUnlock()
+func (vec *vector) get(key []byte, variableTagPairs []string) metric {
+	if m, ok := vec.index.load(key); ok {
+		return m.(metric)
+	}
+	vec.metricsMu.Lock()
+	m := vec.newValue(key, variableTagPairs)
+	vec.metricsMu.Unlock()
+	return m
+}
 
-		digester.free()
-		return m, nil
+func (vec *vector) newValue(key []byte, variableTagPairs []string) metric {
+	if m, ok := vec.index.loadLocked(key); ok {
+		return m.(metric)
 	}
+	// Copy the tags so that callers' variadic slices don't escape, which keeps
+	// Get allocation-free for existing metrics.
+	m := vec.factory(vec.meta, append([]string(nil), variableTagPairs...))
+	vec.index.storeLocked(key, m)
+	vec.metricsStorage = append(vec.metricsStorage, m)
+	vec.sorted = append(vec.sorted, m.(child))
+	vec.unsorted = true
+	return m
+}
 
+// sortedChildren appends the vector's metrics, ordered by their rendered
+// tags, to dst. It sorts the vector's metrics only if new ones were added
+// since the last call.
+func (vec *vector) sortedChildren(dst []child) []child {
+	vec.metricsMu.RLock()
+	if !vec.unsorted {
+		dst = append(dst, vec.sorted...)
+		vec.metricsMu.RUnlock()
+		return dst
+	}
 	vec.metricsMu.RUnlock()
 
 	vec.metricsMu.Lock()
-	m, err := vec.newValue(digester.digest(), variableTagPairs)
+	if vec.unsorted {
+		sortChildren(vec.sorted)
+		vec.unsorted = false
+	}
+	dst = append(dst, vec.sorted...)
 	vec.metricsMu.Unlock()
-	digester.free()
-
-	return m, err
+	return dst
 }
 
-func (vec *vector) newValue(key []byte, variableTagPairs []string) (metric, error) {
-	mIndex, ok := vec.metrics[string(key)]
-	if ok {
-		m := vec.metricsStorage[mIndex]
-		return m, nil
+// samples writes the text representation of each metric in the vector. To
+// avoid blocking the creation of new metrics on slow clients, it copies the
+// vector's contents to scratch space before writing anything.
+func (vec *vector) samples(w *textWriter) {
+	w.children = vec.sortedChildren(w.children[:0])
+	for _, c := range w.children {
+		c.samples(w)
+		w.maybeFlush()
 	}
-	m := vec.factory(vec.meta, variableTagPairs)
-	vec.metrics[string(key)] = uint32(len(vec.metricsStorage))
-	vec.metricsStorage = append(vec.metricsStorage, m)
-	return m, nil
+}
+
+// reset drops all the vector's metrics.
+func (vec *vector) reset() {
+	vec.metricsMu.Lock()
+	vec.index.resetLocked()
+	vec.metricsStorage = make([]metric, 0, _defaultCollectionSize)
+	vec.sorted = nil
+	vec.unsorted = false
+	vec.metricsMu.Unlock()
+}
+
+// children copies the vector's metrics, so that callers can iterate over
+// them without holding the lock.
+func (vec *vector) children() []child {
+	return vec.sortedChildren(nil)
 }
 
 func (vec *vector) snapshot() []Snapshot {
 	vec.metricsMu.RLock()
 	defer vec.metricsMu.RUnlock()
-	snaps := make([]Snapshot, 0, len(vec.metrics))
+	snaps := make([]Snapshot, 0, len(vec.metricsStorage))
 	for _, m := range vec.metricsStorage {
 		switch v := m.(type) {
 		case *Counter:
@@ -2,8 +2,12 @@ package metrics
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/uber-go/tally"
 	"go.uber.org/net/metrics/tallypush"
@@ -35,6 +39,32 @@ func BenchmarkValueVector(b *testing.B) {
 		}
 	})
 
+	b.Run("lookup", func(b *testing.B) {
+		vect := newCounterVector(metadata{varTagNames: []string{"key"}})
+		key := NewVectorKey("key", "val0")
+		if _, err := vect.lookup(key); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			c, _ := vect.Lookup(key)
+			runtime.KeepAlive(c)
+		}
+	})
+
+	b.Run("get parallel", func(b *testing.B) {
+		vect := newCounterVector(metadata{varTagNames: []string{"key"}})
+		vect.MustGet("key", "val0")
+		b.ResetTimer()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				runtime.KeepAlive(vect.MustGet("key", "val0"))
+			}
+		})
+	})
+
 	const _loopLimit = 10_000
 	b.Run(fmt.Sprint("loop", _loopLimit), func(b *testing.B) {
 		name := ""
@@ -53,3 +83,49 @@ func BenchmarkValueVector(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkVectorCreation builds vectors with many children and then exports
+// them once, so it measures both creating and sorting children.
+func BenchmarkVectorCreation(b *testing.B) {
+	for _, n := range []int{1_000, 100_000} {
+		b.Run(fmt.Sprint("counter/", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				root := New()
+				vec, err := root.Scope().CounterVector(Spec{
+					Name:    "test_counter",
+					Help:    "Some help.",
+					VarTags: []string{"key"},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := n; j > 0; j-- {
+					vec.MustGet("key", strconv.Itoa(j)).Inc()
+				}
+				root.ServeHTTP(discardResponseWriter{}, httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+		})
+
+		b.Run(fmt.Sprint("histogram/", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				root := New()
+				vec, err := root.Scope().HistogramVector(HistogramSpec{
+					Spec: Spec{
+						Name:    "test_histogram",
+						Help:    "Some help.",
+						VarTags: []string{"key"},
+					},
+					Unit:    time.Millisecond,
+					Buckets: []int64{1, 10, 100},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := n; j > 0; j-- {
+					vec.MustGet("key", strconv.Itoa(j)).IncBucket(int64(j % 100))
+				}
+				root.ServeHTTP(discardResponseWriter{}, httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	_defaultWindowSlices = 6
+	_maxWindowSlices     = 64 // so that a uint64 can track live slices
+)
+
+// A WindowedHistogramSpec configures WindowedHistograms.
+type WindowedHistogramSpec struct {
+	HistogramSpec
+
+	// Window is the length of time covered by the histogram's in-process
+	// estimates.
+	Window time.Duration
+	// Slices is the number of sub-histograms used to approximate the sliding
+	// window; the window advances in increments of Window/Slices. More slices
+	// track the window more precisely, but make reads slower. If zero, it
+	// defaults to six. It may not exceed 64.
+	Slices int
+}
+
+func (ws WindowedHistogramSpec) validate() error {
+	if err := ws.HistogramSpec.validateScalar(); err != nil {
+		return err
+	}
+	if ws.Slices < 0 || ws.Slices > _maxWindowSlices {
+		return fmt.Errorf("windowed histograms must have between 1 and %d slices, got %d", _maxWindowSlices, ws.Slices)
+	}
+	if ws.Window < time.Duration(ws.slices()) {
+		return fmt.Errorf("window must be at least one nanosecond per slice, got %v", ws.Window)
+	}
+	return nil
+}
+
+func (ws WindowedHistogramSpec) slices() int {
+	if ws.Slices == 0 {
+		return _defaultWindowSlices
+	}
+	return ws.Slices
+}
+
+// A WindowedHistogram is a Histogram that can also estimate statistics over
+// a recent window of time. It's useful for in-process decisions that should
+// respond quickly to changes, like adaptive timeouts and load shedding.
+//
+// Prometheus and push targets always see cumulative data, exactly as if the
+// WindowedHistogram were an ordinary Histogram. Only the Count, Sum,
+// Quantile, and Mean methods are windowed.
+//
+// Internally, the window is divided into a ring of sub-histograms (slices).
+// As time passes, the oldest slice is cleared and reused, so the window
+// advances in steps of Window/Slices: estimates cover between Window minus
+// one slice and Window of recent observations.
+//
+// All exported methods are safe to use concurrently, and nil
+// *WindowedHistograms are valid no-op implementations.
+type WindowedHistogram struct {
+	cumulative *Histogram
+	clock      Clock
+	width      int64 // slice width, in nanoseconds
+
+	rotate sync.Mutex // held while clearing a slice
+	slices []windowSlice
+}
+
+type windowSlice struct {
+	epoch   atomic.Int64 // (time since Unix epoch) / width
+	buckets []atomic.Int64
+	sum     atomic.Int64
+}
+
+func newWindowedHistogram(h *Histogram, clock Clock, window time.Duration, n int) *WindowedHistogram {
+	w := &WindowedHistogram{
+		cumulative: h,
+		clock:      clock,
+		width:      int64(window) / int64(n),
+		slices:     make([]windowSlice, n),
+	}
+	for i := range w.slices {
+		w.slices[i].epoch.Store(math.MinInt64) // never current
+		w.slices[i].buckets = make([]atomic.Int64, len(h.buckets))
+	}
+	return w
+}
+
+// Observe finds the correct bucket for the supplied duration and increments
+// its counter, both in the cumulative histogram and in the current window.
+func (w *WindowedHistogram) Observe(d time.Duration) {
+	if w == nil {
+		return
+	}
+	w.IncBucket(int64(d / w.cumulative.unit))
+}
+
+// IncBucket bypasses the time-based Observe API and increments a histogram
+// bucket directly.
+func (w *WindowedHistogram) IncBucket(n int64) {
+	w.IncBucketN(n, 1)
+}
+
+// IncBucketN behaves like IncBucket, but records count observations of the
+// supplied value at once. Non-positive counts are ignored.
+func (w *WindowedHistogram) IncBucketN(n, count int64) {
+	if w == nil || count <= 0 {
+		return
+	}
+	w.cumulative.IncBucketN(n, count)
+	s := w.current()
+	s.buckets[w.cumulative.buckets.index(n)].Add(count)
+	s.sum.Add(n * count)
+}
+
+// ObserveN behaves like Observe, but records count observations of the
+// supplied duration at once. Non-positive counts are ignored.
+func (w *WindowedHistogram) ObserveN(d time.Duration, count int64) {
+	if w == nil {
+		return
+	}
+	w.IncBucketN(int64(d/w.cumulative.unit), count)
+}
+
+// ObserveMany records a batch of observations.
+func (w *WindowedHistogram) ObserveMany(ds []time.Duration) {
+	if w == nil || len(ds) == 0 {
+		return
+	}
+	w.cumulative.ObserveMany(ds)
+	s := w.current()
+	var sum int64
+	for _, d := range ds {
+		n := int64(d / w.cumulative.unit)
+		s.buckets[w.cumulative.buckets.index(n)].Inc()
+		sum += n
+	}
+	s.sum.Add(sum)
+}
+
+// Cumulative returns the underlying cumulative histogram, which is what
+// Prometheus and push targets see. Observations should be recorded with the
+// WindowedHistogram's methods, not the cumulative histogram's.
+func (w *WindowedHistogram) Cumulative() *Histogram {
+	if w == nil {
+		return nil
+	}
+	return w.cumulative
+}
+
+// Count returns the number of observations in the window.
+func (w *WindowedHistogram) Count() int64 {
+	if w == nil {
+		return 0
+	}
+	live := w.live()
+	var n int64
+	for i := range w.slices {
+		if live&(1<<uint(i)) != 0 {
+			for j := range w.slices[i].buckets {
+				n += w.slices[i].buckets[j].Load()
+			}
+		}
+	}
+	return n
+}
+
+// Sum returns the exact sum of the values observed in the window, in units.
+func (w *WindowedHistogram) Sum() int64 {
+	if w == nil {
+		return 0
+	}
+	live := w.live()
+	var sum int64
+	for i := range w.slices {
+		if live&(1<<uint(i)) != 0 {
+			sum += w.slices[i].sum.Load()
+		}
+	}
+	return sum
+}
+
+// Quantile estimates the qth quantile (0 <= q <= 1) of the values observed in
+// the window, in units. See Histogram.Quantile for details.
+func (w *WindowedHistogram) Quantile(q float64) float64 {
+	if w == nil {
+		return math.NaN()
+	}
+	live := w.live()
+	var count uint64
+	for i := range w.slices {
+		if live&(1<<uint(i)) != 0 {
+			for j := range w.slices[i].buckets {
+				count += uint64(w.slices[i].buckets[j].Load())
+			}
+		}
+	}
+	var cumulative uint64
+	return quantile(q, count, len(w.cumulative.buckets), func(j int) (float64, uint64) {
+		for i := range w.slices {
+			if live&(1<<uint(i)) != 0 {
+				cumulative += uint64(w.slices[i].buckets[j].Load())
+			}
+		}
+		return upperBound(w.cumulative.buckets[j].upper), cumulative
+	})
+}
+
+// Mean returns the mean of the values observed in the window, in units. It
+// returns NaN if the window is empty.
+func (w *WindowedHistogram) Mean() float64 {
+	if w == nil {
+		return math.NaN()
+	}
+	return mean(w.Sum(), w.Count())
+}
+
+// Reset clears both the cumulative histogram and the window.
+func (w *WindowedHistogram) Reset() {
+	if w == nil {
+		return
+	}
+	w.cumulative.Reset()
+	w.rotate.Lock()
+	for i := range w.slices {
+		s := &w.slices[i]
+		s.epoch.Store(math.MinInt64) // never current
+		for j := range s.buckets {
+			s.buckets[j].Store(0)
+		}
+		s.sum.Store(0)
+	}
+	w.rotate.Unlock()
+}
+
+func (w *WindowedHistogram) reset() {
+	w.Reset()
+}
+
+func (w *WindowedHistogram) epoch() int64 {
+	return w.clock.Now().UnixNano() / w.width
+}
+
+// current returns the slice for the current epoch, clearing it first if it
+// last held an older epoch's observations.
+func (w *WindowedHistogram) current() *windowSlice {
+	epoch := w.epoch()
+	s := &w.slices[w.index(epoch)]
+	if s.epoch.Load() == epoch {
+		return s
+	}
+	w.rotate.Lock()
+	if s.epoch.Load() != epoch {
+		for i := range s.buckets {
+			s.buckets[i].Store(0)
+		}
+		s.sum.Store(0)
+		s.epoch.Store(epoch)
+	}
+	w.rotate.Unlock()
+	return s
+}
+
+// live returns a bitmask of the slices whose observations fall within the
+// window.
+func (w *WindowedHistogram) live() uint64 {
+	epoch := w.epoch()
+	n := int64(len(w.slices))
+	var mask uint64
+	for i := range w.slices {
+		if e := w.slices[i].epoch.Load(); e <= epoch && e > epoch-n {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask
+}
+
+func (w *WindowedHistogram) index(epoch int64) int {
+	i := epoch % int64(len(w.slices))
+	if i < 0 {
+		i += int64(len(w.slices))
+	}
+	return int(i)
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	sync.Mutex
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.Lock()
+	c.t = c.t.Add(d)
+	c.Unlock()
+}
+
+func newWindowedSpec() WindowedHistogramSpec {
+	return WindowedHistogramSpec{
+		HistogramSpec: HistogramSpec{
+			Spec:    Spec{Name: "test_latency_ms", Help: "Some help."},
+			Unit:    time.Millisecond,
+			Buckets: []int64{10, 20, 40},
+		},
+		Window: time.Minute,
+	}
+}
+
+func TestWindowedHistogramSpec(t *testing.T) {
+	tests := []struct {
+		desc   string
+		modify func(*WindowedHistogramSpec)
+		ok     bool
+	}{
+		{"valid", func(*WindowedHistogramSpec) {}, true},
+		{"explicit slices", func(s *WindowedHistogramSpec) { s.Slices = 64 }, true},
+		{"too many slices", func(s *WindowedHistogramSpec) { s.Slices = 65 }, false},
+		{"negative slices", func(s *WindowedHistogramSpec) { s.Slices = -1 }, false},
+		{"no window", func(s *WindowedHistogramSpec) { s.Window = 0 }, false},
+		{"window too short", func(s *WindowedHistogramSpec) { s.Window = 5 }, false},
+		{"no buckets", func(s *WindowedHistogramSpec) { s.Buckets = nil }, false},
+		{"var tags", func(s *WindowedHistogramSpec) { s.VarTags = []string{"foo"} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			spec := newWindowedSpec()
+			tt.modify(&spec)
+			_, err := New().Scope().WindowedHistogram(spec)
+			if tt.ok {
+				assert.NoError(t, err, "Expected success.")
+			} else {
+				assert.Error(t, err, "Expected an error.")
+			}
+		})
+	}
+}
+
+func TestWindowedHistogram(t *testing.T) {
+	clock := newFakeClock()
+	root := New(WithClock(clock))
+
+	w, err := root.Scope().WindowedHistogram(newWindowedSpec()) // 10s slices
+	require.NoError(t, err, "Unexpected error constructing windowed histogram.")
+
+	assert.Zero(t, w.Count(), "Unexpected count in empty window.")
+	assert.True(t, math.IsNaN(w.Quantile(0.5)), "Expected NaN quantile for empty window.")
+	assert.True(t, math.IsNaN(w.Mean()), "Expected NaN mean for empty window.")
+
+	w.IncBucketN(5, 4)
+	clock.Add(30 * time.Second)
+	w.Observe(35 * time.Millisecond)
+	w.IncBucket(1000)
+
+	assert.Equal(t, int64(6), w.Count(), "Unexpected count.")
+	assert.Equal(t, int64(1055), w.Sum(), "Unexpected sum.")
+	assert.Equal(t, 7.5, w.Quantile(0.5), "Unexpected median.")
+	assert.Equal(t, math.Inf(1), w.Quantile(0.99), "Unexpected p99.")
+
+	// Once the first slice ages out, only the later observations remain.
+	clock.Add(35 * time.Second)
+	assert.Equal(t, int64(2), w.Count(), "Unexpected count after first slice expired.")
+	assert.Equal(t, int64(1035), w.Sum(), "Unexpected sum after first slice expired.")
+	assert.Equal(t, 517.5, w.Mean(), "Unexpected mean after first slice expired.")
+	assert.Equal(t, float64(40), w.Quantile(0.5), "Unexpected median after first slice expired.")
+
+	// A new observation reusing the expired slice shouldn't see stale data.
+	clock.Add(30 * time.Second)
+	w.IncBucket(15)
+	assert.Equal(t, int64(1), w.Count(), "Unexpected count after reusing slice.")
+	assert.Equal(t, float64(15), w.Quantile(0.5), "Unexpected median after reusing slice.")
+
+	w.ObserveN(15*time.Millisecond, 2)
+	w.ObserveMany([]time.Duration{5 * time.Millisecond, 25 * time.Millisecond})
+	assert.Equal(t, int64(5), w.Count(), "Unexpected count after batches.")
+	assert.Equal(t, int64(75), w.Sum(), "Unexpected sum after batches.")
+
+	clock.Add(time.Hour)
+	assert.Zero(t, w.Count(), "Expected window to be empty after an hour.")
+
+	// Exports remain cumulative.
+	c := w.Cumulative()
+	assert.Equal(t, int64(11), c.Count(), "Unexpected cumulative count.")
+	snap := root.Snapshot()
+	require.Equal(t, 1, len(snap.Histograms), "Unexpected number of histogram snapshots.")
+	assert.Equal(t, []int64{10, 10, 10, 10, 10, 20, 20, 20, 40, 40, math.MaxInt64}, snap.Histograms[0].Values, "Unexpected cumulative observations.")
+}
+
+func TestWindowedHistogramConcurrency(t *testing.T) {
+	clock := newFakeClock()
+	root := New(WithClock(clock))
+	w, err := root.Scope().WindowedHistogram(newWindowedSpec())
+	require.NoError(t, err, "Unexpected error constructing windowed histogram.")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				w.IncBucket(int64(j % 50))
+				w.Quantile(0.99)
+				if j%100 == 0 {
+					clock.Add(time.Second)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(8000), w.Cumulative().Count(), "Unexpected cumulative count.")
+}